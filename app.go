@@ -1,18 +1,21 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,13 +27,25 @@ import (
 
 // Proxy 結構定義
 type Proxy struct {
-	ID      string `json:"id"`
-	IP      string `json:"ip"`
-	Port    string `json:"port"`
-	Country string `json:"country"`
-	Latency int64  `json:"latency"`
-	Status  string `json:"status"`
-	Source  string `json:"source"`
+	ID       string `json:"id"`
+	IP       string `json:"ip"`
+	Port     string `json:"port"`
+	Country  string `json:"country"`
+	Latency  int64  `json:"latency"`
+	Status   string `json:"status"`
+	Source   string `json:"source"`
+	Protocol string `json:"protocol,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// HTTPS 代理的 TLS 設定 (僅 protocol 為 https 時使用)
+	TLSServerName string `json:"tlsServerName,omitempty"`
+	TLSCAFile     string `json:"tlsCaFile,omitempty"`
+	TLSCertFile   string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile    string `json:"tlsKeyFile,omitempty"`
+
+	// 多跳代理鏈: 依序經過的前置節點，最後才連到本節點
+	Via []Proxy `json:"via,omitempty"`
 }
 
 // 驗證結果結構
@@ -38,8 +53,18 @@ type CheckResult struct {
 	Latency int64  `json:"latency"`
 	Success bool   `json:"success"`
 	Country string `json:"country"`
+	Error   string `json:"error,omitempty"`
+
+	// 代理鏈中失敗的節點 (從 1 開始，0 表示未知或非鏈路問題)
+	FailedHop int `json:"failedHop,omitempty"`
+
+	// SOCKS5 節點是否支援 UDP 轉發 (僅 CheckProxyUDP 填入)
+	UDPSupported *bool `json:"udpSupported,omitempty"`
 }
 
+// 上游代理要求認證 (407) 時回傳的錯誤
+var errProxyAuthRequired = errors.New("proxy authentication required")
+
 // App 結構
 type App struct {
 	ctx context.Context
@@ -50,9 +75,78 @@ type App struct {
 	localServer  *http.Server
 	localPort    string
 
+	// SOCKS5 入站
+	socksListener net.Listener
+	socksPort     string
+	socksUser     string
+	socksPass     string
+
 	// 系統設定備份
 	proxyBackup map[string]interface{}
 
+	// 固定的前置代理鏈
+	proxyChain []Proxy
+
+	// 自動故障切換
+	standby           []Proxy
+	failCount         int
+	failoverThreshold int
+	failoverRunning   bool
+
+	// 策略組 (啟用時取代 activeRemote)
+	groups      map[string]*policyGroup
+	activeGroup string
+
+	// 分流規則
+	rules     []*compiledRule
+	rulesPath string
+
+	// 系統代理模式 (manual / pac)
+	proxyMode string
+
+	// 區域網路分享與入站客戶端
+	lan      LANConfig
+	lanAllow []*net.IPNet
+	clients  clientTracker
+
+	// 本地中轉是否同時監聽 IPv6 loopback
+	ipv6Loopback bool
+
+	// 依上游共用的 Transport (連線重用)
+	transports transportPool
+
+	// 通道逾時
+	tunnelIdleTimeout time.Duration
+	tunnelMaxLifetime time.Duration
+
+	// SOCKS5 UDP 關聯閒置上限
+	udpIdleTimeout time.Duration
+
+	// Linux 透明代理
+	transparent transparentState
+
+	// 流量統計與頻寬限制
+	traffic   trafficStats
+	bandwidth bandwidthLimiter
+
+	// 連線表
+	conns connRegistry
+
+	// 請求檢視器
+	inspector inspector
+
+	// HTTPS 解密
+	mitm mitmState
+
+	// 目標網站 TLS 驗證策略
+	tlsVerify tlsVerifier
+
+	// DNS 解析策略
+	dns dnsState
+
+	// 本機 DNS 洩漏測試服務
+	leakService *leakStandIn
+
 	// Kill Switch 控制
 	killSwitchOn bool
 	ksCancel     context.CancelFunc
@@ -61,6 +155,14 @@ type App struct {
 func NewApp() *App {
 	return &App{
 		localPort: "2080",
+		socksPort: "2081",
+
+		failoverThreshold: defaultFailoverThreshold,
+
+		tunnelIdleTimeout: defaultTunnelIdleTimeout,
+		tunnelMaxLifetime: defaultTunnelMaxLifetime,
+
+		udpIdleTimeout: defaultUDPIdleTimeout,
 	}
 }
 
@@ -77,11 +179,15 @@ func (a *App) startup(ctx context.Context) {
 // 關閉時還原設定並清理資源
 func (a *App) cleanup() {
 	_ = a.DisableSystemProxy()
+	a.stopProxyGroups()
 
 	if a.proxyBackup != nil {
 		_ = RestoreProxySettings(a.proxyBackup)
 	}
 
+	// 已接管的通道不受 Shutdown 管理，需另外關閉
+	a.closeAllConnections()
+
 	a.mu.Lock()
 	if a.localServer != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -89,7 +195,14 @@ func (a *App) cleanup() {
 		_ = a.localServer.Shutdown(ctx)
 		a.localServer = nil
 	}
+	a.stopSocksServerLocked()
 	a.mu.Unlock()
+
+	a.transports.closeAll()
+	a.stopTrafficReporter()
+	a.StopLeakTestService()
+	// 程式結束後重導規則仍會生效，必須移除
+	a.stopTransparent()
 }
 
 // ---------------- Wails 匯出給前端的函式 ----------------
@@ -99,32 +212,114 @@ func (a *App) SetLocalPort(port string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.localPort = port
-	// 如果端口改變，重啟服務
+	// 如果端口改變，重啟服務 (含已接管的通道)
+	a.closeAllConnections()
+	if a.localServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+		a.localServer.Shutdown(ctx)
+		a.localServer = nil
+	}
+	a.stopSocksServerLocked()
+}
+
+// 1-1. 設定 SOCKS5 入站端口 (留空則停用)
+func (a *App) SetSocksPort(port string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.socksPort = port
+	// 與 HTTP 中轉一同重啟，因此兩者都需關閉
+	a.closeAllConnections()
 	if a.localServer != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancel()
 		a.localServer.Shutdown(ctx)
 		a.localServer = nil
 	}
+	a.stopSocksServerLocked()
+}
+
+// 1-2. 設定 SOCKS5 入站帳密 (留空則不需認證)
+func (a *App) SetSocksAuth(username, password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.socksUser = username
+	a.socksPass = password
 }
 
 // 2. 啟動系統代理 (連線)
 func (a *App) SetSystemProxy(ip, port, protocol string) string {
+	return a.SetSystemProxyNode(Proxy{IP: ip, Port: port, Protocol: protocol})
+}
+
+// 2-1. 啟動系統代理 (使用完整節點資訊，含認證帳密與代理鏈)
+func (a *App) SetSystemProxyNode(node Proxy) string {
+	ip, port, protocol := node.IP, node.Port, node.Protocol
+	a.applyProxyChain(&node)
+
 	// 先預檢查代理是否可用
-	check := a.CheckProxy(ip, port, protocol)
+	check := a.checkProxy(&node)
 	if !check.Success {
 		if a.ctx != nil {
-			wailsRuntime.LogError(a.ctx, fmt.Sprintf("Proxy %s:%s failed pre-check", ip, port))
+			wailsRuntime.LogError(a.ctx, fmt.Sprintf("Proxy %s failed pre-check", net.JoinHostPort(ip, port)))
+		}
+		if check.FailedHop > 0 {
+			wailsRuntime.EventsEmit(a.ctx, "connection_failed", fmt.Sprintf("代理鏈第 %d 跳連線失敗", check.FailedHop))
+			return "chain_failed"
+		}
+		if check.Error == "auth_required" {
+			wailsRuntime.EventsEmit(a.ctx, "connection_failed", "代理認證失敗，請確認帳號密碼")
+			return "auth_failed"
 		}
 		wailsRuntime.EventsEmit(a.ctx, "connection_failed", "代理預檢失敗，節點可能已失效")
 		return "precheck_failed"
 	}
 
 	a.mu.Lock()
-	a.activeRemote = &Proxy{IP: ip, Port: port, Source: protocol}
-	lport := a.localPort
+	old := a.activeRemote
+	a.activeRemote = &node
+	a.activeGroup = ""
+	a.failCount = 0
 	a.mu.Unlock()
 
+	// 換線後舊節點的閒置連線不再使用
+	if old != nil && transportKey(old) != transportKey(&node) {
+		a.transports.invalidate(old)
+	}
+
+	if result := a.activateLocalProxy(); result != "Success" {
+		return result
+	}
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Proxy set successfully: %s via %s", net.JoinHostPort(ip, port), protocol))
+	}
+
+	// 發送成功事件給前端
+	wailsRuntime.EventsEmit(a.ctx, "connection_success", map[string]interface{}{
+		"ip":       ip,
+		"port":     port,
+		"protocol": protocol,
+		"latency":  check.Latency,
+		"country":  check.Country,
+	})
+
+	// 延遲發送代理已準備好的事件
+	go func() {
+		time.Sleep(1000 * time.Millisecond)
+		wailsRuntime.EventsEmit(a.ctx, "proxy_ready", true)
+	}()
+
+	return "Success"
+}
+
+// 啟動本地中轉並將系統代理指向它 (單一節點與策略組共用)
+func (a *App) activateLocalProxy() string {
+	a.mu.RLock()
+	lport := a.localPort
+	a.mu.RUnlock()
+	lhost := a.localProxyHost()
+
 	// 啟動本地中轉伺服器
 	err := a.StartLocalMiddleware()
 	if err != nil {
@@ -139,7 +334,7 @@ func (a *App) SetSystemProxy(ip, port, protocol string) string {
 	time.Sleep(500 * time.Millisecond)
 
 	// 測試本地伺服器是否運行
-	testURL := fmt.Sprintf("http://127.0.0.1:%s", lport)
+	testURL := fmt.Sprintf("http://%s", net.JoinHostPort(lhost, lport))
 	resp, err := http.Get(testURL)
 	if err != nil {
 		if a.ctx != nil {
@@ -151,7 +346,7 @@ func (a *App) SetSystemProxy(ip, port, protocol string) string {
 	resp.Body.Close()
 
 	// 設定系統代理
-	if err := EnableSystemProxy("127.0.0.1", lport); err != nil {
+	if err := a.enableSystemProxyMode(lhost, lport); err != nil {
 		if a.ctx != nil {
 			wailsRuntime.LogError(a.ctx, fmt.Sprintf("Failed to set system proxy: %v", err))
 		}
@@ -159,25 +354,6 @@ func (a *App) SetSystemProxy(ip, port, protocol string) string {
 		return "system_proxy_failed"
 	}
 
-	if a.ctx != nil {
-		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Proxy set successfully: %s:%s via %s", ip, port, protocol))
-	}
-
-	// 發送成功事件給前端
-	wailsRuntime.EventsEmit(a.ctx, "connection_success", map[string]interface{}{
-		"ip":       ip,
-		"port":     port,
-		"protocol": protocol,
-		"latency":  check.Latency,
-		"country":  check.Country,
-	})
-
-	// 延遲發送代理已準備好的事件
-	go func() {
-		time.Sleep(1000 * time.Millisecond)
-		wailsRuntime.EventsEmit(a.ctx, "proxy_ready", true)
-	}()
-
 	return "Success"
 }
 
@@ -185,8 +361,11 @@ func (a *App) SetSystemProxy(ip, port, protocol string) string {
 func (a *App) DisableSystemProxy() string {
 	a.mu.Lock()
 	a.activeRemote = nil
+	a.activeGroup = ""
 	a.mu.Unlock()
 
+	a.transports.closeAll()
+
 	// 關閉 Kill Switch
 	if a.ksCancel != nil {
 		a.ksCancel()
@@ -205,40 +384,27 @@ func (a *App) DisableSystemProxy() string {
 	return "Disabled"
 }
 
-// 4. 驗證節點 (前端驗證按鈕使用) - 已修復國家檢測與 JSON 解析問題
-// 4. 驗證節點 (已修復國家檢測與 User-Agent 問題)
+// 4. 驗證節點 (前端驗證按鈕使用)
 func (a *App) CheckProxy(ip string, port string, protocol string) CheckResult {
-	var transport *http.Transport
+	node := &Proxy{IP: ip, Port: port, Protocol: protocol}
+	a.applyProxyChain(node)
+	return a.checkProxy(node)
+}
 
-	// 設定連線超時
-	dialer := &net.Dialer{
-		Timeout:   5 * time.Second,
-		KeepAlive: 30 * time.Second,
-	}
+// 4-1. 驗證節點 (使用完整節點資訊，含認證帳密與代理鏈)
+func (a *App) CheckProxyNode(node Proxy) CheckResult {
+	a.applyProxyChain(&node)
+	return a.checkProxy(&node)
+}
 
-	// 根據協議建構 Transport
-	if strings.ToLower(protocol) == "socks5" {
-		s5Dialer, err := proxy.SOCKS5("tcp", fmt.Sprintf("%s:%s", ip, port), nil, proxy.Direct)
-		if err != nil {
-			return CheckResult{0, false, ""}
-		}
-		transport = &http.Transport{
-			Dial:              s5Dialer.Dial,
-			DisableKeepAlives: true,
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		}
-	} else {
-		pUrl, err := url.Parse(fmt.Sprintf("http://%s:%s", ip, port))
-		if err != nil {
-			return CheckResult{0, false, ""}
-		}
-		transport = &http.Transport{
-			Proxy:             http.ProxyURL(pUrl),
-			DialContext:       dialer.DialContext,
-			DisableKeepAlives: true,
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		}
-	}
+func (a *App) checkProxy(p *Proxy) CheckResult {
+	ip, port := p.IP, p.Port
+	hops := proxyHops(p)
+
+	// 根據協議 (與代理鏈) 建構 Transport，設定連線超時
+	transport := upstreamTransport(p, 5*time.Second, a.proxyResolver(p))
+	transport.DisableKeepAlives = true
+	transport.TLSClientConfig = a.upstreamTLSConfig()
 
 	// 建立一個走代理的 Client
 	client := &http.Client{
@@ -258,11 +424,17 @@ func (a *App) CheckProxy(ip string, port string, protocol string) CheckResult {
 	req.Header.Set("User-Agent", userAgent)
 
 	resp, err := client.Do(req)
+	if errors.Is(err, errProxyAuthRequired) {
+		return CheckResult{Error: "auth_required", FailedHop: failedHop(err)}
+	}
 
 	// 如果策略 A 成功
 	if err == nil {
 		defer resp.Body.Close()
 		// 檢查狀態碼，有些代理會返回 403 或 407
+		if resp.StatusCode == http.StatusProxyAuthRequired {
+			return CheckResult{Error: "auth_required"}
+		}
 		if resp.StatusCode == 200 {
 			var geoData struct {
 				Status      string `json:"status"`
@@ -289,6 +461,17 @@ func (a *App) CheckProxy(ip string, port string, protocol string) CheckResult {
 	reqBackup.Header.Set("User-Agent", userAgent)
 
 	respBackup, errBackup := client.Do(reqBackup)
+	// HTTPS 走 CONNECT，代理拒絕認證時由 checkConnectAuth 回報
+	if errors.Is(errBackup, errProxyAuthRequired) {
+		return CheckResult{Error: "auth_required", FailedHop: failedHop(errBackup)}
+	}
+	// 憑證驗證失敗代表代理可能竄改 HTTPS，與連線失敗分開回報
+	if isTLSVerifyError(errBackup) {
+		if a.ctx != nil {
+			wailsRuntime.LogWarning(a.ctx, fmt.Sprintf("Proxy %s failed TLS verification: %v", net.JoinHostPort(ip, port), errBackup))
+		}
+		return CheckResult{Error: "tls_verify_failed"}
+	}
 	if errBackup == nil {
 		defer respBackup.Body.Close()
 		if respBackup.StatusCode == 200 {
@@ -303,9 +486,32 @@ func (a *App) CheckProxy(ip string, port string, protocol string) CheckResult {
 
 	// 如果兩種策略都失敗
 	if a.ctx != nil {
-		wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("Proxy check failed for %s:%s", ip, port))
+		wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("Proxy check failed for %s", net.JoinHostPort(ip, port)))
 	}
-	return CheckResult{0, false, ""}
+
+	// 代理鏈: 回報失敗的節點，各跳都連上時則歸咎於出口節點
+	if len(hops) > 1 {
+		hop := failedHop(err, errBackup)
+		if hop == 0 {
+			hop = len(hops)
+		}
+		if a.ctx != nil {
+			wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("Proxy chain failed at hop %d", hop))
+		}
+		return CheckResult{Error: "hop_failed", FailedHop: hop}
+	}
+	return CheckResult{}
+}
+
+// 從錯誤中取出代理鏈失敗的節點編號
+func failedHop(errs ...error) int {
+	var he *hopError
+	for _, err := range errs {
+		if errors.As(err, &he) {
+			return he.Hop
+		}
+	}
+	return 0
 }
 
 // 5. 抓取線上代理 (抓取按鈕使用)
@@ -366,33 +572,20 @@ func (a *App) FetchRealProxies(urls []string) []Proxy {
 					break
 				}
 
-				line = strings.TrimSpace(line)
-				if line == "" || !strings.Contains(line, ":") {
+				p, ok := parseProxyLine(line)
+				if !ok {
 					continue
 				}
-
-				parts := strings.Split(line, ":")
-				if len(parts) >= 2 {
-					ip := strings.TrimSpace(parts[0])
-					port := strings.TrimSpace(parts[1])
-
-					// 驗證IP和端口格式
-					if net.ParseIP(ip) == nil {
-						continue
-					}
-					if _, err := strconv.Atoi(port); err != nil {
-						continue
-					}
-
-					temp = append(temp, Proxy{
-						ID:      fmt.Sprintf("API-%d-%d", time.Now().UnixNano()%10000, i),
-						IP:      ip,
-						Port:    port,
-						Country: "UN",
-						Status:  "new",
-						Source:  "API",
-					})
+				// 線上清單僅接受 IP 位址 (含帶 zone 的 IPv6)
+				if !isIPAddr(p.IP) {
+					continue
 				}
+
+				p.ID = fmt.Sprintf("API-%d-%d", time.Now().UnixNano()%10000, i)
+				p.Country = "UN"
+				p.Status = "new"
+				p.Source = "API"
+				temp = append(temp, p)
 			}
 
 			mu.Lock()
@@ -428,13 +621,103 @@ func (a *App) FetchRealProxies(urls []string) []Proxy {
 	return uniqueProxies
 }
 
+// 5-1. 解析代理清單文字 (檔案匯入使用)
+func (a *App) ParseProxyList(content string) []Proxy {
+	result := make([]Proxy, 0)
+	now := time.Now().UnixMilli()
+
+	for i, line := range strings.Split(content, "\n") {
+		p, ok := parseProxyLine(line)
+		if !ok {
+			continue
+		}
+		p.ID = fmt.Sprintf("FILE-%d-%d", now, i)
+		p.Country = "UN"
+		p.Status = "new"
+		p.Source = "File"
+		result = append(result, p)
+	}
+
+	return removeDuplicateProxies(result)
+}
+
+// 解析單行代理，支援以下格式:
+//
+//	ip:port
+//	user:pass@ip:port
+//	ip:port:user:pass
+//
+// IPv6 位址需以中括號包住，例如 [2001:db8::1]:8080 或 [fe80::1%eth0]:8080
+func parseProxyLine(line string) (Proxy, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || !strings.Contains(line, ":") {
+		return Proxy{}, false
+	}
+
+	var p Proxy
+	if at := strings.LastIndex(line, "@"); at >= 0 {
+		user, pass, ok := strings.Cut(line[:at], ":")
+		if !ok {
+			return Proxy{}, false
+		}
+		p.Username, p.Password = user, pass
+		line = line[at+1:]
+	}
+
+	// IPv6 位址需以中括號包住: [2001:db8::1]:8080
+	var host, rest string
+	if strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "]")
+		if end < 0 || !strings.HasPrefix(line[end+1:], ":") {
+			return Proxy{}, false
+		}
+		host, rest = line[1:end], line[end+2:]
+		// 鏈路本地位址可附帶介面名稱 (zone)
+		addr, zone, hasZone := strings.Cut(host, "%")
+		if net.ParseIP(addr) == nil || (hasZone && zone == "") {
+			return Proxy{}, false
+		}
+	} else {
+		host, rest, _ = strings.Cut(line, ":")
+	}
+
+	parts := strings.Split(rest, ":")
+	switch {
+	case len(parts) == 1:
+	case len(parts) == 3 && p.Username == "":
+		p.Username = strings.TrimSpace(parts[1])
+		p.Password = strings.TrimSpace(parts[2])
+	default:
+		return Proxy{}, false
+	}
+
+	p.IP = strings.TrimSpace(host)
+	p.Port = strings.TrimSpace(parts[0])
+
+	// 驗證IP和端口格式
+	if p.IP == "" {
+		return Proxy{}, false
+	}
+	if port, err := strconv.ParseUint(p.Port, 10, 16); err != nil || port == 0 {
+		return Proxy{}, false
+	}
+
+	return p, true
+}
+
+// 判斷是否為 IP 位址，IPv6 可附帶 zone (例如 fe80::1%eth0)
+func isIPAddr(host string) bool {
+	_, err := netip.ParseAddr(host)
+	return err == nil
+}
+
 // 去重函數
 func removeDuplicateProxies(proxies []Proxy) []Proxy {
 	seen := make(map[string]bool)
 	unique := make([]Proxy, 0, len(proxies))
 
 	for _, proxy := range proxies {
-		key := proxy.IP + ":" + proxy.Port
+		key := net.JoinHostPort(proxy.IP, proxy.Port)
 		if !seen[key] {
 			seen[key] = true
 			unique = append(unique, proxy)
@@ -446,17 +729,28 @@ func removeDuplicateProxies(proxies []Proxy) []Proxy {
 
 // 6. 檢測出口 IP (檢測按鈕使用)
 func (a *App) GetSystemProxyExitIP() string {
-	a.mu.Lock()
+	return a.exitIP("http://api.ipify.org")
+}
+
+// 6-1. 檢測 IPv6 出口 (節點不支援 IPv6 時回傳 ERROR)
+func (a *App) GetSystemProxyExitIPv6() string {
+	return a.exitIP("http://api6.ipify.org")
+}
+
+// 透過本地中轉查詢出口 IP
+func (a *App) exitIP(endpoint string) string {
+	a.mu.RLock()
 	port := a.localPort
-	a.mu.Unlock()
+	running := a.localServer != nil
+	a.mu.RUnlock()
 
 	// 檢查本地伺服器是否運行
-	if a.localServer == nil {
+	if !running {
 		return "ERROR: Local server not running"
 	}
 
 	// 強制透過本地中轉端口發送請求
-	proxyURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%s", port))
+	proxyURL := &url.URL{Scheme: "http", Host: net.JoinHostPort(a.localProxyHost(), port)}
 	client := &http.Client{
 		Transport: &http.Transport{
 			Proxy:       http.ProxyURL(proxyURL),
@@ -465,7 +759,7 @@ func (a *App) GetSystemProxyExitIP() string {
 		Timeout: 5 * time.Second,
 	}
 
-	resp, err := client.Get("http://api.ipify.org")
+	resp, err := client.Get(endpoint)
 	if err != nil {
 		if a.ctx != nil {
 			wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("Failed to get exit IP: %v", err))
@@ -503,6 +797,13 @@ func (a *App) ToggleKillSwitch(enabled bool, ip string, port string, protocol st
 	ctx, cancel := context.WithCancel(context.Background())
 	a.ksCancel = cancel
 
+	// 若監控的是目前連線中的節點，沿用其認證資訊
+	node := &Proxy{IP: ip, Port: port, Protocol: protocol, Via: append([]Proxy(nil), a.proxyChain...)}
+	if r := a.activeRemote; r != nil && r.IP == ip && r.Port == port {
+		cp := *r
+		node = &cp
+	}
+
 	go func() {
 		ticker := time.NewTicker(3 * time.Second)
 		defer ticker.Stop()
@@ -513,7 +814,15 @@ func (a *App) ToggleKillSwitch(enabled bool, ip string, port string, protocol st
 				return
 			case <-ticker.C:
 				// 定期檢查連線
-				res := a.CheckProxy(ip, port, protocol)
+				// 後端自動切換節點後改為監控新的節點
+				a.mu.RLock()
+				target := node
+				if a.activeRemote != nil {
+					target = a.activeRemote
+				}
+				a.mu.RUnlock()
+
+				res := a.checkProxy(target)
 				if !res.Success {
 					// 失敗則切斷網路 (將代理設為無效地址)
 					EnableSystemProxy("127.0.0.1", "1")
@@ -554,26 +863,73 @@ func (a *App) StartLocalMiddleware() error {
 		return nil // 已經啟動
 	}
 	port := a.localPort
+	addrs := a.listenAddrsLocked()
 	a.mu.Unlock()
 
 	// 檢查端口是否可用
-	listener, err := net.Listen("tcp", "127.0.0.1:"+port)
+	listener, err := listenTCP(addrs, port)
 	if err != nil {
 		return fmt.Errorf("port %s is already in use: %v", port, err)
 	}
-	listener.Close()
+
+	// 同時啟動 SOCKS5 入站
+	if err := a.startSocksServer(); err != nil {
+		listener.Close()
+		return err
+	}
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("收到請求: %s %s", r.Method, r.URL.String()))
-		a.mu.RLock()
-		remote := a.activeRemote
-		a.mu.RUnlock()
+		if a.ctx != nil {
+			wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("收到請求: %s %s", r.Method, r.URL.String()))
+		}
 
-		if remote == nil {
-			http.Error(w, "No active proxy", http.StatusServiceUnavailable)
+		// 區域網路客戶端需在允許清單內
+		clientIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if !a.clientAllowed(clientIP) {
+			http.Error(w, "Client not allowed", http.StatusForbidden)
+			return
+		}
+		// 非代理格式的請求是直接打到本地中轉 (例如啟動自檢)，不轉發以免 DIRECT 規則造成迴圈
+		if r.Method != http.MethodConnect && r.URL.Host == "" {
+			if r.URL.Path == pacPath {
+				a.servePAC(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, "ProxyMaster local middleware\n")
 			return
 		}
 
+		// 入站認證 (僅區域網路客戶端)
+		if user, pass := a.inboundCredentials(clientIP); user != "" && !checkProxyAuthorization(r, user, pass) {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="ProxyMaster"`)
+			http.Error(w, "Proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+
+		host := r.Host
+		if r.URL.Host != "" {
+			host = r.URL.Host
+		}
+		defaultPort := 80
+		if r.URL.Scheme == "https" {
+			defaultPort = 443
+		}
+
+		// 依分流規則決定直連、走代理或阻擋
+		var remote *Proxy
+		switch action, _ := a.matchRule(host, defaultPort); action {
+		case actionReject:
+			http.Error(w, "Blocked by rule", http.StatusForbidden)
+			return
+		case actionProxy:
+			remote = a.pickUpstream(host)
+			if remote == nil {
+				http.Error(w, "No active proxy", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
 		// HTTPS Tunnel (CONNECT 方法)
 		if r.Method == http.MethodConnect {
 			a.handleConnect(w, r, remote)
@@ -589,51 +945,28 @@ func (a *App) StartLocalMiddleware() error {
 			target.Host = r.Host
 		}
 
-		req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), r.Body)
-		if err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			return
-		}
-
-		req.Header = cloneHeader(r.Header)
-		removeHopByHopHeaders(req.Header)
-
-		client := &http.Client{
-			Transport: buildTransport(remote),
-			Timeout:   30 * time.Second,
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			// 通知前端節點可能失效，觸發自動換線
-			wailsRuntime.EventsEmit(a.ctx, "proxy_need_rotate", remote.IP)
-			http.Error(w, "Proxy failed", http.StatusBadGateway)
-			return
-		}
-		defer resp.Body.Close()
-
-		for k, v := range resp.Header {
-			for _, vv := range v {
-				w.Header().Add(k, vv)
-			}
-		}
-		w.WriteHeader(resp.StatusCode)
-		io.Copy(w, resp.Body)
+		a.forwardHTTP(w, r, target, clientIP, remote)
 	})
 
-	a.localServer = &http.Server{
-		Addr:    "127.0.0.1:" + port,
+	server := &http.Server{
+		Addr:    listener.Addr().String(),
 		Handler: handler,
 	}
+	a.mu.Lock()
+	if a.localServer != nil {
+		// 同時有其他呼叫已完成啟動 (SOCKS5 入站由對方持有)
+		a.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	a.localServer = server
+	a.mu.Unlock()
 
 	go func() {
 		if a.ctx != nil {
 			wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Starting local middleware on port %s", port))
 		}
-		if err := a.localServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(&trackedListener{Listener: listener, tracker: &a.clients}); err != nil && err != http.ErrServerClosed {
 			if a.ctx != nil {
 				wailsRuntime.LogError(a.ctx, fmt.Sprintf("Local server error: %v", err))
 			}
@@ -643,87 +976,318 @@ func (a *App) StartLocalMiddleware() error {
 	return nil
 }
 
+// 轉發一般 HTTP 請求 (含 MITM 解密後的 HTTPS 請求) 到目標或上游代理
+func (a *App) forwardHTTP(w http.ResponseWriter, r *http.Request, target url.URL, clientIP string, remote *Proxy) {
+	// 客戶端斷線時 r.Context() 會取消，連帶中止上游請求
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	flow := a.beginTraffic(clientIP, target.Host, remote)
+	defer flow.end()
+
+	lc := a.conns.add(connKindHTTP, clientIP, target.Host, remote)
+	defer a.conns.remove(lc)
+	lc.attach(flow)
+	lc.onKill(cancel)
+
+	rec := a.inspector.begin(connKindHTTP, r.Method, target.String(), clientIP, transportLabel(remote), r.Header)
+	defer rec.finish(flow)
+
+	body := rec.requestBody(r.Body)
+	if body != nil && body != http.NoBody {
+		body = &countingReadCloser{ReadCloser: &shapedReadCloser{ReadCloser: body, s: flow.limiter(), dir: dirUp}, add: flow.addUp}
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, target.String(), body)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	req.ContentLength = r.ContentLength
+
+	req.Header = cloneHeader(r.Header)
+	removeHopByHopHeaders(req.Header)
+
+	// 不設定整體逾時 (會切斷串流與大檔下載)，改由標頭逾時與閒置逾時控制
+	// 同一上游共用 Transport 以重用連線
+	pt := a.transports.get(remote, a.upstreamTLSConfig(), a.routeResolver(remote))
+	defer pt.begin()()
+	client := &http.Client{
+		Transport: pt.transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// 協定升級 (WebSocket 等) 需保留 Upgrade 與 Connection 標頭
+	if upgrade := upgradeType(r.Header); upgrade != "" {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", upgrade)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		rec.status(http.StatusBadGateway)
+		rec.fail(err)
+		// 憑證驗證失敗不計入節點連線失敗，另以事件通知前端
+		if isTLSVerifyError(err) {
+			if a.ctx != nil {
+				wailsRuntime.LogWarning(a.ctx, err.Error())
+				wailsRuntime.EventsEmit(a.ctx, "tls_verify_failed", map[string]string{
+					"host":     target.Host,
+					"upstream": transportLabel(remote),
+					"error":    err.Error(),
+				})
+			}
+			http.Error(w, "TLS verification failed", http.StatusBadGateway)
+			return
+		}
+		if upstreamFault(err) {
+			a.reportUpstream(remote, false)
+		}
+		http.Error(w, "Proxy failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	lc.setState(connStateEstablished)
+	rec.response(resp)
+
+	// 上游要求認證代表帳密錯誤，不可把 407 轉給瀏覽器 (否則會向使用者索取本地代理帳密)
+	if remote != nil && resp.StatusCode == http.StatusProxyAuthRequired {
+		if a.ctx != nil {
+			wailsRuntime.EventsEmit(a.ctx, "proxy_auth_failed", remote.IP)
+		}
+		rec.fail(errProxyAuthRequired)
+		http.Error(w, "Upstream proxy authentication failed", http.StatusBadGateway)
+		return
+	}
+	// 已取得上游回應 (與 handleConnect 相同，在轉送內容前即計為成功)
+	a.reportUpstream(remote, true)
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		lc.setKind(connKindUpgrade)
+		handleUpgrade(w, resp, a.tunnelLimits(), lc)
+		return
+	}
+
+	for k, v := range resp.Header {
+		for _, vv := range v {
+			w.Header().Add(k, vv)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	// 限速層在最外層，copyResponse 才能在等待期間重設閒置計時
+	resp.Body = &shapedReadCloser{
+		ReadCloser: &countingReadCloser{ReadCloser: rec.responseBody(resp.Body), add: flow.addDown},
+		s:          flow.limiter(),
+		dir:        dirDown,
+	}
+	if err := copyResponse(w, resp, upstreamIdleTimeout, cancel); err != nil && a.ctx != nil {
+		wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("Response copy for %s ended: %v", target.Host, err))
+	}
+}
+
 // 處理 HTTPS CONNECT
 func (a *App) handleConnect(w http.ResponseWriter, r *http.Request, p *Proxy) {
+	client, _, _ := net.SplitHostPort(r.RemoteAddr)
+	lc := a.conns.add(connKindConnect, client, r.Host, p)
+	defer a.conns.remove(lc)
+
+	// 通道內容為加密資料，只記錄目標、狀態與位元組數
+	var flow *trafficFlow
+	rec := a.inspector.begin(connKindConnect, http.MethodConnect, "https://"+r.Host, client, transportLabel(p), r.Header)
+	defer func() { rec.finish(flow) }()
+
 	hj, ok := w.(http.Hijacker)
 	if !ok {
 		http.Error(w, "Hijack not supported", http.StatusInternalServerError)
 		return
 	}
-	clientConn, _, err := hj.Hijack()
+	clientConn, brw, err := hj.Hijack()
 	if err != nil {
 		return
 	}
 	defer clientConn.Close()
+	lc.onKill(func() { clientConn.Close() })
 
-	var upstream net.Conn
-	remoteAddr := fmt.Sprintf("%s:%s", p.IP, p.Port)
-
-	// 根據協定建立連線
-	if strings.ToLower(p.Source) == "socks5" {
-		dialer, err := proxy.SOCKS5("tcp", remoteAddr, nil, proxy.Direct)
-		if err != nil {
-			wailsRuntime.EventsEmit(a.ctx, "proxy_need_rotate", p.IP)
+	// 允許清單內的主機改為解密，逐一轉發其中的請求
+	if a.shouldIntercept(r.Host) {
+		rec.status(http.StatusOK)
+		if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
 			return
 		}
-		upstream, err = dialer.Dial("tcp", r.Host)
-	} else {
-		upstream, err = net.DialTimeout("tcp", remoteAddr, 20*time.Second)
-		if err == nil {
-			// HTTP 代理需要發送 CONNECT 請求
-			fmt.Fprintf(upstream, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", r.Host, r.Host)
-			br := bufio.NewReader(upstream)
-			// 讀取回應
-			resp, _ := br.ReadString('\n')
-			if !strings.Contains(resp, "200") {
-				upstream.Close()
-				err = fmt.Errorf("proxy refused CONNECT")
-			}
-		}
+		lc.setState(connStateEstablished)
+		a.serveMITM(&bufferedConn{Conn: clientConn, r: brw.Reader}, r.Host, client, p)
+		return
 	}
 
+	upstream, err := dialUpstream(p, r.Host, a.routeResolver(p))
 	if err != nil {
-		wailsRuntime.EventsEmit(a.ctx, "proxy_need_rotate", p.IP)
+		rec.status(http.StatusBadGateway)
+		rec.fail(err)
+	}
+	if errors.Is(err, errProxyAuthRequired) {
+		if a.ctx != nil {
+			wailsRuntime.EventsEmit(a.ctx, "proxy_auth_failed", p.IP)
+		}
+		clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+		return
+	}
+	if err != nil {
+		if upstreamFault(err) {
+			a.reportUpstream(p, false)
+		}
 		clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
 		return
 	}
 	defer upstream.Close()
+	a.reportUpstream(p, true)
+	rec.status(http.StatusOK)
+
+	flow = a.beginTraffic(client, r.Host, p)
+	defer flow.end()
+
+	lc.attach(flow)
+	lc.onKill(func() { upstream.Close() })
+	lc.setState(connStateEstablished)
 
 	// 回應瀏覽器連線建立成功
-	clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	// 客戶端未等 200 就送出的資料 (例如 TLS ClientHello) 已在緩衝區，需先轉給上游
+	if n := brw.Reader.Buffered(); n > 0 {
+		buffered, _ := brw.Reader.Peek(n)
+		if _, err := upstream.Write(buffered); err != nil {
+			return
+		}
+		flow.addUp(n)
+	}
 
 	// 雙向轉發數據
-	done := make(chan bool, 2)
+	relayConns(clientConn, upstream, a.tunnelLimits(), flow)
+}
 
-	go func() {
-		io.Copy(upstream, clientConn)
-		done <- true
-	}()
+// 處理協定升級 (101 Switching Protocols)：接管客戶端連線後與上游雙向轉發
+func handleUpgrade(w http.ResponseWriter, resp *http.Response, limits tunnelLimits, lc *liveConn) {
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		http.Error(w, "Upgrade not supported", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
 
-	go func() {
-		io.Copy(clientConn, upstream)
-		done <- true
-	}()
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Hijack not supported", http.StatusInternalServerError)
+		return
+	}
+	clientConn, brw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer clientConn.Close()
 
-	// 等待任一方向完成
-	<-done
+	// 已接管的連線不受 Server.Shutdown 管理，需能由連線表關閉
+	lc.onKill(func() {
+		clientConn.Close()
+		upstream.Close()
+	})
+
+	// 回應客戶端上游的 101 與標頭
+	fmt.Fprintf(brw, "HTTP/1.1 %s\r\n", resp.Status)
+	resp.Header.Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		return
+	}
+
+	// 客戶端在握手後已送出、尚在緩衝區的資料需先轉給上游
+	if n := brw.Reader.Buffered(); n > 0 {
+		data, _ := brw.Reader.Peek(n)
+		if _, err := upstream.Write(data); err != nil {
+			return
+		}
+		lc.flow.addUp(n)
+	}
+
+	relayConns(clientConn, upstream, limits, lc.flow)
+}
+
+// 取得請求要升級的協定 (Connection 需包含 upgrade 且帶有 Upgrade 標頭)
+func upgradeType(h http.Header) string {
+	for _, v := range h.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return h.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
+// 透過上游代理 (含代理鏈) 建立到目標位址的連線 (供 HTTP CONNECT 與 SOCKS5 入站共用)
+// 支援 socks5 / socks4 / socks4a / https，其餘協定皆視為 HTTP 代理；p 為 nil 時直連
+// r 為目前 DNS 策略的解析器 (nil 為系統解析)
+func dialUpstream(p *Proxy, target string, r *dnsResolver) (net.Conn, error) {
+	var hops []*Proxy
+	if p != nil {
+		hops = proxyHops(p)
+	}
+	return dialChain(context.Background(), hops, target, 20*time.Second, r)
 }
 
 // ---------------- 輔助函式 ----------------
 
-func buildTransport(p *Proxy) *http.Transport {
-	if strings.ToLower(p.Source) == "socks5" {
-		dialer, _ := proxy.SOCKS5("tcp", fmt.Sprintf("%s:%s", p.IP, p.Port), nil, proxy.Direct)
-		return &http.Transport{
-			Dial:            dialer.Dial,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// p 為 nil 時建立直連用的 Transport (DIRECT 規則)
+func buildTransport(p *Proxy, tlsConfig *tls.Config, r *dnsResolver) *http.Transport {
+	var transport *http.Transport
+	if p == nil {
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialChain(ctx, nil, addr, 20*time.Second, r)
+			},
 		}
+	} else {
+		transport = upstreamTransport(p, 20*time.Second, r)
+	}
+	transport.TLSClientConfig = tlsConfig
+	transport.ResponseHeaderTimeout = upstreamHeaderTimeout
+	transport.MaxIdleConns = 64
+	transport.MaxIdleConnsPerHost = 8
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+// 取得 SOCKS5 認證資訊，無帳號時回傳 nil
+func socksAuth(p *Proxy) *proxy.Auth {
+	if p.Username == "" {
+		return nil
+	}
+	return &proxy.Auth{User: p.Username, Password: p.Password}
+}
+
+// SOCKS5 認證失敗 (golang.org/x/net/proxy 未匯出錯誤型別，只能比對訊息)
+func isSocksAuthError(err error) bool {
+	if err == nil {
+		return false
 	}
-	u, _ := url.Parse(fmt.Sprintf("http://%s:%s", p.IP, p.Port))
-	return &http.Transport{
-		Proxy:           http.ProxyURL(u),
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	msg := err.Error()
+	return strings.Contains(msg, "authentication failed") ||
+		strings.Contains(msg, "no acceptable authentication methods")
+}
+
+// 產生 Basic 認證標頭值
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// CONNECT 回應檢查，將 407 轉為 errProxyAuthRequired 以便與節點失效區分
+func checkConnectAuth(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+	if connectRes.StatusCode == http.StatusProxyAuthRequired {
+		return errProxyAuthRequired
 	}
+	return nil
 }
 
 func cloneHeader(h http.Header) http.Header {
@@ -739,7 +1303,7 @@ func cloneHeader(h http.Header) http.Header {
 func removeHopByHopHeaders(h http.Header) {
 	for _, k := range []string{
 		"Connection", "Proxy-Connection", "Keep-Alive",
-		"Transfer-Encoding", "Upgrade",
+		"Transfer-Encoding", "Upgrade", "Proxy-Authorization",
 	} {
 		h.Del(k)
 	}
@@ -760,6 +1324,19 @@ func EnableSystemProxy(host, port string) error {
 	}
 }
 
+// EnableSystemProxyPAC 以自動設定 (PAC) 網址啟用系統代理 (Windows & Linux)
+func EnableSystemProxyPAC(pacURL string) error {
+	osType := runtime.GOOS
+	switch osType {
+	case "windows":
+		return enableWindowsPACProxy(pacURL)
+	case "linux":
+		return enableLinuxPACProxy(pacURL)
+	default:
+		return fmt.Errorf("unsupported operating system: %s", osType)
+	}
+}
+
 // DisableSystemProxy 關閉系統代理 (Windows & Linux)
 func DisableSystemProxy() error {
 	osType := runtime.GOOS
@@ -809,7 +1386,7 @@ func enableWindowsProxy(host, port string) error {
 
 	// 設定代理服務器
 	cmd = exec.Command("reg", "add", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
-		"/v", "ProxyServer", "/t", "REG_SZ", "/d", fmt.Sprintf("%s:%s", host, port), "/f")
+		"/v", "ProxyServer", "/t", "REG_SZ", "/d", net.JoinHostPort(host, port), "/f")
 	cmd.Run()
 
 	// 設定本地地址繞過代理
@@ -817,6 +1394,38 @@ func enableWindowsProxy(host, port string) error {
 		"/v", "ProxyOverride", "/t", "REG_SZ", "/d", "<local>;localhost;127.*;10.*;172.16.*;172.17.*;172.18.*;172.19.*;172.20.*;172.21.*;172.22.*;172.23.*;172.24.*;172.25.*;172.26.*;172.27.*;172.28.*;172.29.*;172.30.*;172.31.*;192.168.*", "/f")
 	cmd.Run()
 
+	// 移除自動設定網址 (AutoConfigURL 優先於 ProxyServer)
+	cmd = exec.Command("reg", "delete", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
+		"/v", "AutoConfigURL", "/f")
+	cmd.Run()
+
+	// 通知系統代理設定已變更
+	cmd = exec.Command("powershell", "-Command",
+		`$signature = @"
+        [DllImport("wininet.dll")] 
+        public static extern bool InternetSetOption(IntPtr hInternet, int dwOption, IntPtr lpBuffer, int dwBufferLength); 
+        "@
+        $type = Add-Type -MemberDefinition $signature -Name Wininet -Namespace Pinvoke -PassThru
+        $type::InternetSetOption([IntPtr]::Zero, 39, [IntPtr]::Zero, 0) | Out-Null
+        $type::InternetSetOption([IntPtr]::Zero, 37, [IntPtr]::Zero, 0) | Out-Null`)
+	cmd.Run()
+
+	return nil
+}
+
+func enableWindowsPACProxy(pacURL string) error {
+	// 設定自動設定網址
+	cmd := exec.Command("reg", "add", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
+		"/v", "AutoConfigURL", "/t", "REG_SZ", "/d", pacURL, "/f")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set AutoConfigURL: %v, output: %s", err, string(output))
+	}
+
+	// 停用固定代理，由 PAC 決定
+	cmd = exec.Command("reg", "add", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
+		"/v", "ProxyEnable", "/t", "REG_DWORD", "/d", "0", "/f")
+	cmd.Run()
+
 	// 通知系統代理設定已變更
 	cmd = exec.Command("powershell", "-Command",
 		`$signature = @"
@@ -837,6 +1446,11 @@ func disableWindowsProxy() error {
 		"/v", "ProxyEnable", "/t", "REG_DWORD", "/d", "0", "/f")
 	cmd.Run()
 
+	// 移除自動設定網址
+	cmd = exec.Command("reg", "delete", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
+		"/v", "AutoConfigURL", "/f")
+	cmd.Run()
+
 	// 通知系統代理設定已變更
 	cmd = exec.Command("powershell", "-Command",
 		`$signature = @"
@@ -893,6 +1507,23 @@ func backupWindowsProxySettings() (map[string]interface{}, error) {
 		}
 	}
 
+	// 備份 AutoConfigURL
+	cmd = exec.Command("reg", "query", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
+		"/v", "AutoConfigURL")
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		for _, line := range lines {
+			if strings.Contains(line, "AutoConfigURL") {
+				parts := strings.Fields(line)
+				if len(parts) >= 3 {
+					backup["AutoConfigURL"] = parts[2]
+					break
+				}
+			}
+		}
+	}
+
 	return backup, nil
 }
 
@@ -920,6 +1551,17 @@ func restoreWindowsProxySettings(backup map[string]interface{}) error {
 		}
 	}
 
+	// 還原 AutoConfigURL (原本未設定則移除)
+	if strVal, ok := backup["AutoConfigURL"].(string); ok && strVal != "" {
+		cmd := exec.Command("reg", "add", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
+			"/v", "AutoConfigURL", "/t", "REG_SZ", "/d", strVal, "/f")
+		cmd.Run()
+	} else {
+		cmd := exec.Command("reg", "delete", "HKCU\\Software\\Microsoft\\Windows\\CurrentVersion\\Internet Settings",
+			"/v", "AutoConfigURL", "/f")
+		cmd.Run()
+	}
+
 	// 通知系統代理設定已變更
 	cmd := exec.Command("powershell", "-Command",
 		`$signature = @"
@@ -954,6 +1596,20 @@ func enableLinuxProxy(host, port string) error {
 	}
 }
 
+func enableLinuxPACProxy(pacURL string) error {
+	desktop := os.Getenv("XDG_CURRENT_DESKTOP")
+
+	if strings.Contains(strings.ToLower(desktop), "gnome") ||
+		strings.Contains(strings.ToLower(desktop), "ubuntu") ||
+		strings.Contains(strings.ToLower(desktop), "unity") {
+		return enableGnomePACProxy(pacURL)
+	} else if strings.Contains(strings.ToLower(desktop), "kde") {
+		return enableKDEPACProxy(pacURL)
+	} else {
+		return enableGnomePACProxy(pacURL)
+	}
+}
+
 func disableLinuxProxy() error {
 	desktop := os.Getenv("XDG_CURRENT_DESKTOP")
 
@@ -993,6 +1649,20 @@ func backupLinuxProxySettings() (map[string]interface{}, error) {
 		if err == nil {
 			backup["gnome_http_port"] = strings.TrimSpace(string(output))
 		}
+
+		cmd = exec.Command("gsettings", "get", "org.gnome.system.proxy", "autoconfig-url")
+		output, err = cmd.Output()
+		if err == nil {
+			backup["gnome_autoconfig_url"] = strings.TrimSpace(string(output))
+		}
+	} else if strings.Contains(strings.ToLower(desktop), "kde") {
+		// 備份 KDE 設定
+		for key, value := range readKDEProxySettings() {
+			switch key {
+			case "ProxyType", "Proxy Config Script":
+				backup["kde_"+key] = value
+			}
+		}
 	}
 
 	return backup, nil
@@ -1019,6 +1689,22 @@ func restoreLinuxProxySettings(backup map[string]interface{}) error {
 			cmd := exec.Command("gsettings", "set", "org.gnome.system.proxy.http", "port", strings.Trim(port, "'\""))
 			cmd.Run()
 		}
+
+		if pacURL, ok := backup["gnome_autoconfig_url"].(string); ok {
+			cmd := exec.Command("gsettings", "set", "org.gnome.system.proxy", "autoconfig-url", strings.Trim(pacURL, "'\""))
+			cmd.Run()
+		}
+	} else if strings.Contains(strings.ToLower(desktop), "kde") {
+		// 還原 KDE 設定
+		values := make(map[string]string)
+		for _, key := range []string{"ProxyType", "Proxy Config Script"} {
+			if value, ok := backup["kde_"+key].(string); ok {
+				values[key] = value
+			}
+		}
+		if len(values) > 0 {
+			return setKDEProxySettings(values)
+		}
 	}
 
 	return nil
@@ -1059,6 +1745,24 @@ func enableGnomeProxy(host, port string) error {
 	return nil
 }
 
+func enableGnomePACProxy(pacURL string) error {
+	// 設定自動設定網址
+	cmd := exec.Command("gsettings", "set", "org.gnome.system.proxy", "autoconfig-url", pacURL)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to set GNOME autoconfig-url: %v, output: %s", err, string(output))
+	}
+
+	// 設定為自動代理模式
+	cmd = exec.Command("gsettings", "set", "org.gnome.system.proxy", "mode", "auto")
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to set GNOME proxy mode: %v, output: %s", err, string(output))
+	}
+
+	return nil
+}
+
 func disableGnomeProxy() error {
 	// 設定為無代理模式
 	cmd := exec.Command("gsettings", "set", "org.gnome.system.proxy", "mode", "none")
@@ -1127,10 +1831,11 @@ func enableKDEProxy(host, port string) error {
 	}
 
 	newLines = append(newLines, "ProxyType=1")
-	newLines = append(newLines, fmt.Sprintf("httpProxy=http://%s:%s", host, port))
-	newLines = append(newLines, fmt.Sprintf("httpsProxy=http://%s:%s", host, port))
-	newLines = append(newLines, fmt.Sprintf("ftpProxy=http://%s:%s", host, port))
-	newLines = append(newLines, fmt.Sprintf("socksProxy=http://%s:%s", host, port))
+	addr := net.JoinHostPort(host, port)
+	newLines = append(newLines, "httpProxy=http://"+addr)
+	newLines = append(newLines, "httpsProxy=http://"+addr)
+	newLines = append(newLines, "ftpProxy=http://"+addr)
+	newLines = append(newLines, "socksProxy=http://"+addr)
 	newLines = append(newLines, "NoProxyFor=localhost,127.0.0.1")
 
 	// 寫回檔案
@@ -1188,7 +1893,8 @@ func disableKDEProxy() error {
 				continue
 			}
 			// 跳過其他代理設定
-			if strings.HasPrefix(strings.TrimSpace(line), "httpProxy") ||
+			if strings.HasPrefix(strings.TrimSpace(line), "Proxy Config Script") ||
+				strings.HasPrefix(strings.TrimSpace(line), "httpProxy") ||
 				strings.HasPrefix(strings.TrimSpace(line), "httpsProxy") ||
 				strings.HasPrefix(strings.TrimSpace(line), "ftpProxy") ||
 				strings.HasPrefix(strings.TrimSpace(line), "socksProxy") ||
@@ -1213,3 +1919,111 @@ func disableKDEProxy() error {
 
 	return nil
 }
+
+func enableKDEPACProxy(pacURL string) error {
+	// ProxyType=2 代表使用自動設定腳本
+	return setKDEProxySettings(map[string]string{
+		"ProxyType":           "2",
+		"Proxy Config Script": pacURL,
+	})
+}
+
+// 讀取 kioslaverc 中 [Proxy Settings] 區段的設定
+func readKDEProxySettings() map[string]string {
+	settings := make(map[string]string)
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return settings
+	}
+	data, err := os.ReadFile(homeDir + "/.config/kioslaverc")
+	if err != nil {
+		return settings
+	}
+
+	inProxySection := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inProxySection = line == "[Proxy Settings]"
+			continue
+		}
+		if !inProxySection {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			settings[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return settings
+}
+
+// 更新 kioslaverc 中 [Proxy Settings] 區段的指定鍵值，其他設定保持不變
+func setKDEProxySettings(values map[string]string) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	kioslavercPath := homeDir + "/.config/kioslaverc"
+
+	content := ""
+	if data, err := os.ReadFile(kioslavercPath); err == nil {
+		content = string(data)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var newLines []string
+	inProxySection := false
+	proxySectionAdded := false
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.Contains(line, "[Proxy Settings]") {
+			inProxySection = true
+			proxySectionAdded = true
+			newLines = append(newLines, line)
+			// 新值緊接在區段標題後
+			for _, key := range keys {
+				newLines = append(newLines, key+"="+values[key])
+			}
+			continue
+		}
+
+		if inProxySection && strings.HasPrefix(line, "[") {
+			inProxySection = false
+		}
+
+		if inProxySection {
+			if key, _, ok := strings.Cut(line, "="); ok {
+				if _, replaced := values[strings.TrimSpace(key)]; replaced {
+					continue
+				}
+			}
+		}
+
+		newLines = append(newLines, line)
+	}
+
+	if !proxySectionAdded {
+		newLines = append(newLines, "[Proxy Settings]")
+		for _, key := range keys {
+			newLines = append(newLines, key+"="+values[key])
+		}
+	}
+
+	err = os.WriteFile(kioslavercPath, []byte(strings.Join(newLines, "\n")), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write KDE proxy settings: %v", err)
+	}
+
+	// 嘗試通過 dbus 重新載入設定
+	cmd := exec.Command("dbus-send", "--type=signal", "/KIO/Scheduler", "org.kde.KIO.Scheduler.reparseSlaveConfiguration", "string:''")
+	cmd.Run()
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseProxyLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Proxy
+		ok   bool
+	}{
+		{"ipv4", "1.2.3.4:8080", Proxy{IP: "1.2.3.4", Port: "8080"}, true},
+		{"trimmed", "  1.2.3.4:8080 \r", Proxy{IP: "1.2.3.4", Port: "8080"}, true},
+		{"hostname", "proxy.example.com:3128", Proxy{IP: "proxy.example.com", Port: "3128"}, true},
+		{"trailing credentials", "1.2.3.4:1080:user:pass", Proxy{IP: "1.2.3.4", Port: "1080", Username: "user", Password: "pass"}, true},
+		{"credentials prefix", "user:pass@1.2.3.4:1080", Proxy{IP: "1.2.3.4", Port: "1080", Username: "user", Password: "pass"}, true},
+		{"password with at sign", "user:p@ss@1.2.3.4:1080", Proxy{IP: "1.2.3.4", Port: "1080", Username: "user", Password: "p@ss"}, true},
+		{"bracketed ipv6", "[2001:db8::1]:8080", Proxy{IP: "2001:db8::1", Port: "8080"}, true},
+		{"bracketed ipv6 credentials", "[::1]:1080:user:pass", Proxy{IP: "::1", Port: "1080", Username: "user", Password: "pass"}, true},
+		{"ipv6 credentials prefix", "user:pass@[2001:db8::1]:1080", Proxy{IP: "2001:db8::1", Port: "1080", Username: "user", Password: "pass"}, true},
+		{"ipv6 zone", "[fe80::1%eth0]:1080", Proxy{IP: "fe80::1%eth0", Port: "1080"}, true},
+		{"max port", "1.2.3.4:65535", Proxy{IP: "1.2.3.4", Port: "65535"}, true},
+
+		{"empty", "", Proxy{}, false},
+		{"no port", "1.2.3.4", Proxy{}, false},
+		{"empty port", "1.2.3.4:", Proxy{}, false},
+		{"empty host", ":8080", Proxy{}, false},
+		{"port zero", "1.2.3.4:0", Proxy{}, false},
+		{"port oversized", "1.2.3.4:65536", Proxy{}, false},
+		{"port negative", "1.2.3.4:-1", Proxy{}, false},
+		{"port not numeric", "1.2.3.4:http", Proxy{}, false},
+		{"user without password", "1.2.3.4:1080:user", Proxy{}, false},
+		{"too many fields", "1.2.3.4:1080:user:pass:extra", Proxy{}, false},
+		{"credentials twice", "a:b@1.2.3.4:1080:c:d", Proxy{}, false},
+		{"prefix without colon", "user@1.2.3.4:1080", Proxy{}, false},
+		{"unbracketed ipv6", "2001:db8::1:8080", Proxy{}, false},
+		{"unterminated bracket", "[2001:db8::1:8080", Proxy{}, false},
+		{"bracket without port", "[2001:db8::1]", Proxy{}, false},
+		{"bracket not ip", "[proxy.example.com]:8080", Proxy{}, false},
+		{"bracket empty", "[]:8080", Proxy{}, false},
+		{"empty zone", "[fe80::1%]:1080", Proxy{}, false},
+		{"zone on invalid ip", "[fe80::zz%eth0]:1080", Proxy{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseProxyLine(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("parseProxyLine(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseProxyLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsIPAddr(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"1.2.3.4", true},
+		{"2001:db8::1", true},
+		{"fe80::1%eth0", true},
+		{"example.com", false},
+		{"fe80::1%", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isIPAddr(tt.host); got != tt.want {
+			t.Errorf("isIPAddr(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamAuthHelpers(t *testing.T) {
+	if got := basicAuth("Aladdin", "open sesame"); got != "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==" {
+		t.Errorf("basicAuth() = %q", got)
+	}
+	if socksAuth(&Proxy{}) != nil {
+		t.Error("socksAuth() without username should be nil")
+	}
+	if auth := socksAuth(&Proxy{Username: "u", Password: "p"}); auth == nil || auth.User != "u" || auth.Password != "p" {
+		t.Errorf("socksAuth() = %+v", auth)
+	}
+
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("socks connect tcp 1.2.3.4:1080->example.com:80: username/password authentication failed"), true},
+		{errors.New("socks connect tcp 1.2.3.4:1080->example.com:80: no acceptable authentication methods"), true},
+		{errors.New("socks connect tcp 1.2.3.4:1080->example.com:80: unknown error host unreachable"), false},
+		{errors.New("dial tcp 1.2.3.4:1080: connect: connection refused"), false},
+	} {
+		if got := isSocksAuthError(tt.err); got != tt.want {
+			t.Errorf("isSocksAuthError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		status int
+		want   error
+	}{
+		{http.StatusOK, nil},
+		{http.StatusForbidden, nil},
+		{http.StatusProxyAuthRequired, errProxyAuthRequired},
+	} {
+		err := checkConnectAuth(context.Background(), nil, nil, &http.Response{StatusCode: tt.status})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("checkConnectAuth(%d) = %v, want %v", tt.status, err, tt.want)
+		}
+	}
+}
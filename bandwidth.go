@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ---------------- 頻寬限制 (Token Bucket) ----------------
+
+// 流量方向
+const (
+	dirUp   = 0 // 客戶端 -> 目標
+	dirDown = 1 // 目標 -> 客戶端
+)
+
+const (
+	bandwidthMinBurst   = 4 * 1024  // 限速很低時每次至少可送出的量
+	bandwidthMaxChunk   = 32 * 1024 // 與通道轉發的緩衝區大小一致
+	bandwidthMaxEntries = 4096      // 超過時清除閒置的客戶端 / 主機
+	bandwidthEntryIdle  = 5 * time.Minute
+	bandwidthWaitSlice  = time.Second // 長時間等待分段進行，每段結束通知呼叫者
+)
+
+var errBandwidthDelay = errors.New("bandwidth limit: delay exceeds maximum")
+
+// BandwidthLimit 單一範圍的上下行限制 (位元組/秒)，0 表示不限制
+type BandwidthLimit struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+// BandwidthConfig 頻寬限制設定，同時套用全域、來源位址與目標主機三層
+type BandwidthConfig struct {
+	Global    BandwidthLimit `json:"global"`
+	PerClient BandwidthLimit `json:"perClient"`
+	PerHost   BandwidthLimit `json:"perHost"`
+	// 單次需等待超過此時間即中斷連線 (計入 drops)，0 表示一直等待
+	MaxDelayMs int64 `json:"maxDelayMs"`
+}
+
+// BandwidthStats 目前的限制與限速統計
+type BandwidthStats struct {
+	Limits    BandwidthConfig `json:"limits"`
+	Throttled int64           `json:"throttled"` // 因限速而等待的次數
+	DelayMs   int64           `json:"delayMs"`   // 累計等待時間
+	Drops     int64           `json:"drops"`     // 超過等待上限而中斷的連線與丟棄的 UDP 封包
+	Clients   int             `json:"clients"`   // 目前追蹤的來源位址數
+	Hosts     int             `json:"hosts"`     // 目前追蹤的目標主機數
+}
+
+// tokenBucket 允許負債的 token bucket: 先扣除再依不足量計算等待時間
+// 負債最多一個 burst，超過時需先等待償還後才能扣除
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 位元組/秒，0 表示不限制
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) burstLocked() float64 {
+	if b.rate < bandwidthMinBurst {
+		return bandwidthMinBurst
+	}
+	return b.rate
+}
+
+func (b *tokenBucket) refillLocked(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+	}
+	if burst := b.burstLocked(); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) setRate(rate int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.rate == 0 {
+		// 由不限制改為限制時從滿桶開始
+		b.rate = float64(rate)
+		b.tokens = b.burstLocked()
+		b.last = now
+		return
+	}
+	b.refillLocked(now)
+	b.rate = float64(rate)
+	if b.tokens > b.burstLocked() {
+		b.tokens = b.burstLocked()
+	}
+}
+
+// 扣除 n 個 token，回傳需等待的時間
+// 扣除後負債會超過一個 burst 時不扣除並回傳 false，等待時間為可再次嘗試的時間
+func (b *tokenBucket) reserve(n int, now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == 0 {
+		return 0, true
+	}
+	b.refillLocked(now)
+	// 沒有負債時一律允許，避免 n 大於 burst (例如限速剛調降) 時永遠無法送出
+	if b.tokens < 0 && b.tokens-float64(n) < -b.burstLocked() {
+		target := math.Min(0, float64(n)-b.burstLocked())
+		return time.Duration((target - b.tokens) / b.rate * float64(time.Second)), false
+	}
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), true
+}
+
+// 有足夠 token 時才扣除 (UDP 超量直接丟棄)
+func (b *tokenBucket) take(n int, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == 0 {
+		return true
+	}
+	b.refillLocked(now)
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+func (b *tokenBucket) refund(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == 0 {
+		return
+	}
+	b.tokens += float64(n)
+	if burst := b.burstLocked(); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+// 單次可送出的大小，避免低速時一次送出大量資料後長時間停頓
+func (b *tokenBucket) chunk() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == 0 {
+		return bandwidthMaxChunk
+	}
+	return int(b.burstLocked())
+}
+
+// bucketPair 單一範圍的上下行 bucket
+type bucketPair struct {
+	b        [2]tokenBucket
+	lastUsed atomic.Int64
+}
+
+func (p *bucketPair) setLimit(l BandwidthLimit) {
+	p.b[dirUp].setRate(l.Up)
+	p.b[dirDown].setRate(l.Down)
+}
+
+type bandwidthLimiter struct {
+	mu      sync.Mutex
+	cfg     BandwidthConfig
+	global  bucketPair
+	clients map[string]*bucketPair
+	hosts   map[string]*bucketPair
+
+	throttled atomic.Int64
+	delay     atomic.Int64 // 奈秒
+	drops     atomic.Int64
+}
+
+// 取得範圍內的 bucket，不存在時以目前設定建立 (呼叫者需持有 l.mu)
+func (l *bandwidthLimiter) pairLocked(m *map[string]*bucketPair, key string, limit BandwidthLimit) *bucketPair {
+	if *m == nil {
+		*m = make(map[string]*bucketPair)
+	}
+	p := (*m)[key]
+	if p == nil {
+		if len(*m) >= bandwidthMaxEntries {
+			pruneBuckets(*m)
+		}
+		p = &bucketPair{}
+		p.setLimit(limit)
+		(*m)[key] = p
+	}
+	p.lastUsed.Store(time.Now().UnixNano())
+	return p
+}
+
+// 移除閒置的 bucket (仍在使用中的連線保有原本的參照)
+func pruneBuckets(m map[string]*bucketPair) {
+	cutoff := time.Now().Add(-bandwidthEntryIdle).UnixNano()
+	for key, p := range m {
+		if p.lastUsed.Load() < cutoff {
+			delete(m, key)
+		}
+	}
+}
+
+// 建立一條連線使用的 shaper
+func (l *bandwidthLimiter) shaper(client, host string) *shaper {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return &shaper{
+		l: l,
+		pairs: [3]*bucketPair{
+			&l.global,
+			l.pairLocked(&l.clients, client, l.cfg.PerClient),
+			l.pairLocked(&l.hosts, host, l.cfg.PerHost),
+		},
+	}
+}
+
+func (l *bandwidthLimiter) maxDelay() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Duration(l.cfg.MaxDelayMs) * time.Millisecond
+}
+
+func (l *bandwidthLimiter) stats() BandwidthStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return BandwidthStats{
+		Limits:    l.cfg,
+		Throttled: l.throttled.Load(),
+		DelayMs:   time.Duration(l.delay.Load()).Milliseconds(),
+		Drops:     l.drops.Load(),
+		Clients:   len(l.clients),
+		Hosts:     len(l.hosts),
+	}
+}
+
+func (l *bandwidthLimiter) resetStats() {
+	l.throttled.Store(0)
+	l.delay.Store(0)
+	l.drops.Store(0)
+}
+
+// shaper 單一連線經過的全域、來源與主機 bucket
+type shaper struct {
+	l     *bandwidthLimiter
+	pairs [3]*bucketPair
+}
+
+// 在所有 bucket 扣除 n 個 token，任一 bucket 負債已滿時退回並回傳 false
+func (s *shaper) reserve(dir, n int, now time.Time) (time.Duration, bool) {
+	var delay time.Duration
+	for i, p := range s.pairs {
+		d, ok := p.b[dir].reserve(n, now)
+		p.lastUsed.Store(now.UnixNano())
+		if !ok {
+			for _, q := range s.pairs[:i] {
+				q.b[dir].refund(n)
+			}
+			return d, false
+		}
+		if d > delay {
+			delay = d
+		}
+	}
+	return delay, true
+}
+
+// 送出 n 個位元組前等待，累計等待時間超過上限時回傳錯誤
+// slept (可為 nil) 在每段等待結束後呼叫，讓呼叫者重設閒置計時
+func (s *shaper) wait(dir, n int, slept func()) error {
+	if s == nil || n <= 0 {
+		return nil
+	}
+	limit := s.l.maxDelay()
+	var total time.Duration
+	for {
+		delay, ok := s.reserve(dir, n, time.Now())
+		if delay == 0 {
+			return nil
+		}
+		if limit > 0 && total+delay > limit {
+			if ok {
+				for _, p := range s.pairs {
+					p.b[dir].refund(n)
+				}
+			}
+			s.l.drops.Add(1)
+			return errBandwidthDelay
+		}
+		if total == 0 {
+			s.l.throttled.Add(1)
+		}
+		s.l.delay.Add(int64(delay))
+		total += delay
+		for delay > 0 {
+			d := min(delay, bandwidthWaitSlice)
+			time.Sleep(d)
+			delay -= d
+			if slept != nil {
+				slept()
+			}
+		}
+		if ok {
+			return nil
+		}
+	}
+}
+
+// UDP 封包: 所有 bucket 都有足夠 token 才送出，否則丟棄
+func (s *shaper) allow(dir, n int) bool {
+	if s == nil {
+		return true
+	}
+	now := time.Now()
+	for i, p := range s.pairs {
+		if !p.b[dir].take(n, now) {
+			for _, q := range s.pairs[:i] {
+				q.b[dir].refund(n)
+			}
+			s.l.drops.Add(1)
+			return false
+		}
+		p.lastUsed.Store(now.UnixNano())
+	}
+	return true
+}
+
+// 單次讀取的上限
+func (s *shaper) chunk(dir, size int) int {
+	if s == nil {
+		return size
+	}
+	for _, p := range s.pairs {
+		if c := p.b[dir].chunk(); c < size {
+			size = c
+		}
+	}
+	return size
+}
+
+// shapedReadCloser 讀取 HTTP 請求 / 回應本文時套用頻寬限制
+type shapedReadCloser struct {
+	io.ReadCloser
+	s     *shaper
+	dir   int
+	slept func() // 限速等待期間定期呼叫 (可為 nil)
+}
+
+func (r *shapedReadCloser) Read(p []byte) (int, error) {
+	p = p[:r.s.chunk(r.dir, len(p))]
+	n, err := r.ReadCloser.Read(p)
+	if werr := r.s.wait(r.dir, n, r.slept); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// 26. 設定頻寬限制 (立即套用到進行中的連線)
+func (a *App) SetBandwidthLimits(cfg BandwidthConfig) string {
+	for _, l := range []BandwidthLimit{cfg.Global, cfg.PerClient, cfg.PerHost} {
+		if l.Up < 0 || l.Down < 0 {
+			return "invalid_limits: rates must not be negative"
+		}
+	}
+	if cfg.MaxDelayMs < 0 {
+		return "invalid_limits: maxDelayMs must not be negative"
+	}
+
+	l := &a.bandwidth
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	l.global.setLimit(cfg.Global)
+	for _, p := range l.clients {
+		p.setLimit(cfg.PerClient)
+	}
+	for _, p := range l.hosts {
+		p.setLimit(cfg.PerHost)
+	}
+	return "Success"
+}
+
+// 26-1. 取得目前的頻寬限制與限速統計
+func (a *App) GetBandwidthStats() BandwidthStats {
+	return a.bandwidth.stats()
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	type step struct {
+		at   time.Duration // 相對 t0
+		n    int
+		want time.Duration
+		ok   bool
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		start float64
+		steps []step
+	}{
+		{name: "unlimited", steps: []step{{0, 1 << 20, 0, true}, {0, 1 << 20, 0, true}}},
+		{
+			name: "within burst", rate: 10000, start: 10000,
+			steps: []step{{0, 4000, 0, true}, {0, 6000, 0, true}},
+		},
+		{
+			name: "debt waits at rate", rate: 10000, start: 10000,
+			steps: []step{{0, 12000, 200 * time.Millisecond, true}, {0, 1000, 300 * time.Millisecond, true}},
+		},
+		{
+			name: "refill over time", rate: 10000, start: 0,
+			steps: []step{{0, 5000, 500 * time.Millisecond, true}, {time.Second, 5000, 0, true}, {time.Second, 1000, 100 * time.Millisecond, true}},
+		},
+		{
+			name: "refill capped at burst", rate: 10000, start: 0,
+			steps: []step{{time.Hour, 10000, 0, true}, {time.Hour, 1000, 100 * time.Millisecond, true}},
+		},
+		{
+			name: "low rate uses minimum burst", rate: 1024, start: 0,
+			steps: []step{{time.Hour, bandwidthMinBurst, 0, true}, {time.Hour, 1024, time.Second, true}},
+		},
+		{
+			// 負債最多一個 burst: 超過時不扣除，回傳可再嘗試的時間
+			name: "debt bounded to one burst", rate: 10000, start: 0,
+			steps: []step{
+				{0, 8000, 800 * time.Millisecond, true},
+				{0, 4000, 200 * time.Millisecond, false},
+				{0, 4000, 200 * time.Millisecond, false},
+				{200 * time.Millisecond, 4000, time.Second, true},
+			},
+		},
+		{
+			name: "oversized reserve allowed without debt", rate: 1024, start: 0,
+			steps: []step{{0, 3 * bandwidthMinBurst, 12 * time.Second, true}, {0, 1024, 9 * time.Second, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &tokenBucket{rate: tt.rate, tokens: tt.start, last: t0}
+			for i, s := range tt.steps {
+				if got, ok := b.reserve(s.n, t0.Add(s.at)); got != s.want || ok != s.ok {
+					t.Fatalf("step %d: reserve(%d) = %v, %v, want %v, %v", i, s.n, got, ok, s.want, s.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucketTakeRefund(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	b := &tokenBucket{rate: 10000, tokens: 10000, last: t0}
+	if !b.take(8000, t0) {
+		t.Fatal("take(8000) with a full bucket failed")
+	}
+	if b.take(4000, t0) {
+		t.Fatal("take(4000) with 2000 tokens succeeded")
+	}
+	if b.tokens != 2000 {
+		t.Fatalf("failed take changed tokens to %v", b.tokens)
+	}
+	b.refund(100000)
+	if b.tokens != 10000 {
+		t.Errorf("refund exceeded burst: tokens = %v", b.tokens)
+	}
+
+	var unlimited tokenBucket
+	if !unlimited.take(1<<30, t0) {
+		t.Error("unlimited take failed")
+	}
+	if got := unlimited.chunk(); got != bandwidthMaxChunk {
+		t.Errorf("unlimited chunk() = %d", got)
+	}
+}
+
+func TestTokenBucketSetRate(t *testing.T) {
+	var b tokenBucket
+	b.setRate(20000)
+	if b.tokens != 20000 {
+		t.Errorf("unlimited -> limited: tokens = %v, want full bucket", b.tokens)
+	}
+	b.setRate(5000)
+	if b.tokens != 5000 {
+		t.Errorf("lower rate: tokens = %v, want clamped to 5000", b.tokens)
+	}
+	if got := b.chunk(); got != 5000 {
+		t.Errorf("chunk() = %d, want 5000", got)
+	}
+	b.setRate(100)
+	if got := b.chunk(); got != bandwidthMinBurst {
+		t.Errorf("chunk() at low rate = %d, want %d", got, bandwidthMinBurst)
+	}
+	b.setRate(0)
+	if got, ok := b.reserve(1<<20, time.Now()); got != 0 || !ok {
+		t.Errorf("reserve() after removing limit = %v", got)
+	}
+}
+
+func TestShaper(t *testing.T) {
+	var l bandwidthLimiter
+	l.cfg = BandwidthConfig{PerClient: BandwidthLimit{Up: 8192}, MaxDelayMs: 100}
+	s := l.shaper("10.0.0.1", "example.com")
+	l.global.setLimit(BandwidthLimit{Down: 1 << 20})
+
+	// 取最小的 bucket 決定單次大小
+	if got := s.chunk(dirUp, 32*1024); got != 8192 {
+		t.Errorf("chunk(up) = %d, want 8192", got)
+	}
+	if got := s.chunk(dirDown, 32*1024); got != 32*1024 {
+		t.Errorf("chunk(down) = %d, want 32768", got)
+	}
+
+	if err := s.wait(dirUp, 8192, nil); err != nil {
+		t.Fatalf("wait() within burst: %v", err)
+	}
+	// 等待超過上限: 中斷並退回 token
+	if err := s.wait(dirUp, 8192, nil); !errors.Is(err, errBandwidthDelay) {
+		t.Fatalf("wait() over max delay = %v, want %v", err, errBandwidthDelay)
+	}
+	start := time.Now()
+	if err := s.wait(dirUp, 400, nil); err != nil {
+		t.Fatalf("wait(400): %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("wait(400) returned after %v, want about 50ms", elapsed)
+	}
+	st := l.stats()
+	if st.Drops != 1 || st.Throttled != 1 || st.DelayMs < 30 || st.Clients != 1 || st.Hosts != 1 {
+		t.Errorf("stats() = %+v", st)
+	}
+
+	// 同一來源共用 bucket
+	if s2 := l.shaper("10.0.0.1", "other.com"); s2.pairs[1] != s.pairs[1] || s2.pairs[2] == s.pairs[2] {
+		t.Error("client bucket not shared or host bucket shared")
+	}
+
+	l.resetStats()
+	if st := l.stats(); st.Drops != 0 || st.Throttled != 0 || st.DelayMs != 0 {
+		t.Errorf("stats() after reset = %+v", st)
+	}
+
+	var nilShaper *shaper
+	if nilShaper.wait(dirUp, 1<<20, nil) != nil || !nilShaper.allow(dirUp, 1<<20) || nilShaper.chunk(dirUp, 10) != 10 {
+		t.Error("nil shaper should not limit")
+	}
+}
+
+func TestShaperWaitRetriesWhenDebtFull(t *testing.T) {
+	var l bandwidthLimiter
+	l.cfg = BandwidthConfig{PerClient: BandwidthLimit{Up: 100000}, MaxDelayMs: 200}
+	s := l.shaper("10.0.0.1", "example.com")
+	b := &s.pairs[1].b[dirUp]
+	b.tokens = -95000
+
+	// 負債已滿: 先等 50ms 再重試，重試後需再等約 1 秒，超過上限而中斷且不扣除
+	slept := 0
+	if err := s.wait(dirUp, 10000, func() { slept++ }); !errors.Is(err, errBandwidthDelay) {
+		t.Fatalf("wait() = %v, want %v", err, errBandwidthDelay)
+	}
+	if slept != 1 {
+		t.Errorf("slept called %d times, want 1", slept)
+	}
+	if b.tokens < -95000 || b.tokens > -85000 {
+		t.Errorf("tokens = %v, want refunded after the drop", b.tokens)
+	}
+	if st := l.stats(); st.Drops != 1 || st.Throttled != 1 {
+		t.Errorf("stats() = %+v", st)
+	}
+}
+
+// UDP: 任一 bucket 不足即丟棄，已扣除的 bucket 需退回
+func TestShaperAllow(t *testing.T) {
+	var l bandwidthLimiter
+	l.cfg = BandwidthConfig{Global: BandwidthLimit{Up: 100000}, PerHost: BandwidthLimit{Up: 5000}}
+	l.global.setLimit(l.cfg.Global)
+	s := l.shaper("10.0.0.1", "example.com")
+
+	if !s.allow(dirUp, 5000) {
+		t.Fatal("allow(5000) failed")
+	}
+	if s.allow(dirUp, 1000) {
+		t.Fatal("allow() over the host limit succeeded")
+	}
+	if got := l.global.b[dirUp].tokens; got < 95000-1 {
+		t.Errorf("global tokens = %v, want refund to 95000", got)
+	}
+	if st := l.stats(); st.Drops != 1 {
+		t.Errorf("Drops = %d, want 1", st.Drops)
+	}
+}
+
+func TestPruneBuckets(t *testing.T) {
+	fresh, stale := &bucketPair{}, &bucketPair{}
+	fresh.lastUsed.Store(time.Now().UnixNano())
+	stale.lastUsed.Store(time.Now().Add(-2 * bandwidthEntryIdle).UnixNano())
+	m := map[string]*bucketPair{"fresh": fresh, "stale": stale}
+	pruneBuckets(m)
+	if len(m) != 1 || m["fresh"] != fresh {
+		t.Errorf("pruneBuckets() left %v", m)
+	}
+}
+
+func TestShapedReadCloser(t *testing.T) {
+	var l bandwidthLimiter
+	l.cfg.PerHost = BandwidthLimit{Down: 4096}
+	data := bytes.Repeat([]byte("x"), 6000)
+	r := &shapedReadCloser{ReadCloser: io.NopCloser(bytes.NewReader(data)), s: l.shaper("c", "h"), dir: dirDown}
+
+	buf := make([]byte, 32*1024)
+	n, err := r.Read(buf)
+	if err != nil || n != 4096 {
+		t.Fatalf("first Read() = %d, %v, want 4096 (one burst)", n, err)
+	}
+	start := time.Now()
+	got, err := io.ReadAll(r)
+	if err != nil || len(got) != len(data)-4096 {
+		t.Fatalf("ReadAll() = %d, %v", len(got), err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("remaining %d bytes at 4096/s read in %v", len(got), elapsed)
+	}
+}
+
+// 通道轉發等待超過上限時中斷連線
+func TestRelayConnsBandwidthDrop(t *testing.T) {
+	a := &App{}
+	if got := a.SetBandwidthLimits(BandwidthConfig{Global: BandwidthLimit{Up: 4096}, MaxDelayMs: 10}); got != "Success" {
+		t.Fatal(got)
+	}
+	client, relayClient := tcpPair(t)
+	relayUpstream, server := tcpPair(t)
+	go io.Copy(io.Discard, server)
+
+	flow := a.beginTraffic("127.0.0.1", "example.com:443", nil)
+	done := make(chan struct{})
+	go func() {
+		relayConns(relayClient, relayUpstream, tunnelLimits{}, flow)
+		flow.end()
+		close(done)
+	}()
+
+	client.Write(make([]byte, 32*1024))
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("tunnel not closed after exceeding the max delay")
+	}
+	if st := a.GetBandwidthStats(); st.Drops != 1 {
+		t.Errorf("Drops = %d, want 1", st.Drops)
+	}
+	if snap := a.GetTrafficStats(0); snap.Up != 4096 || snap.Bandwidth.Limits.Global.Up != 4096 {
+		t.Errorf("traffic = up %d, bandwidth %+v", snap.Up, snap.Bandwidth)
+	}
+}
+
+func TestSetBandwidthLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  BandwidthConfig
+		want string
+	}{
+		{name: "unlimited", cfg: BandwidthConfig{}, want: "Success"},
+		{name: "limits", cfg: BandwidthConfig{Global: BandwidthLimit{Up: 1, Down: 2}, PerClient: BandwidthLimit{Down: 3}, MaxDelayMs: 1000}, want: "Success"},
+		{name: "negative rate", cfg: BandwidthConfig{PerHost: BandwidthLimit{Down: -1}}, want: "invalid_limits: rates must not be negative"},
+		{name: "negative delay", cfg: BandwidthConfig{MaxDelayMs: -1}, want: "invalid_limits: maxDelayMs must not be negative"},
+	}
+	for _, tt := range tests {
+		a := &App{}
+		if got := a.SetBandwidthLimits(tt.cfg); got != tt.want {
+			t.Errorf("%s: SetBandwidthLimits() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// 進行中的連線立即套用新限制
+	a := &App{}
+	s := a.bandwidth.shaper("10.0.0.1", "example.com")
+	a.SetBandwidthLimits(BandwidthConfig{PerClient: BandwidthLimit{Up: 8192}, PerHost: BandwidthLimit{Down: 16384}})
+	if got := s.chunk(dirUp, 32*1024); got != 8192 {
+		t.Errorf("client chunk after update = %d, want 8192", got)
+	}
+	if got := s.chunk(dirDown, 32*1024); got != 16384 {
+		t.Errorf("host chunk after update = %d, want 16384", got)
+	}
+	if st := a.GetBandwidthStats(); st.Limits.PerClient.Up != 8192 {
+		t.Errorf("GetBandwidthStats() = %+v", st)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ---------------- 多跳代理鏈 ----------------
+
+// hopError 標示代理鏈中失敗的節點 (Hop 從 1 開始計算)
+type hopError struct {
+	Hop   int
+	Proxy *Proxy
+	Err   error
+}
+
+func (e *hopError) Error() string {
+	protocol := strings.ToLower(e.Proxy.Protocol)
+	if protocol == "" {
+		protocol = "http"
+	}
+	return fmt.Sprintf("hop %d (%s %s) failed: %v",
+		e.Hop, protocol, net.JoinHostPort(e.Proxy.IP, e.Proxy.Port), e.Err)
+}
+
+func (e *hopError) Unwrap() error {
+	return e.Err
+}
+
+// targetError 代理本身正常，但回報無法連線到目標 (目標拒絕、無法連線等)
+type targetError struct {
+	Target string
+	Err    error
+}
+
+func (e *targetError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *targetError) Unwrap() error {
+	return e.Err
+}
+
+// 轉發失敗是否歸咎於上游節點 (用於故障切換統計)
+// 用戶端取消與代理回報的目標錯誤不計入，只計入節點連線、TLS 與握手失敗
+func upstreamFault(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var te *targetError
+	if errors.As(err, &te) {
+		return false
+	}
+	var he *hopError
+	if errors.As(err, &he) {
+		return true
+	}
+	// net/http 連線 HTTP 代理失敗時的錯誤
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "proxyconnect"
+}
+
+// 展開節點的完整路徑: Via 中的前置節點依序在前，節點本身為最後一跳
+func proxyHops(p *Proxy) []*Proxy {
+	hops := make([]*Proxy, 0, len(p.Via)+1)
+	for i := range p.Via {
+		hops = append(hops, proxyHops(&p.Via[i])...)
+	}
+	return append(hops, p)
+}
+
+// 依序經過每一跳建立到 target 的連線，每一跳都透過前一跳的通道撥號
+// r 決定目標主機名稱在本機、上游或 DoH 解析 (nil 為系統解析)
+func dialChain(ctx context.Context, hops []*Proxy, target string, timeout time.Duration, r *dnsResolver) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	if len(hops) == 0 {
+		addr, err := r.direct(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	first := hops[0]
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(first.IP, first.Port))
+	if err != nil {
+		return nil, &hopError{Hop: 1, Proxy: first, Err: err}
+	}
+
+	// 整條鏈的握手共用同一個期限
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if conn, err = wrapProxyTLS(ctx, first, conn); err != nil {
+		return nil, &hopError{Hop: 1, Proxy: first, Err: err}
+	}
+
+	for i, hop := range hops {
+		next := target
+		if i+1 < len(hops) {
+			next = net.JoinHostPort(hops[i+1].IP, hops[i+1].Port)
+		}
+		if next, err = r.forHop(ctx, hop, next); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if conn, err = handshakeHop(hop, conn, next); err != nil {
+			// 中間節點連不到下一跳代表下一跳失效，不屬於目標錯誤
+			var te *targetError
+			if i+1 < len(hops) && errors.As(err, &te) {
+				err = te.Err
+			}
+			return nil, &hopError{Hop: i + 1, Proxy: hop, Err: err}
+		}
+
+		if i+1 < len(hops) {
+			if conn, err = wrapProxyTLS(ctx, hops[i+1], conn); err != nil {
+				return nil, &hopError{Hop: i + 2, Proxy: hops[i+1], Err: err}
+			}
+		}
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// SOCKS 代理回報的目標連線失敗 (SOCKS5 回覆碼 0x02-0x06 或 SOCKS4 拒絕)
+func isSocksTargetError(err error) bool {
+	if errors.Is(err, errSocks4Rejected) {
+		return true
+	}
+	msg := err.Error()
+	for _, reply := range []string{"connection not allowed by ruleset", "network unreachable", "host unreachable", "connection refused", "TTL expired"} {
+		if strings.Contains(msg, "unknown error "+reply) {
+			return true
+		}
+	}
+	return false
+}
+
+// 在已連到 hop 的連線上，要求 hop 開啟到 target 的通道
+// 失敗時會關閉 conn
+func handshakeHop(hop *Proxy, conn net.Conn, target string) (net.Conn, error) {
+	if isSocksProtocol(hop.Protocol) {
+		d, err := socksDialer(hop, &connDialer{conn: conn})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tunnel, err := d.Dial("tcp", target)
+		if err != nil {
+			conn.Close()
+			if isSocksAuthError(err) {
+				return nil, errProxyAuthRequired
+			}
+			if isSocksTargetError(err) {
+				return nil, &targetError{Target: target, Err: err}
+			}
+			return nil, err
+		}
+		return tunnel, nil
+	}
+
+	tunnel, err := connectHTTP(hop, conn, target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// 對 HTTP 代理發送 CONNECT 請求，成功時回傳可用的通道
+// 代理在回應後緊接送出的資料會保留在回傳的連線中
+func connectHTTP(p *Proxy, conn net.Conn, target string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: target},
+		Host:   target,
+		Header: http.Header{"User-Agent": {""}},
+	}
+	if p.Username != "" {
+		req.Header.Set("Proxy-Authorization", basicAuth(p.Username, p.Password))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	// 讀取完整回應 (狀態列與標頭)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONNECT response: %v", err)
+	}
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return nil, errProxyAuthRequired
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &targetError{Target: target, Err: fmt.Errorf("proxy refused CONNECT to %s: %s", target, resp.Status)}
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// connDialer 讓 SOCKS 撥號器沿用已建立的通道，而不是另外撥號
+type connDialer struct {
+	conn net.Conn
+	used bool
+}
+
+func (d *connDialer) Dial(network, addr string) (net.Conn, error) {
+	if d.used {
+		return nil, errors.New("chain: tunnel already consumed")
+	}
+	d.used = true
+	return d.conn, nil
+}
+
+// 依完整路徑建立 http.Transport
+// 最後一跳為 SOCKS 時由 DialContext 直接走整條鏈；
+// 最後一跳為 HTTP/HTTPS 時以 Proxy 指向最後一跳，並經前面的節點連到它
+func upstreamTransport(p *Proxy, timeout time.Duration, r *dnsResolver) *http.Transport {
+	hops := proxyHops(p)
+	last := hops[len(hops)-1]
+	prefix := hops[:len(hops)-1]
+
+	transport := &http.Transport{
+		OnProxyConnectResponse: checkConnectAuth,
+	}
+
+	if isSocksProtocol(last.Protocol) {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialChain(ctx, hops, addr, timeout, r)
+		}
+		return transport
+	}
+
+	u := &url.URL{Scheme: "http", Host: net.JoinHostPort(last.IP, last.Port)}
+	if last.Username != "" {
+		u.User = url.UserPassword(last.Username, last.Password)
+	}
+	transport.Proxy = http.ProxyURL(u)
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialChain(ctx, prefix, addr, timeout, r)
+		if err != nil {
+			// 前置節點連不到最後一跳，同樣視為節點失效
+			var te *targetError
+			if len(prefix) > 0 && errors.As(err, &te) {
+				return nil, &hopError{Hop: len(prefix), Proxy: prefix[len(prefix)-1], Err: te.Err}
+			}
+			return nil, err
+		}
+		if conn, err = wrapProxyTLS(ctx, last, conn); err != nil {
+			return nil, &hopError{Hop: len(hops), Proxy: last, Err: err}
+		}
+		return conn, nil
+	}
+	return transport
+}
+
+// 9. 設定固定的前置代理鏈 (例如可信任的 SOCKS5 入口)，之後連線與檢測的節點都會經過它
+func (a *App) SetProxyChain(hops []Proxy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.proxyChain = append([]Proxy(nil), hops...)
+}
+
+// 9-1. 取得目前的前置代理鏈
+func (a *App) GetProxyChain() []Proxy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Proxy{}, a.proxyChain...)
+}
+
+// 9-2. 以整條鏈驗證 (依序為入口到出口)，失敗時 FailedHop 標示出錯的節點
+func (a *App) CheckProxyChain(hops []Proxy) CheckResult {
+	if len(hops) == 0 {
+		return CheckResult{Error: "empty_chain"}
+	}
+	exit := hops[len(hops)-1]
+	exit.Via = append([]Proxy(nil), hops[:len(hops)-1]...)
+	return a.checkProxy(&exit)
+}
+
+// 節點未指定 Via 時套用固定的前置代理鏈
+func (a *App) applyProxyChain(p *Proxy) {
+	if len(p.Via) > 0 {
+		return
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if len(a.proxyChain) > 0 {
+		p.Via = append([]Proxy(nil), a.proxyChain...)
+	}
+}
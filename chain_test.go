@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 回音伺服器，作為代理鏈的最終目標
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	return startTestServer(t, func(c net.Conn) { io.Copy(c, c) })
+}
+
+func startTestServer(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// 簡易 HTTP CONNECT 代理；user 不為空時要求 Basic 認證
+func startConnectProxy(t *testing.T, user, pass string) string {
+	return startTestServer(t, func(c net.Conn) {
+		br := bufio.NewReader(c)
+		req, err := http.ReadRequest(br)
+		if err != nil || req.Method != http.MethodConnect {
+			return
+		}
+		if user != "" && req.Header.Get("Proxy-Authorization") != basicAuth(user, pass) {
+			io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return
+		}
+		up, err := net.DialTimeout("tcp", req.Host, 2*time.Second)
+		if err != nil {
+			io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			return
+		}
+		defer up.Close()
+		io.WriteString(c, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		go io.Copy(up, br)
+		io.Copy(c, up)
+	})
+}
+
+// 簡易 SOCKS5 代理 (無認證、僅 CONNECT)
+func startSocks5Proxy(t *testing.T) string {
+	return startTestServer(t, func(c net.Conn) {
+		br := bufio.NewReader(c)
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(br, head); err != nil {
+			return
+		}
+		io.ReadFull(br, make([]byte, head[1]))
+		c.Write([]byte{5, 0})
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(br, req); err != nil {
+			return
+		}
+		target, err := readSocksAddr(br, req[3])
+		if err != nil {
+			return
+		}
+		up, err := net.DialTimeout("tcp", target, 2*time.Second)
+		if err != nil {
+			c.Write([]byte{5, socks5RepHostUnreachable, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer up.Close()
+		c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		go io.Copy(up, br)
+		io.Copy(c, up)
+	})
+}
+
+func hopFor(t *testing.T, addr, protocol string) *Proxy {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Proxy{IP: host, Port: port, Protocol: protocol}
+}
+
+// 已關閉的本機端口，連線會被拒絕
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestProxyHops(t *testing.T) {
+	a := Proxy{IP: "10.0.0.1", Port: "1"}
+	b := Proxy{IP: "10.0.0.2", Port: "2", Via: []Proxy{a}}
+	c := Proxy{IP: "10.0.0.3", Port: "3", Via: []Proxy{b}}
+	d := Proxy{IP: "10.0.0.4", Port: "4", Via: []Proxy{a, {IP: "10.0.0.5", Port: "5"}}}
+
+	for _, tt := range []struct {
+		name string
+		p    Proxy
+		want []string
+	}{
+		{"single", a, []string{"10.0.0.1"}},
+		{"one via", b, []string{"10.0.0.1", "10.0.0.2"}},
+		{"nested via", c, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{"multiple via", d, []string{"10.0.0.1", "10.0.0.5", "10.0.0.4"}},
+	} {
+		var got []string
+		for _, hop := range proxyHops(&tt.p) {
+			got = append(got, hop.IP)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: proxyHops() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDialChain(t *testing.T) {
+	echo := startEchoServer(t)
+	httpA := hopFor(t, startConnectProxy(t, "", ""), "http")
+	httpB := hopFor(t, startConnectProxy(t, "", ""), "http")
+	socks := hopFor(t, startSocks5Proxy(t), "socks5")
+	authed := hopFor(t, startConnectProxy(t, "u", "p"), "http")
+	dead := hopFor(t, closedAddr(t), "http")
+
+	withAuth := *authed
+	withAuth.Username, withAuth.Password = "u", "p"
+
+	tests := []struct {
+		name    string
+		hops    []*Proxy
+		target  string
+		wantHop int // 0 表示應成功
+		wantErr error
+		fault   bool // 是否歸咎於節點
+	}{
+		{name: "direct", target: echo},
+		{name: "single http hop", hops: []*Proxy{httpA}, target: echo},
+		{name: "two http hops", hops: []*Proxy{httpA, httpB}, target: echo},
+		{name: "http then socks5", hops: []*Proxy{httpA, socks}, target: echo},
+		{name: "socks5 then http", hops: []*Proxy{socks, httpB}, target: echo},
+		{name: "authenticated hop", hops: []*Proxy{httpA, &withAuth}, target: echo},
+		{name: "first hop unreachable", hops: []*Proxy{dead, httpA}, target: echo, wantHop: 1, fault: true},
+		{name: "second hop unreachable", hops: []*Proxy{httpA, dead}, target: echo, wantHop: 1, fault: true},
+		{name: "target refused by last hop", hops: []*Proxy{httpA, httpB}, target: closedAddr(t), wantHop: 2},
+		{name: "socks5 target refused", hops: []*Proxy{socks}, target: closedAddr(t), wantHop: 1},
+		{name: "missing credentials", hops: []*Proxy{httpA, authed}, target: echo, wantHop: 2, wantErr: errProxyAuthRequired, fault: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := dialChain(context.Background(), tt.hops, tt.target, 5*time.Second, nil)
+			if tt.wantHop == 0 {
+				if err != nil {
+					t.Fatalf("dialChain() error: %v", err)
+				}
+				defer conn.Close()
+				if _, err := io.WriteString(conn, "ping"); err != nil {
+					t.Fatal(err)
+				}
+				buf := make([]byte, 4)
+				if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+					t.Fatalf("echo through chain = %q, %v", buf, err)
+				}
+				return
+			}
+
+			var he *hopError
+			if !errors.As(err, &he) {
+				t.Fatalf("dialChain() error = %v, want hopError", err)
+			}
+			if he.Hop != tt.wantHop || he.Proxy != tt.hops[tt.wantHop-1] {
+				t.Errorf("failed hop = %d (%s), want %d", he.Hop, he.Proxy.Port, tt.wantHop)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("dialChain() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := upstreamFault(err); got != tt.fault {
+				t.Errorf("upstreamFault(%v) = %v, want %v", err, got, tt.fault)
+			}
+		})
+	}
+}
+
+func TestConnectHTTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		proxy    Proxy
+		reply    string
+		wantAuth string
+		wantErr  error
+		fail     bool
+		target   bool // 代理回報的目標錯誤
+	}{
+		{name: "established", reply: "HTTP/1.1 200 Connection Established\r\n\r\n"},
+		{name: "established http/1.0", reply: "HTTP/1.0 200 OK\r\n\r\n"},
+		{name: "sends credentials", proxy: Proxy{Username: "u", Password: "p"}, reply: "HTTP/1.1 200 OK\r\n\r\n", wantAuth: basicAuth("u", "p")},
+		{name: "auth required", reply: "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n", wantErr: errProxyAuthRequired},
+		{name: "forbidden", reply: "HTTP/1.1 403 Forbidden\r\n\r\n", fail: true, target: true},
+		{name: "bad gateway", reply: "HTTP/1.1 502 Bad Gateway\r\n\r\n", fail: true, target: true},
+		{name: "not http", reply: "SSH-2.0-OpenSSH_9.0\r\n", fail: true},
+		{name: "closed without reply", reply: "", fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			gotReq := make(chan *http.Request, 1)
+			go func() {
+				defer server.Close()
+				req, err := http.ReadRequest(bufio.NewReader(server))
+				gotReq <- req
+				if err == nil {
+					io.WriteString(server, tt.reply)
+				}
+			}()
+
+			_, err := connectHTTP(&tt.proxy, client, "example.com:443")
+			req := <-gotReq
+			if req == nil || req.Method != http.MethodConnect || req.Host != "example.com:443" {
+				t.Fatalf("request = %+v", req)
+			}
+			if got := req.Header.Get("Proxy-Authorization"); got != tt.wantAuth {
+				t.Errorf("Proxy-Authorization = %q, want %q", got, tt.wantAuth)
+			}
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("connectHTTP() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.fail:
+				if err == nil {
+					t.Error("connectHTTP() succeeded, want error")
+				}
+			case err != nil:
+				t.Errorf("connectHTTP() error: %v", err)
+			}
+			var te *targetError
+			if errors.As(err, &te) != tt.target {
+				t.Errorf("connectHTTP() error = %v, targetError = %v", err, tt.target)
+			}
+		})
+	}
+}
+
+// 代理在 200 回應後緊接送出的資料不可遺失
+func TestConnectHTTPKeepsEarlyData(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(server)); err == nil {
+			io.WriteString(server, "HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-test\r\n")
+		}
+	}()
+
+	conn, err := connectHTTP(&Proxy{IP: "10.0.0.1", Port: "8080"}, client, "example.com:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(conn)
+	if string(got) != "SSH-2.0-test\r\n" {
+		t.Errorf("tunnel data = %q, want server banner", got)
+	}
+	if _, ok := conn.(closeWriter); !ok {
+		t.Error("buffered tunnel does not support half-close")
+	}
+}
+
+func TestUpstreamFault(t *testing.T) {
+	hop := &Proxy{IP: "10.0.0.1", Port: "8080"}
+	refused := errors.New("connect: connection refused")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil},
+		{name: "canceled", err: context.Canceled},
+		{name: "canceled in hop", err: &hopError{Hop: 1, Proxy: hop, Err: context.Canceled}},
+		{name: "hop error", err: &hopError{Hop: 1, Proxy: hop, Err: refused}, want: true},
+		{name: "target error", err: &targetError{Target: "example.com:443", Err: refused}},
+		{name: "target error in hop", err: &hopError{Hop: 2, Proxy: hop, Err: &targetError{Err: refused}}},
+		{name: "proxyconnect", err: &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "proxyconnect", Net: "tcp", Err: refused}}, want: true},
+		{name: "target dial", err: &net.OpError{Op: "dial", Net: "tcp", Err: refused}},
+		{name: "other", err: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		if got := upstreamFault(tt.err); got != tt.want {
+			t.Errorf("%s: upstreamFault(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsSocksTargetError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errSocks4Rejected, true},
+		{fmt.Errorf("socks4 connect: %w", errSocks4Rejected), true},
+		{errors.New("socks connect tcp 1.2.3.4:1080->example.com:443: unknown error host unreachable"), true},
+		{errors.New("socks connect tcp 1.2.3.4:1080->example.com:443: unknown error connection refused"), true},
+		{errors.New("socks connect tcp 1.2.3.4:1080->example.com:443: unknown error TTL expired"), true},
+		{errors.New("socks connect tcp 1.2.3.4:1080->example.com:443: unknown error general SOCKS server failure"), false},
+		{errors.New("dial tcp 1.2.3.4:1080: connect: connection refused"), false},
+		{errProxyAuthRequired, false},
+	}
+	for _, tt := range tests {
+		if got := isSocksTargetError(tt.err); got != tt.want {
+			t.Errorf("isSocksTargetError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
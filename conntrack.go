@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- 連線表 (Connection Table) ----------------
+
+// 連線類型
+const (
+	connKindHTTP        = "http"
+	connKindConnect     = "connect"
+	connKindUpgrade     = "upgrade"
+	connKindSocks       = "socks5"
+	connKindUDP         = "udp"
+	connKindTransparent = "transparent"
+)
+
+// 連線狀態
+const (
+	connStateConnecting  = "connecting"  // 正在連線上游
+	connStateEstablished = "established" // 通道已建立或請求進行中
+	connStateClosing     = "closing"     // 已要求關閉
+)
+
+// ConnectionInfo 目前經過中轉的單一連線
+type ConnectionInfo struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	Client    string `json:"client"`
+	Host      string `json:"host"`
+	Upstream  string `json:"upstream"`
+	StartedAt int64  `json:"startedAt"` // Unix 毫秒
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+	State     string `json:"state"`
+}
+
+// liveConn 連線表中的一筆紀錄，可由外部強制關閉
+type liveConn struct {
+	id       int64
+	client   string
+	host     string
+	upstream string
+	start    time.Time
+
+	mu      sync.Mutex
+	kind    string
+	state   string
+	flow    *trafficFlow
+	closers []func()
+}
+
+// 更新連線狀態 (已要求關閉者不再變更)
+func (c *liveConn) setState(state string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != connStateClosing {
+		c.state = state
+	}
+}
+
+func (c *liveConn) setKind(kind string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.kind = kind
+}
+
+func (c *liveConn) attach(flow *trafficFlow) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flow = flow
+}
+
+// 登記關閉連線時要執行的動作；若已被要求關閉則立即執行
+func (c *liveConn) onKill(fn func()) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if c.state == connStateClosing {
+		c.mu.Unlock()
+		fn()
+		return
+	}
+	c.closers = append(c.closers, fn)
+	c.mu.Unlock()
+}
+
+func (c *liveConn) kill() {
+	c.mu.Lock()
+	c.state = connStateClosing
+	closers := c.closers
+	c.closers = nil
+	c.mu.Unlock()
+
+	for _, fn := range closers {
+		fn()
+	}
+}
+
+func (c *liveConn) info() ConnectionInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := ConnectionInfo{
+		ID:        c.id,
+		Kind:      c.kind,
+		Client:    c.client,
+		Host:      c.host,
+		Upstream:  c.upstream,
+		StartedAt: c.start.UnixMilli(),
+		State:     c.state,
+	}
+	if c.flow != nil {
+		info.Up = c.flow.up.Load()
+		info.Down = c.flow.down.Load()
+	}
+	return info
+}
+
+type connRegistry struct {
+	mu     sync.Mutex
+	nextID int64
+	conns  map[int64]*liveConn
+}
+
+// 登記新連線，結束時需呼叫 remove
+func (r *connRegistry) add(kind, client, target string, p *Proxy) *liveConn {
+	host, _ := splitTarget(target, 0)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns == nil {
+		r.conns = make(map[int64]*liveConn)
+	}
+	r.nextID++
+	c := &liveConn{
+		id:       r.nextID,
+		kind:     kind,
+		client:   client,
+		host:     host,
+		upstream: transportLabel(p),
+		start:    time.Now(),
+		state:    connStateConnecting,
+	}
+	r.conns[c.id] = c
+	return c
+}
+
+func (r *connRegistry) remove(c *liveConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, c.id)
+}
+
+// 關閉符合條件的連線，回傳關閉的數量
+func (r *connRegistry) killMatching(match func(*liveConn) bool) int {
+	r.mu.Lock()
+	var targets []*liveConn
+	for _, c := range r.conns {
+		if match(c) {
+			targets = append(targets, c)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, c := range targets {
+		c.kill()
+	}
+	return len(targets)
+}
+
+func (r *connRegistry) list() []ConnectionInfo {
+	r.mu.Lock()
+	conns := make([]*liveConn, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.Unlock()
+
+	result := make([]ConnectionInfo, 0, len(conns))
+	for _, c := range conns {
+		result = append(result, c.info())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// 關閉所有連線 (含已接管的通道，Shutdown 不會處理這些連線)
+func (a *App) closeAllConnections() int {
+	return a.conns.killMatching(func(*liveConn) bool { return true })
+}
+
+// 18. 取得目前所有連線
+func (a *App) GetConnections() []ConnectionInfo {
+	return a.conns.list()
+}
+
+// 18-1. 關閉單一連線
+func (a *App) CloseConnection(id int64) string {
+	n := a.conns.killMatching(func(c *liveConn) bool { return c.id == id })
+	if n == 0 {
+		return "not_found"
+	}
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Connection #%d closed by user", id))
+	}
+	return "Success"
+}
+
+// 18-2. 關閉所有連到指定主機的連線，回傳關閉的數量
+func (a *App) CloseHostConnections(host string) int {
+	host, _ = splitTarget(host, 0)
+	return a.conns.killMatching(func(c *liveConn) bool { return c.host == host })
+}
+
+// 18-3. 關閉所有連線
+func (a *App) CloseAllConnections() int {
+	return a.closeAllConnections()
+}
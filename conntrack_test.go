@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConnRegistry(t *testing.T) {
+	var r connRegistry
+	upstream := &Proxy{IP: "10.0.0.1", Port: "8080"}
+	a := r.add(connKindConnect, "127.0.0.1", "Example.com:443", upstream)
+	b := r.add(connKindHTTP, "192.168.1.5", "other.net", nil)
+
+	list := r.list()
+	want := []ConnectionInfo{
+		{ID: 1, Kind: connKindConnect, Client: "127.0.0.1", Host: "example.com", Upstream: "http://10.0.0.1:8080", State: connStateConnecting},
+		{ID: 2, Kind: connKindHTTP, Client: "192.168.1.5", Host: "other.net", Upstream: "DIRECT", State: connStateConnecting},
+	}
+	for i := range list {
+		list[i].StartedAt = 0
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("list() = %+v, want %+v", list, want)
+	}
+
+	var ts trafficStats
+	flow := ts.begin("example.com", "DIRECT")
+	flow.addUp(7)
+	flow.addDown(9)
+	a.attach(flow)
+	a.setKind(connKindUpgrade)
+	a.setState(connStateEstablished)
+	if info := a.info(); info.Up != 7 || info.Down != 9 || info.Kind != connKindUpgrade || info.State != connStateEstablished {
+		t.Errorf("info() = %+v", info)
+	}
+
+	r.remove(b)
+	if list := r.list(); len(list) != 1 || list[0].ID != 1 {
+		t.Errorf("list() after remove = %+v", list)
+	}
+}
+
+func TestLiveConnKill(t *testing.T) {
+	var r connRegistry
+	c := r.add(connKindConnect, "127.0.0.1", "example.com:443", nil)
+
+	closed := 0
+	c.onKill(func() { closed++ })
+	c.onKill(func() { closed++ })
+	c.kill()
+	if closed != 2 {
+		t.Fatalf("closers run %d times, want 2", closed)
+	}
+	// 已關閉後不再改變狀態，之後登記的動作立即執行
+	c.setState(connStateEstablished)
+	if got := c.info().State; got != connStateClosing {
+		t.Errorf("state = %q, want closing", got)
+	}
+	c.onKill(func() { closed++ })
+	if closed != 3 {
+		t.Errorf("late closer not run immediately")
+	}
+	c.kill()
+	if closed != 3 {
+		t.Errorf("closers run again on second kill")
+	}
+}
+
+func TestLiveConnNil(t *testing.T) {
+	var c *liveConn
+	c.setState(connStateEstablished)
+	c.setKind(connKindHTTP)
+	c.attach(nil)
+	c.onKill(func() {})
+}
+
+func TestCloseConnections(t *testing.T) {
+	tests := []struct {
+		name      string
+		kill      func(a *App) int
+		wantKills []bool
+	}{
+		{name: "by id", kill: func(a *App) int {
+			if a.CloseConnection(2) != "Success" {
+				return 0
+			}
+			return 1
+		}, wantKills: []bool{false, true, false}},
+		{name: "by host", kill: func(a *App) int { return a.CloseHostConnections("A.com:443") }, wantKills: []bool{true, false, true}},
+		{name: "by bare host", kill: func(a *App) int { return a.CloseHostConnections("a.com") }, wantKills: []bool{true, false, true}},
+		{name: "all", kill: func(a *App) int { return a.CloseAllConnections() }, wantKills: []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{}
+			targets := []string{"a.com:443", "b.com:443", "a.com:80"}
+			killed := make([]bool, len(targets))
+			for i, target := range targets {
+				i := i
+				a.conns.add(connKindConnect, "127.0.0.1", target, nil).onKill(func() { killed[i] = true })
+			}
+
+			want := 0
+			for _, k := range tt.wantKills {
+				if k {
+					want++
+				}
+			}
+			if n := tt.kill(a); n != want {
+				t.Errorf("closed %d connections, want %d", n, want)
+			}
+			if !reflect.DeepEqual(killed, tt.wantKills) {
+				t.Errorf("killed = %v, want %v", killed, tt.wantKills)
+			}
+		})
+	}
+
+	if got := (&App{}).CloseConnection(42); got != "not_found" {
+		t.Errorf("CloseConnection(unknown) = %q, want not_found", got)
+	}
+}
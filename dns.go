@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ---------------- DNS 解析策略 (防止 DNS 洩漏) ----------------
+
+// 解析模式
+const (
+	dnsModeSystem = "system" // 本機解析 (直連與 SOCKS4 會向系統 DNS 查詢)
+	dnsModeRemote = "remote" // 主機名稱交給上游解析 (socks5h / 以主機名稱 CONNECT)
+	dnsModeDoH    = "doh"    // 經由目前代理以 DNS-over-HTTPS 解析後再連線
+)
+
+const (
+	// 預設使用 IP 位址，避免解析 DoH 伺服器本身時洩漏
+	defaultDoHURL  = "https://1.1.1.1/dns-query"
+	dohTimeout     = 10 * time.Second
+	dnsMinCacheTTL = 30 * time.Second
+	dnsMaxCacheTTL = 10 * time.Minute
+)
+
+// DNSPolicy 目標主機名稱的解析方式
+// remote 模式下無法交給上游的情況 (DIRECT 規則直連、SOCKS4) 改以 DoH 解析
+// HTTP 代理一律以主機名稱轉交 (由代理解析)；代理伺服器本身的位址仍由本機解析
+type DNSPolicy struct {
+	Mode   string `json:"mode"`
+	DoHURL string `json:"dohUrl"`
+}
+
+type dnsCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+type dnsState struct {
+	mu      sync.Mutex
+	policy  DNSPolicy
+	cache   map[string]dnsCacheEntry
+	clients map[string]*http.Client // 依 DoH 經過的代理區分
+}
+
+// 清除快取與 DoH 連線 (策略變更時)
+func (d *dnsState) reset() {
+	d.mu.Lock()
+	clients := d.clients
+	d.cache = nil
+	d.clients = nil
+	d.mu.Unlock()
+
+	for _, c := range clients {
+		c.CloseIdleConnections()
+	}
+}
+
+// dnsResolver 撥號時依策略決定目標位址；nil 表示使用系統解析
+type dnsResolver struct {
+	mode   string
+	lookup func(ctx context.Context, host string) ([]net.IP, error)
+}
+
+// 直連時的撥號位址 (remote / doh 模式改以 DoH 解析)
+func (r *dnsResolver) direct(ctx context.Context, target string) (string, error) {
+	if r == nil {
+		return target, nil
+	}
+	return r.resolveTarget(ctx, target, false)
+}
+
+// 要求代理 hop 連到 target 時使用的位址
+// SOCKS4 只接受 IPv4，無論哪種模式都需先解析；doh 模式一律先解析
+func (r *dnsResolver) forHop(ctx context.Context, hop *Proxy, target string) (string, error) {
+	if r == nil {
+		return target, nil
+	}
+	socks4 := strings.EqualFold(hop.Protocol, "socks4")
+	if r.mode == dnsModeDoH || socks4 {
+		return r.resolveTarget(ctx, target, socks4)
+	}
+	return target, nil
+}
+
+func (r *dnsResolver) resolveTarget(ctx context.Context, target string, ipv4Only bool) (string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return target, nil
+	}
+	ips, err := r.lookup(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !ipv4Only || ip.To4() != nil {
+			return net.JoinHostPort(ip.String(), port), nil
+		}
+	}
+	return "", fmt.Errorf("resolve %s: no usable address", host)
+}
+
+// 依目前策略建立解析器，via 依查詢的主機回傳 DoH 要經過的代理 (nil 表示直連 DoH 伺服器)
+func (a *App) dnsResolverFor(via func(host string) *Proxy) *dnsResolver {
+	a.dns.mu.Lock()
+	mode := a.dns.policy.Mode
+	a.dns.mu.Unlock()
+	if mode == "" || mode == dnsModeSystem {
+		return nil
+	}
+	return &dnsResolver{
+		mode: mode,
+		lookup: func(ctx context.Context, host string) ([]net.IP, error) {
+			return a.dohLookup(ctx, host, via(host))
+		},
+	}
+}
+
+// DIRECT 規則使用的解析器，DoH 經過目前啟用的代理 (策略組模式為該組目前選用的節點)
+func (a *App) directResolver() *dnsResolver {
+	return a.dnsResolverFor(a.pickUpstream)
+}
+
+// 經過指定節點的解析器 (節點檢測與代理路徑)
+func (a *App) proxyResolver(p *Proxy) *dnsResolver {
+	return a.dnsResolverFor(func(string) *Proxy { return p })
+}
+
+// 依分流結果選擇解析器: nil 為 DIRECT 規則直連
+func (a *App) routeResolver(p *Proxy) *dnsResolver {
+	if p == nil {
+		return a.directResolver()
+	}
+	return a.proxyResolver(p)
+}
+
+// 取得經過 via 的 DoH client
+// 此 client 不套用 DNS 策略 (DoH 伺服器名稱交給代理解析)，避免遞迴查詢
+func (a *App) dohClient(via *Proxy) *http.Client {
+	key := transportKey(via)
+
+	a.dns.mu.Lock()
+	defer a.dns.mu.Unlock()
+	if c := a.dns.clients[key]; c != nil {
+		return c
+	}
+
+	var transport *http.Transport
+	if via == nil {
+		transport = &http.Transport{
+			DialContext: (&net.Dialer{Timeout: dohTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		}
+	} else {
+		transport = upstreamTransport(via, dohTimeout, nil)
+	}
+	transport.TLSClientConfig = a.upstreamTLSConfig()
+	transport.IdleConnTimeout = 90 * time.Second
+
+	c := &http.Client{Transport: transport, Timeout: dohTimeout}
+	if a.dns.clients == nil {
+		a.dns.clients = make(map[string]*http.Client)
+	}
+	a.dns.clients[key] = c
+	return c
+}
+
+// 以 DoH (RFC 8484) 查詢主機的 A / AAAA 紀錄，結果依 TTL 快取
+func (a *App) dohLookup(ctx context.Context, host string, via *Proxy) ([]net.IP, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	a.dns.mu.Lock()
+	if e, ok := a.dns.cache[host]; ok && time.Now().Before(e.expires) {
+		a.dns.mu.Unlock()
+		return e.ips, nil
+	}
+	endpoint := a.dns.policy.DoHURL
+	a.dns.mu.Unlock()
+	if endpoint == "" {
+		endpoint = defaultDoHURL
+	}
+
+	client := a.dohClient(via)
+	var ips []net.IP
+	ttl := dnsMaxCacheTTL
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, recordTTL, err := dohQuery(ctx, client, endpoint, host, qtype)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, found...)
+		if len(found) > 0 && recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no such host")
+	}
+	if ttl < dnsMinCacheTTL {
+		ttl = dnsMinCacheTTL
+	}
+
+	a.dns.mu.Lock()
+	if a.dns.cache == nil {
+		a.dns.cache = make(map[string]dnsCacheEntry)
+	}
+	a.dns.cache[host] = dnsCacheEntry{ips: ips, expires: time.Now().Add(ttl)}
+	a.dns.mu.Unlock()
+	return ips, nil
+}
+
+// 送出單一 DoH 查詢，回傳位址與最小 TTL
+func dohQuery(ctx context.Context, client *http.Client, endpoint, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(body); err != nil {
+		return nil, 0, fmt.Errorf("invalid DoH response: %v", err)
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess && reply.RCode != dnsmessage.RCodeNameError {
+		return nil, 0, fmt.Errorf("DoH query failed: %v", reply.RCode)
+	}
+
+	var ips []net.IP
+	ttl := dnsMaxCacheTTL
+	for _, ans := range reply.Answers {
+		switch body := ans.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		default:
+			continue
+		}
+		if t := time.Duration(ans.Header.TTL) * time.Second; t < ttl {
+			ttl = t
+		}
+	}
+	return ips, ttl, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return strings.EqualFold(host, "localhost")
+}
+
+// 22. 設定 DNS 解析策略
+func (a *App) SetDNSPolicy(policy DNSPolicy) string {
+	switch policy.Mode {
+	case "":
+		policy.Mode = dnsModeSystem
+	case dnsModeSystem, dnsModeRemote, dnsModeDoH:
+	default:
+		return fmt.Sprintf("invalid_policy: unknown mode %q", policy.Mode)
+	}
+	if policy.DoHURL != "" {
+		u, err := url.Parse(policy.DoHURL)
+		// 僅本機測試服務 (例如洩漏測試) 可使用 http
+		if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && isLoopbackHost(u.Hostname()))) {
+			return "invalid_policy: DoH URL must be https://"
+		}
+	}
+
+	a.dns.reset()
+	a.dns.mu.Lock()
+	a.dns.policy = policy
+	a.dns.mu.Unlock()
+
+	// 已建立的 Transport 以舊策略撥號，需重建
+	a.transports.closeAll()
+	return "Success"
+}
+
+// 22-1. 取得目前的 DNS 解析策略
+func (a *App) GetDNSPolicy() DNSPolicy {
+	a.dns.mu.Lock()
+	defer a.dns.mu.Unlock()
+	policy := a.dns.policy
+	if policy.Mode == "" {
+		policy.Mode = dnsModeSystem
+	}
+	if policy.DoHURL == "" {
+		policy.DoHURL = defaultDoHURL
+	}
+	return policy
+}
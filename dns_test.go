@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// 固定回應的解析器
+func fakeResolver(mode string, records map[string][]net.IP) *dnsResolver {
+	return &dnsResolver{
+		mode: mode,
+		lookup: func(ctx context.Context, host string) ([]net.IP, error) {
+			if ips, ok := records[host]; ok {
+				return ips, nil
+			}
+			return nil, errors.New("no such host")
+		},
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	records := map[string][]net.IP{
+		"example.com": {net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")},
+		"v6.test":     {net.ParseIP("2001:db8::2")},
+	}
+	httpHop := &Proxy{Protocol: "http"}
+	socks5 := &Proxy{Protocol: "socks5"}
+	socks4 := &Proxy{Protocol: "SOCKS4"}
+
+	tests := []struct {
+		name    string
+		r       *dnsResolver
+		hop     *Proxy // nil 表示直連
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{name: "system direct", r: nil, target: "example.com:443", want: "example.com:443"},
+		{name: "system hop", r: nil, hop: socks4, target: "example.com:443", want: "example.com:443"},
+		{name: "remote direct uses doh", r: fakeResolver(dnsModeRemote, records), target: "example.com:443", want: "[2001:db8::1]:443"},
+		{name: "remote http hop keeps name", r: fakeResolver(dnsModeRemote, records), hop: httpHop, target: "example.com:443", want: "example.com:443"},
+		{name: "remote socks5 hop keeps name", r: fakeResolver(dnsModeRemote, records), hop: socks5, target: "example.com:443", want: "example.com:443"},
+		{name: "remote socks4 hop resolves ipv4", r: fakeResolver(dnsModeRemote, records), hop: socks4, target: "example.com:443", want: "192.0.2.1:443"},
+		{name: "doh socks5 hop resolves", r: fakeResolver(dnsModeDoH, records), hop: socks5, target: "example.com:443", want: "[2001:db8::1]:443"},
+		{name: "doh http hop resolves", r: fakeResolver(dnsModeDoH, records), hop: httpHop, target: "example.com:80", want: "[2001:db8::1]:80"},
+		{name: "ip literal untouched", r: fakeResolver(dnsModeDoH, records), hop: socks5, target: "10.0.0.1:22", want: "10.0.0.1:22"},
+		{name: "socks4 without ipv4", r: fakeResolver(dnsModeRemote, records), hop: socks4, target: "v6.test:443", wantErr: true},
+		{name: "lookup failure", r: fakeResolver(dnsModeDoH, records), target: "missing.test:443", wantErr: true},
+		{name: "missing port", r: fakeResolver(dnsModeDoH, records), target: "example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			var err error
+			if tt.hop == nil {
+				got, err = tt.r.direct(context.Background(), tt.target)
+			} else {
+				got, err = tt.r.forHop(context.Background(), tt.hop, tt.target)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// 記錄收到的 CONNECT 目標；目標主機 echo.test 會被導向 echoAddr
+func startRecordingConnectProxy(t *testing.T, echoAddr string) (string, <-chan string) {
+	targets := make(chan string, 8)
+	_, echoPort, _ := net.SplitHostPort(echoAddr)
+	addr := startTestServer(t, func(c net.Conn) {
+		br := bufio.NewReader(c)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		targets <- req.Host
+		dial := req.Host
+		if host, port, _ := net.SplitHostPort(req.Host); host == "echo.test" && port == echoPort {
+			dial = echoAddr
+		}
+		up, err := net.DialTimeout("tcp", dial, 2*time.Second)
+		if err != nil {
+			io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			return
+		}
+		defer up.Close()
+		io.WriteString(c, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		go io.Copy(up, br)
+		io.Copy(c, up)
+	})
+	return addr, targets
+}
+
+func TestDialChainDNSPolicy(t *testing.T) {
+	echo := startEchoServer(t)
+	_, echoPort, _ := net.SplitHostPort(echo)
+	records := map[string][]net.IP{"echo.test": {net.ParseIP("127.0.0.1")}}
+	target := net.JoinHostPort("echo.test", echoPort)
+
+	tests := []struct {
+		name       string
+		r          *dnsResolver
+		viaProxy   bool
+		wantTarget string
+	}{
+		{name: "doh direct", r: fakeResolver(dnsModeDoH, records)},
+		{name: "remote via proxy", r: fakeResolver(dnsModeRemote, records), viaProxy: true, wantTarget: target},
+		{name: "doh via proxy", r: fakeResolver(dnsModeDoH, records), viaProxy: true, wantTarget: echo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hops []*Proxy
+			var seen <-chan string
+			if tt.viaProxy {
+				var addr string
+				addr, seen = startRecordingConnectProxy(t, echo)
+				hops = []*Proxy{hopFor(t, addr, "http")}
+			}
+			conn, err := dialChain(context.Background(), hops, target, 5*time.Second, tt.r)
+			if err != nil {
+				t.Fatalf("dialChain() error: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			io.WriteString(conn, "ping")
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+				t.Fatalf("echo = %q, %v", buf, err)
+			}
+			if seen != nil {
+				if got := <-seen; got != tt.wantTarget {
+					t.Errorf("proxy asked to connect to %q, want %q", got, tt.wantTarget)
+				}
+			}
+		})
+	}
+
+	// 解析失敗時不可退回系統 DNS
+	_, err := dialChain(context.Background(), nil, "unknown.test:80", time.Second, fakeResolver(dnsModeDoH, records))
+	if err == nil || !strings.Contains(err.Error(), "resolve unknown.test") {
+		t.Errorf("dialChain(unknown) error = %v, want resolve error", err)
+	}
+}
+
+// 簡易 DoH 伺服器，只回應 A 紀錄
+func startDoHServer(t *testing.T, records map[string]dnsmessage.AResource, ttl uint32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var queries atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var q dnsmessage.Message
+		if r.Header.Get("Content-Type") != "application/dns-message" || q.Unpack(body) != nil || len(q.Questions) != 1 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		queries.Add(1)
+		question := q.Questions[0]
+		reply := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Response: true, RCode: dnsmessage.RCodeSuccess},
+			Questions: q.Questions,
+		}
+		rec, ok := records[strings.TrimSuffix(question.Name.String(), ".")]
+		switch {
+		case !ok:
+			reply.RCode = dnsmessage.RCodeNameError
+		case question.Type == dnsmessage.TypeA:
+			reply.Answers = append(reply.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &rec,
+			})
+		}
+		packed, _ := reply.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &queries
+}
+
+// 信任測試伺服器憑證並以其作為 DoH 端點
+func newDoHTestApp(t *testing.T, srv *httptest.Server) *App {
+	t.Helper()
+	a := &App{}
+	if got := a.SetTLSPolicy(TLSPolicy{Mode: tlsModeCustomCA, CAFile: writeServerCA(t, srv)}); got != "Success" {
+		t.Fatal(got)
+	}
+	if got := a.SetDNSPolicy(DNSPolicy{Mode: dnsModeDoH, DoHURL: srv.URL + "/dns-query"}); got != "Success" {
+		t.Fatal(got)
+	}
+	return a
+}
+
+func TestDoHLookup(t *testing.T) {
+	srv, queries := startDoHServer(t, map[string]dnsmessage.AResource{
+		"example.com": {A: [4]byte{192, 0, 2, 1}},
+	}, 5)
+	a := newDoHTestApp(t, srv)
+	ctx := context.Background()
+
+	ips, err := a.dohLookup(ctx, "example.com", nil)
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("dohLookup() = %v, %v", ips, err)
+	}
+	// A 與 AAAA 各一次
+	if n := queries.Load(); n != 2 {
+		t.Errorf("queries = %d, want 2", n)
+	}
+
+	// 名稱正規化後命中快取
+	if _, err := a.dohLookup(ctx, "EXAMPLE.com.", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("queries after cached lookup = %d, want 2", n)
+	}
+
+	// TTL 低於下限時以下限快取
+	a.dns.mu.Lock()
+	entry := a.dns.cache["example.com"]
+	a.dns.mu.Unlock()
+	if remaining := time.Until(entry.expires); remaining < dnsMinCacheTTL-time.Second || remaining > dnsMinCacheTTL {
+		t.Errorf("cache expires in %v, want about %v", remaining, dnsMinCacheTTL)
+	}
+
+	// 過期後重新查詢
+	a.dns.mu.Lock()
+	a.dns.cache["example.com"] = dnsCacheEntry{ips: ips, expires: time.Now().Add(-time.Second)}
+	a.dns.mu.Unlock()
+	a.dohLookup(ctx, "example.com", nil)
+	if n := queries.Load(); n != 4 {
+		t.Errorf("queries after expiry = %d, want 4", n)
+	}
+
+	if _, err := a.dohLookup(ctx, "missing.test", nil); err == nil || err.Error() != "no such host" {
+		t.Errorf("dohLookup(missing) error = %v, want no such host", err)
+	}
+
+	// 策略變更時清除快取
+	a.SetDNSPolicy(DNSPolicy{Mode: dnsModeDoH, DoHURL: srv.URL + "/dns-query"})
+	a.dohLookup(ctx, "example.com", nil)
+	if n := queries.Load(); n != 8 {
+		t.Errorf("queries after policy change = %d, want 8", n)
+	}
+}
+
+func TestDoHLookupErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{name: "http error", handler: func(w http.ResponseWriter, r *http.Request) { http.Error(w, "down", http.StatusServiceUnavailable) }, wantErr: "503"},
+		{name: "garbage", handler: func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "garbage") }, wantErr: "invalid DoH response"},
+		{name: "servfail", handler: func(w http.ResponseWriter, r *http.Request) {
+			packed, _ := (&dnsmessage.Message{Header: dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeServerFailure}}).Pack()
+			w.Write(packed)
+		}, wantErr: "DoH query failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(tt.handler)
+			defer srv.Close()
+			a := newDoHTestApp(t, srv)
+			_, err := a.dohLookup(context.Background(), "example.com", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("dohLookup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 未信任 DoH 伺服器憑證時查詢失敗
+	srv, _ := startDoHServer(t, nil, 60)
+	a := &App{}
+	a.SetDNSPolicy(DNSPolicy{Mode: dnsModeDoH, DoHURL: srv.URL})
+	if _, err := a.dohLookup(context.Background(), "example.com", nil); !isTLSVerifyError(err) {
+		t.Errorf("dohLookup() with untrusted server error = %v, want TLS verification error", err)
+	}
+}
+
+func TestSetDNSPolicy(t *testing.T) {
+	tests := []struct {
+		policy   DNSPolicy
+		want     string
+		wantMode string
+	}{
+		{policy: DNSPolicy{}, want: "Success", wantMode: dnsModeSystem},
+		{policy: DNSPolicy{Mode: dnsModeRemote}, want: "Success", wantMode: dnsModeRemote},
+		{policy: DNSPolicy{Mode: dnsModeDoH, DoHURL: "https://dns.example/dns-query"}, want: "Success", wantMode: dnsModeDoH},
+		{policy: DNSPolicy{Mode: "udp"}, want: `invalid_policy: unknown mode "udp"`, wantMode: dnsModeSystem},
+		{policy: DNSPolicy{Mode: dnsModeDoH, DoHURL: "http://dns.example/dns-query"}, want: "invalid_policy: DoH URL must be https://", wantMode: dnsModeSystem},
+		{policy: DNSPolicy{Mode: dnsModeDoH, DoHURL: "https:///dns-query"}, want: "invalid_policy: DoH URL must be https://", wantMode: dnsModeSystem},
+		{policy: DNSPolicy{Mode: dnsModeDoH, DoHURL: "http://127.0.0.1:8053/dns-query"}, want: "Success", wantMode: dnsModeDoH},
+		{policy: DNSPolicy{Mode: dnsModeDoH, DoHURL: "http://localhost:8053/dns-query"}, want: "Success", wantMode: dnsModeDoH},
+	}
+	for _, tt := range tests {
+		a := &App{}
+		if got := a.SetDNSPolicy(tt.policy); got != tt.want {
+			t.Errorf("SetDNSPolicy(%+v) = %q, want %q", tt.policy, got, tt.want)
+		}
+		got := a.GetDNSPolicy()
+		if got.Mode != tt.wantMode {
+			t.Errorf("SetDNSPolicy(%+v): mode = %q, want %q", tt.policy, got.Mode, tt.wantMode)
+		}
+		if got.DoHURL == "" {
+			t.Errorf("GetDNSPolicy() DoHURL empty, want default")
+		}
+		if r := a.routeResolver(nil); (r == nil) != (got.Mode == dnsModeSystem) {
+			t.Errorf("routeResolver() = %v for mode %q", r, got.Mode)
+		}
+	}
+}
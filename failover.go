@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- 自動故障切換 (Failover) ----------------
+
+const defaultFailoverThreshold = 3
+
+// 依延遲排序備援節點：已測得延遲者在前 (由低到高)，未測者維持原順序置後
+func rankStandby(list []Proxy) []Proxy {
+	ranked := append([]Proxy(nil), list...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		li, lj := ranked[i].Latency, ranked[j].Latency
+		if li <= 0 || lj <= 0 {
+			return li > 0 && lj <= 0
+		}
+		return li < lj
+	})
+	return ranked
+}
+
+// 11. 設定備援節點清單 (連續失敗時由後端自動切換)
+func (a *App) SetStandbyProxies(list []Proxy) {
+	ranked := rankStandby(list)
+	for i := range ranked {
+		a.applyProxyChain(&ranked[i])
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.standby = ranked
+}
+
+// 11-1. 取得目前的備援節點清單 (已排序)
+func (a *App) GetStandbyProxies() []Proxy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Proxy{}, a.standby...)
+}
+
+// 11-2. 設定觸發切換的連續失敗次數
+func (a *App) SetFailoverThreshold(n int) {
+	if n <= 0 {
+		n = defaultFailoverThreshold
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failoverThreshold = n
+}
+
+// 記錄單一節點模式下的轉發結果，連續失敗達門檻時觸發切換
+// 回傳 false 表示沒有可用的備援節點，需交由前端處理
+func (a *App) recordUpstreamResult(p *Proxy, ok bool) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// 只計算目前使用中節點的結果，切換前已送出的請求不列入
+	if a.activeRemote == nil || proxyKey(a.activeRemote) != proxyKey(p) {
+		return true
+	}
+	if ok {
+		a.failCount = 0
+		return true
+	}
+	// 未設定備援節點時維持原行為，每次失敗都通知前端
+	if len(a.standby) == 0 && !a.failoverRunning {
+		return false
+	}
+
+	a.failCount++
+	threshold := a.failoverThreshold
+	if threshold <= 0 {
+		threshold = defaultFailoverThreshold
+	}
+	if a.failCount < threshold || a.failoverRunning {
+		return true
+	}
+
+	a.failoverRunning = true
+	reason := fmt.Sprintf("%d consecutive upstream failures", a.failCount)
+	go a.failover(proxyKey(a.activeRemote), reason)
+	return true
+}
+
+// 依序預檢備援節點，找到可用者即原地替換 activeRemote (不變更系統代理)
+// failed 為觸發切換的節點；期間使用者已手動換線時即中止，不覆蓋新的選擇
+func (a *App) failover(failed, reason string) {
+	defer func() {
+		a.mu.Lock()
+		a.failoverRunning = false
+		a.mu.Unlock()
+	}()
+
+	for {
+		a.mu.Lock()
+		if a.activeRemote == nil || proxyKey(a.activeRemote) != failed {
+			a.mu.Unlock()
+			return
+		}
+		if len(a.standby) == 0 {
+			a.mu.Unlock()
+			break
+		}
+		candidate := a.standby[0]
+		a.standby = a.standby[1:]
+		a.mu.Unlock()
+
+		check := a.checkProxy(&candidate)
+		if !check.Success {
+			if a.ctx != nil {
+				wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("Standby proxy %s failed pre-check, skipped", proxyKey(&candidate)))
+			}
+			continue
+		}
+		candidate.Latency = check.Latency
+		candidate.Country = check.Country
+
+		a.mu.Lock()
+		old := a.activeRemote
+		if old == nil || proxyKey(old) != failed {
+			// 期間已斷開連線或已手動換線
+			a.mu.Unlock()
+			return
+		}
+		a.activeRemote = &candidate
+		a.failCount = 0
+		a.mu.Unlock()
+
+		a.transports.invalidate(old)
+
+		if a.ctx != nil {
+			wailsRuntime.LogWarning(a.ctx, fmt.Sprintf("Failover: %s -> %s (%s)", proxyKey(old), proxyKey(&candidate), reason))
+			wailsRuntime.EventsEmit(a.ctx, "proxy_switched", map[string]interface{}{
+				"old":    old,
+				"new":    candidate,
+				"reason": reason,
+			})
+		}
+		return
+	}
+
+	// 備援節點用盡，交由前端換線
+	a.mu.RLock()
+	remote := a.activeRemote
+	a.mu.RUnlock()
+	if remote != nil && proxyKey(remote) == failed && a.ctx != nil {
+		wailsRuntime.LogWarning(a.ctx, "Failover: no standby proxy available")
+		wailsRuntime.EventsEmit(a.ctx, "proxy_need_rotate", remote.IP)
+	}
+}
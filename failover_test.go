@@ -0,0 +1,206 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRankStandby(t *testing.T) {
+	p := func(ip string, latency int64) Proxy { return Proxy{IP: ip, Port: "1", Latency: latency} }
+	tests := []struct {
+		name string
+		in   []Proxy
+		want []string
+	}{
+		{name: "empty", in: nil, want: nil},
+		{name: "by latency", in: []Proxy{p("a", 300), p("b", 100), p("c", 200)}, want: []string{"b", "c", "a"}},
+		{name: "untested last", in: []Proxy{p("a", 0), p("b", 200), p("c", -1), p("d", 100)}, want: []string{"d", "b", "a", "c"}},
+		{name: "untested keep order", in: []Proxy{p("a", 0), p("b", 0), p("c", 0)}, want: []string{"a", "b", "c"}},
+		{name: "equal latency stable", in: []Proxy{p("a", 100), p("b", 100), p("c", 50)}, want: []string{"c", "a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]Proxy(nil), tt.in...)
+			var got []string
+			for _, r := range rankStandby(tt.in) {
+				got = append(got, r.IP)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankStandby() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(in, tt.in) {
+				t.Error("rankStandby() modified its input")
+			}
+		})
+	}
+}
+
+func TestRecordUpstreamResult(t *testing.T) {
+	active := &Proxy{IP: "10.0.0.1", Port: "1080"}
+	other := &Proxy{IP: "10.0.0.2", Port: "1080"}
+	standby := []Proxy{{IP: "10.0.0.3", Port: "1080"}}
+
+	type step struct {
+		p  *Proxy
+		ok bool
+	}
+	tests := []struct {
+		name        string
+		threshold   int
+		standby     []Proxy
+		steps       []step
+		want        bool
+		wantCount   int
+		wantFailing bool
+	}{
+		{name: "success resets", standby: standby, steps: []step{{active, false}, {active, false}, {active, true}}, want: true, wantCount: 0},
+		{name: "below threshold", standby: standby, steps: []step{{active, false}, {active, false}}, want: true, wantCount: 2},
+		{name: "interrupted failures", standby: standby, steps: []step{{active, false}, {active, false}, {active, true}, {active, false}, {active, false}}, want: true, wantCount: 2},
+		{name: "threshold reached", standby: standby, steps: []step{{active, false}, {active, false}, {active, false}}, want: true, wantCount: 3, wantFailing: true},
+		{name: "custom threshold", threshold: 1, standby: standby, steps: []step{{active, false}}, want: true, wantCount: 1, wantFailing: true},
+		{name: "other node ignored", standby: standby, steps: []step{{other, false}, {other, false}, {other, false}}, want: true, wantCount: 0},
+		{name: "no standby notifies", steps: []step{{active, false}}, want: false, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{
+				activeRemote:      active,
+				standby:           append([]Proxy(nil), tt.standby...),
+				failoverThreshold: tt.threshold,
+			}
+			var got bool
+			for _, s := range tt.steps {
+				got = a.recordUpstreamResult(s.p, s.ok)
+			}
+
+			a.mu.Lock()
+			count, running := a.failCount, a.failoverRunning
+			a.mu.Unlock()
+			if got != tt.want {
+				t.Errorf("recordUpstreamResult() = %v, want %v", got, tt.want)
+			}
+			if count != tt.wantCount {
+				t.Errorf("failCount = %d, want %d", count, tt.wantCount)
+			}
+			if tt.wantFailing && !running {
+				// 切換可能已迅速結束，改以備援清單是否被消耗判斷
+				a.mu.Lock()
+				consumed := len(a.standby) < len(tt.standby)
+				a.mu.Unlock()
+				if !consumed {
+					t.Error("failover was not started")
+				}
+			}
+			waitFailover(t, a)
+		})
+	}
+}
+
+// 備援節點皆無法使用時，切換流程應消耗清單並保留原節點
+func TestFailoverSkipsDeadStandby(t *testing.T) {
+	host, port, _ := net.SplitHostPort(closedAddr(t))
+
+	active := &Proxy{IP: "10.0.0.1", Port: "1080", Protocol: "http"}
+	a := &App{
+		activeRemote:    active,
+		standby:         []Proxy{{IP: host, Port: port, Protocol: "http"}, {IP: host, Port: port, Protocol: "socks5"}},
+		failoverRunning: true,
+	}
+	a.failover(proxyKey(active), "test")
+
+	if a.activeRemote != active {
+		t.Errorf("activeRemote = %v, want unchanged", a.activeRemote)
+	}
+	if len(a.standby) != 0 {
+		t.Errorf("standby = %v, want consumed", a.standby)
+	}
+	if a.failoverRunning {
+		t.Error("failoverRunning not cleared")
+	}
+}
+
+// 切換開始前使用者已手動換線時，不可再消耗備援清單或覆蓋新節點
+func TestFailoverAbortsAfterManualSwitch(t *testing.T) {
+	failed := &Proxy{IP: "10.0.0.1", Port: "1080", Protocol: "http"}
+	chosen := &Proxy{IP: "10.0.0.2", Port: "1080", Protocol: "http"}
+	standby := []Proxy{{IP: "10.0.0.3", Port: "1080", Protocol: "http"}}
+	a := &App{activeRemote: chosen, standby: append([]Proxy{}, standby...), failoverRunning: true}
+	a.failover(proxyKey(failed), "test")
+
+	if a.activeRemote != chosen {
+		t.Errorf("activeRemote = %v, want the manually chosen node", a.activeRemote)
+	}
+	if !reflect.DeepEqual(a.standby, standby) {
+		t.Errorf("standby = %v, want untouched", a.standby)
+	}
+	if a.failoverRunning {
+		t.Error("failoverRunning not cleared")
+	}
+}
+
+func waitFailover(t *testing.T, a *App) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		a.mu.RLock()
+		running := a.failoverRunning
+		a.mu.RUnlock()
+		if !running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("failover did not finish")
+}
+
+// 轉發 HTTP 請求時，取得上游回應 (407 除外) 即重置連續失敗次數
+func TestForwardHTTPReportsUpstream(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int  // 上游代理回應的狀態碼
+		dead      bool // 代理無法連線
+		wantCount int
+	}{
+		{name: "ok", status: http.StatusOK, wantCount: 0},
+		{name: "origin error", status: http.StatusBadGateway, wantCount: 0},
+		{name: "proxy auth required", status: http.StatusProxyAuthRequired, wantCount: 2},
+		{name: "proxy unreachable", dead: true, wantCount: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := closedAddr(t)
+			if !tt.dead {
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tt.status)
+					io.WriteString(w, "body")
+				}))
+				defer srv.Close()
+				addr = srv.Listener.Addr().String()
+			}
+			remote := hopFor(t, addr, "http")
+			a := &App{
+				activeRemote:      remote,
+				standby:           []Proxy{{IP: "10.0.0.3", Port: "1080"}},
+				failoverThreshold: 10,
+				failCount:         2,
+			}
+			defer a.transports.closeAll()
+
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			w := httptest.NewRecorder()
+			a.forwardHTTP(w, r, *r.URL, "127.0.0.1", remote)
+
+			a.mu.RLock()
+			count := a.failCount
+			a.mu.RUnlock()
+			if count != tt.wantCount {
+				t.Errorf("failCount = %d, want %d (response %d)", count, tt.wantCount, w.Code)
+			}
+		})
+	}
+}
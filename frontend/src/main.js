@@ -192,6 +192,7 @@ function setupEventListeners() {
         window.runtime.EventsOn('proxies_fetched', handleProxiesFetched);
         window.runtime.EventsOn('proxy_ready', handleProxyReady);
         window.runtime.EventsOn('proxy_need_rotate', handleProxyRotate);
+        window.runtime.EventsOn('proxy_switched', handleProxySwitched);
         window.runtime.EventsOn('killswitch_triggered', handleKillSwitch);
         window.runtime.EventsOn('killswitch_enabled', handleKillSwitchEnabled);
         window.runtime.EventsOn('killswitch_disabled', handleKillSwitchDisabled);
@@ -471,7 +472,8 @@ window.setGlobal = async function(ip, port) {
     try {
         console.log(`Setting proxy: ${ip}:${port} (${protocol})`);
         showLoading('檢查節點', `正在測試 ${ip}:${port}...`);
-        const check = await window.go.main.App.CheckProxy(ip, port, protocol);
+        const node = { ...(p || { ip: ip, port: port }), protocol: protocol };
+        const check = await window.go.main.App.CheckProxyNode(node);
         hideLoading();
         
         if (!check.success) {
@@ -487,12 +489,18 @@ window.setGlobal = async function(ip, port) {
 
         currentActiveIP = ip;
         showLoading('建立連線', `設定系統代理中...`);
-        result = await window.go.main.App.SetSystemProxy(ip, port, protocol);
+        result = await window.go.main.App.SetSystemProxyNode(node);
         hideLoading();
         
         if (result === "Success") {
             if (p) p.status = 'active';
             updateDashboard(true, ip, port, p ? p.country : "UN");
+
+            // 其餘存活節點交給後端作為備援，連續失敗時自動切換
+            const standby = proxyList
+                .filter(x => x && x.status === 'active' && !(x.ip === ip && x.port === port))
+                .map(x => ({ ...x, protocol: protocol }));
+            window.go.main.App.SetStandbyProxies(standby);
             
             if (document.getElementById('checkAutoKS')?.checked) {
                 const ksToggle = document.getElementById('ksToggle');
@@ -513,6 +521,7 @@ window.setGlobal = async function(ip, port) {
         console.error('Set proxy failed:', err);
         let errorMsg = err.message;
         if (result === "precheck_failed") errorMsg = "代理預檢失敗";
+        else if (result === "auth_failed") errorMsg = "代理認證失敗";
         else if (result === "local_server_failed") errorMsg = "本地端口可能被佔用";
         else if (result === "system_proxy_failed") errorMsg = "系統代理設定失敗";
         
@@ -636,7 +645,7 @@ window.checkAllProxies = async function() {
                     setTimeout(() => reject(new Error('TIMEOUT')), CHECK_TIMEOUT)
                 );
                 
-                const checkPromise = window.go.main.App.CheckProxy(p.ip, p.port, protocol);
+                const checkPromise = window.go.main.App.CheckProxyNode({ ...p, protocol: protocol });
                 const res = await Promise.race([checkPromise, timeoutPromise]);
                 
                 const checkDuration = Date.now() - checkStartTime;
@@ -801,29 +810,15 @@ window.importFromFile = async () => {
         const content = await window.go.main.App.OpenProxyFile();
         if (!content) return;
         
-        const lines = content.split('\n');
+        // 由後端解析，支援 ip:port / user:pass@ip:port / ip:port:user:pass
+        const parsed = await window.go.main.App.ParseProxyList(content);
         let count = 0;
         const existingIPs = new Set(proxyList.map(p => `${p.ip}:${p.port}`));
         
-        lines.forEach((line, i) => {
-            line = line.trim();
-            if (!line || !line.includes(':')) return;
-            const parts = line.split(':');
-            if (parts.length >= 2) {
-                const ip = parts[0].trim();
-                const port = parts[1].trim();
-                if (!existingIPs.has(`${ip}:${port}`)) {
-                    proxyList.push({
-                        id: `FILE-${Date.now()}-${i}`,
-                        ip: ip,
-                        port: port,
-                        status: "new",
-                        latency: 0,
-                        country: "UN",
-                        source: "File"
-                    });
-                    count++;
-                }
+        (parsed || []).forEach(p => {
+            if (!existingIPs.has(`${p.ip}:${p.port}`)) {
+                proxyList.push(p);
+                count++;
             }
         });
         
@@ -1134,6 +1129,19 @@ function handleProxyRotate(ip) {
     }
 }
 
+function handleProxySwitched(data) {
+    console.log('Proxy switched by backend:', data);
+    const next = data.new || {};
+    currentActiveIP = next.ip;
+    const old = proxyList.find(p => p && data.old && p.ip === data.old.ip && p.port === data.old.port);
+    if (old) old.status = 'dead';
+    updateDashboard(true, next.ip, next.port, next.country || "UN");
+    showNotification('warning', 'notification_auto_rotated', `自動切換到 ${next.ip}:${next.port}`);
+    saveProxies();
+    renderTable();
+    updateStats();
+}
+
 function handleKillSwitch() {
     showNotification('error', 'msg_ks_activated', '⚠️ KS 已啟動 - 已斷網');
     updateDashboard(false); 
@@ -2,20 +2,150 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
+export function ApplyTransparentRules():Promise<string>;
+
 export function CheckProxy(arg1:string,arg2:string,arg3:string):Promise<main.CheckResult>;
 
+export function CheckProxyChain(arg1:Array<main.Proxy>):Promise<main.CheckResult>;
+
+export function CheckProxyNode(arg1:main.Proxy):Promise<main.CheckResult>;
+
+export function CheckProxyUDP(arg1:main.Proxy):Promise<main.CheckResult>;
+
+export function ClearCapturedRequests():Promise<void>;
+
+export function CloseAllConnections():Promise<number>;
+
+export function CloseConnection(arg1:number):Promise<string>;
+
+export function CloseHostConnections(arg1:string):Promise<number>;
+
 export function DisableSystemProxy():Promise<string>;
 
+export function ExportCACert():Promise<string>;
+
+export function ExportHAR():Promise<string>;
+
 export function FetchRealProxies(arg1:Array<string>):Promise<Array<main.Proxy>>;
 
+export function GetBandwidthStats():Promise<main.BandwidthStats>;
+
+export function GetCapturedRequests(arg1:number):Promise<Array<main.CaptureEntry>>;
+
+export function GetCertificatePin(arg1:string):Promise<string>;
+
+export function GetConnections():Promise<Array<main.ConnectionInfo>>;
+
+export function GetDNSPolicy():Promise<main.DNSPolicy>;
+
+export function GetDefaultLeakTestConfig():Promise<main.LeakTestConfig>;
+
+export function GetInspectorConfig():Promise<main.InspectorConfig>;
+
+export function GetLANStatus():Promise<main.LANStatus>;
+
+export function GetMITMStatus():Promise<main.MITMStatus>;
+
+export function GetProxyChain():Promise<Array<main.Proxy>>;
+
+export function GetProxyGroups():Promise<Array<main.ProxyGroupStatus>>;
+
+export function GetRules():Promise<Array<main.Rule>>;
+
+export function GetStandbyProxies():Promise<Array<main.Proxy>>;
+
 export function GetSystemProxyExitIP():Promise<string>;
 
+export function GetSystemProxyExitIPv6():Promise<string>;
+
+export function GetSystemProxyMode():Promise<string>;
+
+export function GetTLSPolicy():Promise<main.TLSPolicy>;
+
+export function GetTrafficStats(arg1:number):Promise<main.TrafficSnapshot>;
+
+export function GetTransparentRules():Promise<main.TransparentRules>;
+
+export function GetTransparentStatus():Promise<main.TransparentStatus>;
+
+export function GetTransportStats():Promise<Array<main.TransportStats>>;
+
+export function LoadRulesFile(arg1:string):Promise<string>;
+
 export function OpenProxyFile():Promise<string>;
 
+export function OpenRulesFile():Promise<string>;
+
+export function PACURL():Promise<string>;
+
+export function ParseProxyList(arg1:string):Promise<Array<main.Proxy>>;
+
+export function RegenerateCA():Promise<string>;
+
+export function ReloadRules():Promise<string>;
+
+export function RemoveProxyGroup(arg1:string):Promise<void>;
+
+export function RemoveTransparentRules():Promise<string>;
+
+export function ResetTrafficStats():Promise<void>;
+
+export function RunDNSLeakTest(arg1:main.LeakTestConfig):Promise<main.LeakTestResult>;
+
+export function SaveCACertFile(arg1:string):Promise<string>;
+
+export function SaveHARFile(arg1:string):Promise<string>;
+
+export function SelectGroupProxy(arg1:string,arg2:string):Promise<string>;
+
+export function SetBandwidthLimits(arg1:main.BandwidthConfig):Promise<string>;
+
+export function SetDNSPolicy(arg1:main.DNSPolicy):Promise<string>;
+
+export function SetFailoverThreshold(arg1:number):Promise<void>;
+
+export function SetIPv6Loopback(arg1:boolean):Promise<string>;
+
+export function SetInspector(arg1:main.InspectorConfig):Promise<void>;
+
+export function SetLANSharing(arg1:main.LANConfig):Promise<string>;
+
 export function SetLocalPort(arg1:string):Promise<void>;
 
+export function SetMITM(arg1:main.MITMConfig):Promise<string>;
+
+export function SetProxyChain(arg1:Array<main.Proxy>):Promise<void>;
+
+export function SetProxyGroup(arg1:main.ProxyGroup):Promise<string>;
+
+export function SetRules(arg1:string):Promise<string>;
+
+export function SetSocksAuth(arg1:string,arg2:string):Promise<void>;
+
+export function SetSocksPort(arg1:string):Promise<void>;
+
+export function SetStandbyProxies(arg1:Array<main.Proxy>):Promise<void>;
+
 export function SetSystemProxy(arg1:string,arg2:string,arg3:string):Promise<string>;
 
+export function SetSystemProxyGroup(arg1:string):Promise<string>;
+
+export function SetSystemProxyMode(arg1:string):Promise<string>;
+
+export function SetSystemProxyNode(arg1:main.Proxy):Promise<string>;
+
+export function SetTLSPolicy(arg1:main.TLSPolicy):Promise<string>;
+
+export function SetTransparentProxy(arg1:main.TransparentConfig):Promise<string>;
+
+export function SetTunnelTimeouts(arg1:number,arg2:number):Promise<void>;
+
+export function SetUDPTimeout(arg1:number):Promise<void>;
+
+export function StartLeakTestService():Promise<main.LeakTestConfig>;
+
 export function StartLocalMiddleware():Promise<void>;
 
+export function StopLeakTestService():Promise<void>;
+
 export function ToggleKillSwitch(arg1:boolean,arg2:string,arg3:string,arg4:string):Promise<void>;
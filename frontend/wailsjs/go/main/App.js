@@ -2,38 +2,298 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function ApplyTransparentRules() {
+  return window['go']['main']['App']['ApplyTransparentRules']();
+}
+
 export function CheckProxy(arg1, arg2, arg3) {
   return window['go']['main']['App']['CheckProxy'](arg1, arg2, arg3);
 }
 
+export function CheckProxyChain(arg1) {
+  return window['go']['main']['App']['CheckProxyChain'](arg1);
+}
+
+export function CheckProxyNode(arg1) {
+  return window['go']['main']['App']['CheckProxyNode'](arg1);
+}
+
+export function CheckProxyUDP(arg1) {
+  return window['go']['main']['App']['CheckProxyUDP'](arg1);
+}
+
+export function ClearCapturedRequests() {
+  return window['go']['main']['App']['ClearCapturedRequests']();
+}
+
+export function CloseAllConnections() {
+  return window['go']['main']['App']['CloseAllConnections']();
+}
+
+export function CloseConnection(arg1) {
+  return window['go']['main']['App']['CloseConnection'](arg1);
+}
+
+export function CloseHostConnections(arg1) {
+  return window['go']['main']['App']['CloseHostConnections'](arg1);
+}
+
 export function DisableSystemProxy() {
   return window['go']['main']['App']['DisableSystemProxy']();
 }
 
+export function ExportCACert() {
+  return window['go']['main']['App']['ExportCACert']();
+}
+
+export function ExportHAR() {
+  return window['go']['main']['App']['ExportHAR']();
+}
+
 export function FetchRealProxies(arg1) {
   return window['go']['main']['App']['FetchRealProxies'](arg1);
 }
 
+export function GetBandwidthStats() {
+  return window['go']['main']['App']['GetBandwidthStats']();
+}
+
+export function GetCapturedRequests(arg1) {
+  return window['go']['main']['App']['GetCapturedRequests'](arg1);
+}
+
+export function GetCertificatePin(arg1) {
+  return window['go']['main']['App']['GetCertificatePin'](arg1);
+}
+
+export function GetConnections() {
+  return window['go']['main']['App']['GetConnections']();
+}
+
+export function GetDNSPolicy() {
+  return window['go']['main']['App']['GetDNSPolicy']();
+}
+
+export function GetDefaultLeakTestConfig() {
+  return window['go']['main']['App']['GetDefaultLeakTestConfig']();
+}
+
+export function GetInspectorConfig() {
+  return window['go']['main']['App']['GetInspectorConfig']();
+}
+
+export function GetLANStatus() {
+  return window['go']['main']['App']['GetLANStatus']();
+}
+
+export function GetMITMStatus() {
+  return window['go']['main']['App']['GetMITMStatus']();
+}
+
+export function GetProxyChain() {
+  return window['go']['main']['App']['GetProxyChain']();
+}
+
+export function GetProxyGroups() {
+  return window['go']['main']['App']['GetProxyGroups']();
+}
+
+export function GetRules() {
+  return window['go']['main']['App']['GetRules']();
+}
+
+export function GetStandbyProxies() {
+  return window['go']['main']['App']['GetStandbyProxies']();
+}
+
 export function GetSystemProxyExitIP() {
   return window['go']['main']['App']['GetSystemProxyExitIP']();
 }
 
+export function GetSystemProxyExitIPv6() {
+  return window['go']['main']['App']['GetSystemProxyExitIPv6']();
+}
+
+export function GetSystemProxyMode() {
+  return window['go']['main']['App']['GetSystemProxyMode']();
+}
+
+export function GetTLSPolicy() {
+  return window['go']['main']['App']['GetTLSPolicy']();
+}
+
+export function GetTrafficStats(arg1) {
+  return window['go']['main']['App']['GetTrafficStats'](arg1);
+}
+
+export function GetTransparentRules() {
+  return window['go']['main']['App']['GetTransparentRules']();
+}
+
+export function GetTransparentStatus() {
+  return window['go']['main']['App']['GetTransparentStatus']();
+}
+
+export function GetTransportStats() {
+  return window['go']['main']['App']['GetTransportStats']();
+}
+
+export function LoadRulesFile(arg1) {
+  return window['go']['main']['App']['LoadRulesFile'](arg1);
+}
+
 export function OpenProxyFile() {
   return window['go']['main']['App']['OpenProxyFile']();
 }
 
+export function OpenRulesFile() {
+  return window['go']['main']['App']['OpenRulesFile']();
+}
+
+export function PACURL() {
+  return window['go']['main']['App']['PACURL']();
+}
+
+export function ParseProxyList(arg1) {
+  return window['go']['main']['App']['ParseProxyList'](arg1);
+}
+
+export function RegenerateCA() {
+  return window['go']['main']['App']['RegenerateCA']();
+}
+
+export function ReloadRules() {
+  return window['go']['main']['App']['ReloadRules']();
+}
+
+export function RemoveProxyGroup(arg1) {
+  return window['go']['main']['App']['RemoveProxyGroup'](arg1);
+}
+
+export function RemoveTransparentRules() {
+  return window['go']['main']['App']['RemoveTransparentRules']();
+}
+
+export function ResetTrafficStats() {
+  return window['go']['main']['App']['ResetTrafficStats']();
+}
+
+export function RunDNSLeakTest(arg1) {
+  return window['go']['main']['App']['RunDNSLeakTest'](arg1);
+}
+
+export function SaveCACertFile(arg1) {
+  return window['go']['main']['App']['SaveCACertFile'](arg1);
+}
+
+export function SaveHARFile(arg1) {
+  return window['go']['main']['App']['SaveHARFile'](arg1);
+}
+
+export function SelectGroupProxy(arg1, arg2) {
+  return window['go']['main']['App']['SelectGroupProxy'](arg1, arg2);
+}
+
+export function SetBandwidthLimits(arg1) {
+  return window['go']['main']['App']['SetBandwidthLimits'](arg1);
+}
+
+export function SetDNSPolicy(arg1) {
+  return window['go']['main']['App']['SetDNSPolicy'](arg1);
+}
+
+export function SetFailoverThreshold(arg1) {
+  return window['go']['main']['App']['SetFailoverThreshold'](arg1);
+}
+
+export function SetIPv6Loopback(arg1) {
+  return window['go']['main']['App']['SetIPv6Loopback'](arg1);
+}
+
+export function SetInspector(arg1) {
+  return window['go']['main']['App']['SetInspector'](arg1);
+}
+
+export function SetLANSharing(arg1) {
+  return window['go']['main']['App']['SetLANSharing'](arg1);
+}
+
 export function SetLocalPort(arg1) {
   return window['go']['main']['App']['SetLocalPort'](arg1);
 }
 
+export function SetMITM(arg1) {
+  return window['go']['main']['App']['SetMITM'](arg1);
+}
+
+export function SetProxyChain(arg1) {
+  return window['go']['main']['App']['SetProxyChain'](arg1);
+}
+
+export function SetProxyGroup(arg1) {
+  return window['go']['main']['App']['SetProxyGroup'](arg1);
+}
+
+export function SetRules(arg1) {
+  return window['go']['main']['App']['SetRules'](arg1);
+}
+
+export function SetSocksAuth(arg1, arg2) {
+  return window['go']['main']['App']['SetSocksAuth'](arg1, arg2);
+}
+
+export function SetSocksPort(arg1) {
+  return window['go']['main']['App']['SetSocksPort'](arg1);
+}
+
+export function SetStandbyProxies(arg1) {
+  return window['go']['main']['App']['SetStandbyProxies'](arg1);
+}
+
 export function SetSystemProxy(arg1, arg2, arg3) {
   return window['go']['main']['App']['SetSystemProxy'](arg1, arg2, arg3);
 }
 
+export function SetSystemProxyGroup(arg1) {
+  return window['go']['main']['App']['SetSystemProxyGroup'](arg1);
+}
+
+export function SetSystemProxyMode(arg1) {
+  return window['go']['main']['App']['SetSystemProxyMode'](arg1);
+}
+
+export function SetSystemProxyNode(arg1) {
+  return window['go']['main']['App']['SetSystemProxyNode'](arg1);
+}
+
+export function SetTLSPolicy(arg1) {
+  return window['go']['main']['App']['SetTLSPolicy'](arg1);
+}
+
+export function SetTransparentProxy(arg1) {
+  return window['go']['main']['App']['SetTransparentProxy'](arg1);
+}
+
+export function SetTunnelTimeouts(arg1, arg2) {
+  return window['go']['main']['App']['SetTunnelTimeouts'](arg1, arg2);
+}
+
+export function SetUDPTimeout(arg1) {
+  return window['go']['main']['App']['SetUDPTimeout'](arg1);
+}
+
+export function StartLeakTestService() {
+  return window['go']['main']['App']['StartLeakTestService']();
+}
+
 export function StartLocalMiddleware() {
   return window['go']['main']['App']['StartLocalMiddleware']();
 }
 
+export function StopLeakTestService() {
+  return window['go']['main']['App']['StopLeakTestService']();
+}
+
 export function ToggleKillSwitch(arg1, arg2, arg3, arg4) {
   return window['go']['main']['App']['ToggleKillSwitch'](arg1, arg2, arg3, arg4);
 }
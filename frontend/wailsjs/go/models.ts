@@ -1,9 +1,176 @@
 export namespace main {
 	
+	export class BandwidthConfig {
+	    global: BandwidthLimit;
+	    perClient: BandwidthLimit;
+	    perHost: BandwidthLimit;
+	    maxDelayMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BandwidthConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.global = this.convertValues(source["global"], BandwidthLimit);
+	        this.perClient = this.convertValues(source["perClient"], BandwidthLimit);
+	        this.perHost = this.convertValues(source["perHost"], BandwidthLimit);
+	        this.maxDelayMs = source["maxDelayMs"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class BandwidthLimit {
+	    up: number;
+	    down: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BandwidthLimit(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.up = source["up"];
+	        this.down = source["down"];
+	    }
+	}
+	export class BandwidthStats {
+	    limits: BandwidthConfig;
+	    throttled: number;
+	    delayMs: number;
+	    drops: number;
+	    clients: number;
+	    hosts: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BandwidthStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.limits = this.convertValues(source["limits"], BandwidthConfig);
+	        this.throttled = source["throttled"];
+	        this.delayMs = source["delayMs"];
+	        this.drops = source["drops"];
+	        this.clients = source["clients"];
+	        this.hosts = source["hosts"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class CaptureEntry {
+	    id: number;
+	    kind: string;
+	    startedAt: number;
+	    method: string;
+	    url: string;
+	    client: string;
+	    upstream: string;
+	    status: number;
+	    statusText: string;
+	    proto: string;
+	    requestHeaders: Record<string, string[]>;
+	    responseHeaders: Record<string, string[]>;
+	    requestSize: number;
+	    responseSize: number;
+	    requestBody?: string;
+	    requestBodyEncoding?: string;
+	    responseBody?: string;
+	    responseBodyEncoding?: string;
+	    bodyTruncated?: boolean;
+	    waitMs: number;
+	    durationMs: number;
+	    error?: string;
+	    done: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new CaptureEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.kind = source["kind"];
+	        this.startedAt = source["startedAt"];
+	        this.method = source["method"];
+	        this.url = source["url"];
+	        this.client = source["client"];
+	        this.upstream = source["upstream"];
+	        this.status = source["status"];
+	        this.statusText = source["statusText"];
+	        this.proto = source["proto"];
+	        this.requestHeaders = source["requestHeaders"];
+	        this.responseHeaders = source["responseHeaders"];
+	        this.requestSize = source["requestSize"];
+	        this.responseSize = source["responseSize"];
+	        this.requestBody = source["requestBody"];
+	        this.requestBodyEncoding = source["requestBodyEncoding"];
+	        this.responseBody = source["responseBody"];
+	        this.responseBodyEncoding = source["responseBodyEncoding"];
+	        this.bodyTruncated = source["bodyTruncated"];
+	        this.waitMs = source["waitMs"];
+	        this.durationMs = source["durationMs"];
+	        this.error = source["error"];
+	        this.done = source["done"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
 	export class CheckResult {
 	    latency: number;
 	    success: boolean;
 	    country: string;
+	    error?: string;
+	    failedHop?: number;
+	    udpSupported?: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new CheckResult(source);
@@ -14,6 +181,271 @@ export namespace main {
 	        this.latency = source["latency"];
 	        this.success = source["success"];
 	        this.country = source["country"];
+	        this.error = source["error"];
+	        this.failedHop = source["failedHop"];
+	        this.udpSupported = source["udpSupported"];
+	    }
+	}
+	export class ClientInfo {
+	    addr: string;
+	    connections: number;
+	    connectedAt: number;
+	    lastSeen: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ClientInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.addr = source["addr"];
+	        this.connections = source["connections"];
+	        this.connectedAt = source["connectedAt"];
+	        this.lastSeen = source["lastSeen"];
+	    }
+	}
+	export class ConnectionInfo {
+	    id: number;
+	    kind: string;
+	    client: string;
+	    host: string;
+	    upstream: string;
+	    startedAt: number;
+	    up: number;
+	    down: number;
+	    state: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ConnectionInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.kind = source["kind"];
+	        this.client = source["client"];
+	        this.host = source["host"];
+	        this.upstream = source["upstream"];
+	        this.startedAt = source["startedAt"];
+	        this.up = source["up"];
+	        this.down = source["down"];
+	        this.state = source["state"];
+	    }
+	}
+	export class DNSPolicy {
+	    mode: string;
+	    dohUrl: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DNSPolicy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mode = source["mode"];
+	        this.dohUrl = source["dohUrl"];
+	    }
+	}
+	export class InspectorConfig {
+	    enabled: boolean;
+	    captureBodies: boolean;
+	    bodyLimit: number;
+	    capacity: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new InspectorConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.captureBodies = source["captureBodies"];
+	        this.bodyLimit = source["bodyLimit"];
+	        this.capacity = source["capacity"];
+	    }
+	}
+	export class LANConfig {
+	    enabled: boolean;
+	    listenAddr: string;
+	    allowCidrs: string[];
+	    username?: string;
+	    password?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LANConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.listenAddr = source["listenAddr"];
+	        this.allowCidrs = source["allowCidrs"];
+	        this.username = source["username"];
+	        this.password = source["password"];
+	    }
+	}
+	export class LANStatus {
+	    enabled: boolean;
+	    listenAddr: string;
+	    allowCidrs: string[];
+	    authRequired: boolean;
+	    httpPort: string;
+	    socksPort: string;
+	    ipv6Loopback: boolean;
+	    clients: ClientInfo[];
+	
+	    static createFrom(source: any = {}) {
+	        return new LANStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.listenAddr = source["listenAddr"];
+	        this.allowCidrs = source["allowCidrs"];
+	        this.authRequired = source["authRequired"];
+	        this.httpPort = source["httpPort"];
+	        this.socksPort = source["socksPort"];
+	        this.ipv6Loopback = source["ipv6Loopback"];
+	        this.clients = this.convertValues(source["clients"], ClientInfo);
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class LeakResolver {
+	    ip: string;
+	    country: string;
+	    asn: string;
+	    localNetwork: boolean;
+	    matchesExit: boolean;
+	    matchesExitNetwork: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new LeakResolver(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.ip = source["ip"];
+	        this.country = source["country"];
+	        this.asn = source["asn"];
+	        this.localNetwork = source["localNetwork"];
+	        this.matchesExit = source["matchesExit"];
+	        this.matchesExitNetwork = source["matchesExitNetwork"];
+	    }
+	}
+	export class LeakTestConfig {
+	    sessionUrl: string;
+	    lookupHost: string;
+	    resultUrl: string;
+	    lookups: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new LeakTestConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.sessionUrl = source["sessionUrl"];
+	        this.lookupHost = source["lookupHost"];
+	        this.resultUrl = source["resultUrl"];
+	        this.lookups = source["lookups"];
+	    }
+	}
+	export class LeakTestResult {
+	    session: string;
+	    lookups: number;
+	    exitIp: string;
+	    resolvers: LeakResolver[];
+	    verdict: string;
+	    exitCountry?: string;
+	    exitAsn?: string;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new LeakTestResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.session = source["session"];
+	        this.lookups = source["lookups"];
+	        this.exitIp = source["exitIp"];
+	        this.resolvers = this.convertValues(source["resolvers"], LeakResolver);
+	        this.verdict = source["verdict"];
+	        this.exitCountry = source["exitCountry"];
+	        this.exitAsn = source["exitAsn"];
+	        this.error = source["error"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class MITMConfig {
+	    enabled: boolean;
+	    hosts: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new MITMConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.hosts = source["hosts"];
+	    }
+	}
+	export class MITMStatus {
+	    enabled: boolean;
+	    hosts: string[];
+	    caReady: boolean;
+	    caFingerprint: string;
+	    caNotAfter: number;
+	    caPath: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new MITMStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.hosts = source["hosts"];
+	        this.caReady = source["caReady"];
+	        this.caFingerprint = source["caFingerprint"];
+	        this.caNotAfter = source["caNotAfter"];
+	        this.caPath = source["caPath"];
 	    }
 	}
 	export class Proxy {
@@ -24,6 +456,14 @@ export namespace main {
 	    latency: number;
 	    status: string;
 	    source: string;
+	    protocol?: string;
+	    username?: string;
+	    password?: string;
+	    tlsServerName?: string;
+	    tlsCaFile?: string;
+	    tlsCertFile?: string;
+	    tlsKeyFile?: string;
+	    via?: Proxy[];
 	
 	    static createFrom(source: any = {}) {
 	        return new Proxy(source);
@@ -38,8 +478,355 @@ export namespace main {
 	        this.latency = source["latency"];
 	        this.status = source["status"];
 	        this.source = source["source"];
+	        this.protocol = source["protocol"];
+	        this.username = source["username"];
+	        this.password = source["password"];
+	        this.tlsServerName = source["tlsServerName"];
+	        this.tlsCaFile = source["tlsCaFile"];
+	        this.tlsCertFile = source["tlsCertFile"];
+	        this.tlsKeyFile = source["tlsKeyFile"];
+	        this.via = this.convertValues(source["via"], Proxy);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ProxyGroup {
+	    name: string;
+	    type: string;
+	    strategy?: string;
+	    interval?: number;
+	    tolerance?: number;
+	    selected?: string;
+	    proxies: Proxy[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ProxyGroup(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.strategy = source["strategy"];
+	        this.interval = source["interval"];
+	        this.tolerance = source["tolerance"];
+	        this.selected = source["selected"];
+	        this.proxies = this.convertValues(source["proxies"], Proxy);
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class ProxyGroupStatus {
+	    name: string;
+	    type: string;
+	    active: boolean;
+	    current: string;
+	    members: ProxyHealth[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ProxyGroupStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.type = source["type"];
+	        this.active = source["active"];
+	        this.current = source["current"];
+	        this.members = this.convertValues(source["members"], ProxyHealth);
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class ProxyHealth {
+	    key: string;
+	    ip: string;
+	    port: string;
+	    alive: boolean;
+	    latency: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ProxyHealth(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.key = source["key"];
+	        this.ip = source["ip"];
+	        this.port = source["port"];
+	        this.alive = source["alive"];
+	        this.latency = source["latency"];
+	    }
+	}
+	export class Rule {
+	    type: string;
+	    payload: string;
+	    action: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Rule(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.type = source["type"];
+	        this.payload = source["payload"];
+	        this.action = source["action"];
+	    }
+	}
+	export class TLSPolicy {
+	    mode: string;
+	    caFile: string;
+	    pins: Record<string, string[]>;
+	
+	    static createFrom(source: any = {}) {
+	        return new TLSPolicy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mode = source["mode"];
+	        this.caFile = source["caFile"];
+	        this.pins = source["pins"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class TrafficEntry {
+	    name: string;
+	    up: number;
+	    down: number;
+	    connections: number;
+	    active: number;
+	    durationMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TrafficEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.up = source["up"];
+	        this.down = source["down"];
+	        this.connections = source["connections"];
+	        this.active = source["active"];
+	        this.durationMs = source["durationMs"];
+	    }
+	}
+	export class TrafficSnapshot {
+	    startedAt: number;
+	    up: number;
+	    down: number;
+	    upRate: number;
+	    downRate: number;
+	    connections: number;
+	    active: number;
+	    topHosts: TrafficEntry[];
+	    upstreams: TrafficEntry[];
+	    bandwidth: BandwidthStats;
+	
+	    static createFrom(source: any = {}) {
+	        return new TrafficSnapshot(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.startedAt = source["startedAt"];
+	        this.up = source["up"];
+	        this.down = source["down"];
+	        this.upRate = source["upRate"];
+	        this.downRate = source["downRate"];
+	        this.connections = source["connections"];
+	        this.active = source["active"];
+	        this.topHosts = this.convertValues(source["topHosts"], TrafficEntry);
+	        this.upstreams = this.convertValues(source["upstreams"], TrafficEntry);
+	        this.bandwidth = this.convertValues(source["bandwidth"], BandwidthStats);
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class TransparentConfig {
+	    enabled: boolean;
+	    port: string;
+	    backend: string;
+	    user: string;
+	    cgroup: string;
+	    ipv6: boolean;
+	    bypass: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new TransparentConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.port = source["port"];
+	        this.backend = source["backend"];
+	        this.user = source["user"];
+	        this.cgroup = source["cgroup"];
+	        this.ipv6 = source["ipv6"];
+	        this.bypass = source["bypass"];
+	    }
+	}
+	export class TransparentRules {
+	    backend: string;
+	    apply: string;
+	    remove: string;
+	    error?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TransparentRules(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.backend = source["backend"];
+	        this.apply = source["apply"];
+	        this.remove = source["remove"];
+	        this.error = source["error"];
+	    }
+	}
+	export class TransparentStatus {
+	    supported: boolean;
+	    config: TransparentConfig;
+	    listening: boolean;
+	    rulesApplied: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new TransparentStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.supported = source["supported"];
+	        this.config = this.convertValues(source["config"], TransparentConfig);
+	        this.listening = source["listening"];
+	        this.rulesApplied = source["rulesApplied"];
+	    }
+	
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+	    if (!a) {
+	        return a;
+	    }
+	    if (a.slice && a.map) {
+	        return (a as any[]).map(elem => this.convertValues(elem, classs));
+	    } else if ("object" === typeof a) {
+	        if (asMap) {
+	            for (const key of Object.keys(a)) {
+	                a[key] = new classs(a[key]);
+	            }
+	            return a;
+	        }
+	        return new classs(a);
+	    }
+	    return a;
+	}
+	}
+	export class TransportStats {
+	    upstream: string;
+	    openConns: number;
+	    activeConns: number;
+	    idleConns: number;
+	    requests: number;
+	    createdAt: number;
+	    lastUsed: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TransportStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.upstream = source["upstream"];
+	        this.openConns = source["openConns"];
+	        this.activeConns = source["activeConns"];
+	        this.idleConns = source["idleConns"];
+	        this.requests = source["requests"];
+	        this.createdAt = source["createdAt"];
+	        this.lastUsed = source["lastUsed"];
 	    }
 	}
 
 }
-
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- 代理策略組 (Policy Groups) ----------------
+
+// 策略組類型 (與 Clash 相同命名)
+const (
+	groupFallback    = "fallback"     // 依序選第一個存活節點
+	groupLoadBalance = "load-balance" // 輪詢或依目標一致性雜湊
+	groupURLTest     = "url-test"     // 選延遲最低的存活節點
+	groupSelect      = "select"       // 手動選擇
+
+	lbRoundRobin     = "round-robin"
+	lbConsistentHash = "consistent-hashing"
+
+	defaultGroupInterval = 300 // 秒
+	// 被動回報連續失敗達此次數才標記失效 (單次逾時或目標異常不致誤判)
+	groupFailThreshold = 3
+)
+
+// ProxyGroup 策略組設定
+type ProxyGroup struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Strategy  string  `json:"strategy,omitempty"`  // load-balance 使用
+	Interval  int     `json:"interval,omitempty"`  // 健康檢查間隔 (秒)
+	Tolerance int64   `json:"tolerance,omitempty"` // url-test 切換容差 (毫秒)
+	Selected  string  `json:"selected,omitempty"`  // select 手動選擇的節點 (ip:port)
+	Proxies   []Proxy `json:"proxies"`
+}
+
+// ProxyHealth 單一節點的健康狀態
+type ProxyHealth struct {
+	Key     string `json:"key"`
+	IP      string `json:"ip"`
+	Port    string `json:"port"`
+	Alive   bool   `json:"alive"`
+	Latency int64  `json:"latency"`
+}
+
+// ProxyGroupStatus 提供給前端的策略組狀態
+type ProxyGroupStatus struct {
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Active  bool          `json:"active"`
+	Current string        `json:"current"`
+	Members []ProxyHealth `json:"members"`
+}
+
+// 策略組執行期狀態
+type policyGroup struct {
+	mu       sync.Mutex
+	cfg      ProxyGroup
+	alive    map[string]bool
+	latency  map[string]int64
+	failures map[string]int // 被動回報的連續失敗次數
+	current  string         // url-test / fallback 目前選用的節點
+	rr       int
+	cancel   context.CancelFunc
+}
+
+// 節點識別 (與去重規則一致，使用 ip:port)
+func proxyKey(p *Proxy) string {
+	return net.JoinHostPort(p.IP, p.Port)
+}
+
+func newPolicyGroup(cfg ProxyGroup) *policyGroup {
+	g := &policyGroup{
+		cfg:      cfg,
+		alive:    make(map[string]bool),
+		latency:  make(map[string]int64),
+		failures: make(map[string]int),
+	}
+	// 尚未檢測前一律視為存活
+	for i := range cfg.Proxies {
+		g.alive[proxyKey(&cfg.Proxies[i])] = true
+	}
+	return g
+}
+
+// 依策略為目標挑選節點
+func (g *policyGroup) pick(target string) *Proxy {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.cfg.Proxies) == 0 {
+		return nil
+	}
+
+	var healthy []*Proxy
+	for i := range g.cfg.Proxies {
+		p := &g.cfg.Proxies[i]
+		if g.alive[proxyKey(p)] {
+			healthy = append(healthy, p)
+		}
+	}
+
+	switch g.cfg.Type {
+	case groupSelect:
+		for i := range g.cfg.Proxies {
+			if proxyKey(&g.cfg.Proxies[i]) == g.cfg.Selected {
+				return copyProxy(&g.cfg.Proxies[i])
+			}
+		}
+		return copyProxy(&g.cfg.Proxies[0])
+
+	case groupLoadBalance:
+		if len(healthy) == 0 {
+			healthy = []*Proxy{&g.cfg.Proxies[0]}
+		}
+		if g.cfg.Strategy == lbConsistentHash {
+			return copyProxy(hashPick(healthy, target))
+		}
+		p := healthy[g.rr%len(healthy)]
+		g.rr++
+		return copyProxy(p)
+
+	case groupURLTest:
+		if g.current != "" && g.alive[g.current] {
+			for _, p := range healthy {
+				if proxyKey(p) == g.current {
+					return copyProxy(p)
+				}
+			}
+		}
+		if len(healthy) > 0 {
+			g.current = proxyKey(healthy[0])
+			return copyProxy(healthy[0])
+		}
+		return copyProxy(&g.cfg.Proxies[0])
+
+	default: // fallback
+		if len(healthy) > 0 {
+			g.current = proxyKey(healthy[0])
+			return copyProxy(healthy[0])
+		}
+		// 全部失效時仍嘗試第一個節點
+		return copyProxy(&g.cfg.Proxies[0])
+	}
+}
+
+// 一致性雜湊 (rendezvous hashing)：同一目標主機固定走同一節點，成員變動時影響最小
+func hashPick(proxies []*Proxy, target string) *Proxy {
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+
+	var best *Proxy
+	var bestScore uint64
+	for _, p := range proxies {
+		h := fnv.New64a()
+		h.Write([]byte(host))
+		h.Write([]byte(proxyKey(p)))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return best
+}
+
+// 被動回報：連續失敗達門檻時將節點標為失效，任一次成功即恢復
+// 存活狀態改變時 url-test 立即重新選擇節點
+func (g *policyGroup) report(p *Proxy, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := proxyKey(p)
+	alive, exists := g.alive[key]
+	if !exists {
+		return
+	}
+	if ok {
+		g.failures[key] = 0
+	} else {
+		g.failures[key]++
+	}
+	next := ok || (alive && g.failures[key] < groupFailThreshold)
+	if next != alive {
+		g.alive[key] = next
+		g.reselectLocked()
+	}
+}
+
+// 重新選出 url-test 的最佳節點 (呼叫者需持有 g.mu)
+func (g *policyGroup) reselectLocked() {
+	if g.cfg.Type != groupURLTest {
+		return
+	}
+	best := ""
+	var bestLatency int64
+	for i := range g.cfg.Proxies {
+		key := proxyKey(&g.cfg.Proxies[i])
+		if !g.alive[key] {
+			continue
+		}
+		if l := g.latency[key]; best == "" || l < bestLatency {
+			best, bestLatency = key, l
+		}
+	}
+	// 目前節點仍在容差內則不切換，避免頻繁跳動
+	if g.current != "" && g.alive[g.current] && g.latency[g.current]-bestLatency <= g.cfg.Tolerance {
+		return
+	}
+	g.current = best
+}
+
+// 對所有成員執行一次健康檢查
+func (a *App) testGroup(g *policyGroup) {
+	g.mu.Lock()
+	proxies := append([]Proxy(nil), g.cfg.Proxies...)
+	g.mu.Unlock()
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 5) // 限制並發數
+	for i := range proxies {
+		wg.Add(1)
+		go func(p *Proxy) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			res := a.checkProxy(p)
+			g.mu.Lock()
+			g.alive[proxyKey(p)] = res.Success
+			g.failures[proxyKey(p)] = 0
+			if res.Success {
+				g.latency[proxyKey(p)] = res.Latency
+			}
+			g.mu.Unlock()
+		}(&proxies[i])
+	}
+	wg.Wait()
+
+	g.mu.Lock()
+	g.reselectLocked()
+	g.mu.Unlock()
+}
+
+// 啟動定期健康檢查 (select 類型不需要)
+func (a *App) startGroupHealthCheck(g *policyGroup) {
+	if g.cfg.Type == groupSelect {
+		return
+	}
+	interval := g.cfg.Interval
+	if interval <= 0 {
+		interval = defaultGroupInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+
+	go func() {
+		a.testGroup(g)
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.testGroup(g)
+			}
+		}
+	}()
+}
+
+// 取得轉發用的上游節點：啟用策略組時由策略組決定，否則使用 activeRemote
+func (a *App) pickUpstream(target string) *Proxy {
+	a.mu.RLock()
+	remote := a.activeRemote
+	g := a.groups[a.activeGroup]
+	a.mu.RUnlock()
+
+	if g != nil {
+		return g.pick(target)
+	}
+	return remote
+}
+
+// 回報上游轉發結果：策略組自行切換節點，單一節點則通知前端換線
+// p 為 nil 代表依規則直連，不列入統計
+func (a *App) reportUpstream(p *Proxy, ok bool) {
+	if p == nil {
+		return
+	}
+	a.mu.RLock()
+	g := a.groups[a.activeGroup]
+	a.mu.RUnlock()
+
+	if g != nil {
+		g.report(p, ok)
+		return
+	}
+	// 單一節點由後端切換備援節點，沒有備援時才通知前端換線
+	if !a.recordUpstreamResult(p, ok) && a.ctx != nil {
+		wailsRuntime.EventsEmit(a.ctx, "proxy_need_rotate", p.IP)
+	}
+}
+
+// 10. 新增或更新策略組
+func (a *App) SetProxyGroup(cfg ProxyGroup) string {
+	cfg.Name = strings.TrimSpace(cfg.Name)
+	if cfg.Name == "" {
+		return "invalid_name"
+	}
+	switch cfg.Type {
+	case groupFallback, groupURLTest, groupSelect:
+	case groupLoadBalance:
+		if cfg.Strategy == "" {
+			cfg.Strategy = lbRoundRobin
+		}
+		if cfg.Strategy != lbRoundRobin && cfg.Strategy != lbConsistentHash {
+			return "invalid_strategy"
+		}
+	default:
+		return "invalid_type"
+	}
+	if len(cfg.Proxies) == 0 {
+		return "empty_group"
+	}
+
+	cfg.Proxies = append([]Proxy(nil), cfg.Proxies...)
+	for i := range cfg.Proxies {
+		a.applyProxyChain(&cfg.Proxies[i])
+	}
+
+	g := newPolicyGroup(cfg)
+	a.startGroupHealthCheck(g)
+
+	a.mu.Lock()
+	if a.groups == nil {
+		a.groups = make(map[string]*policyGroup)
+	}
+	if old := a.groups[cfg.Name]; old != nil && old.cancel != nil {
+		old.cancel()
+	}
+	a.groups[cfg.Name] = g
+	a.mu.Unlock()
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Proxy group %s (%s) set with %d proxies", cfg.Name, cfg.Type, len(cfg.Proxies)))
+	}
+	return "Success"
+}
+
+// 10-1. 刪除策略組
+func (a *App) RemoveProxyGroup(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if g := a.groups[name]; g != nil {
+		if g.cancel != nil {
+			g.cancel()
+		}
+		delete(a.groups, name)
+	}
+	if a.activeGroup == name {
+		a.activeGroup = ""
+	}
+}
+
+// 10-2. 手動選擇節點 (僅 select 類型)
+func (a *App) SelectGroupProxy(name, key string) string {
+	a.mu.RLock()
+	g := a.groups[name]
+	a.mu.RUnlock()
+	if g == nil {
+		return "group_not_found"
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.cfg.Type != groupSelect {
+		return "not_select_group"
+	}
+	if _, ok := g.alive[key]; !ok {
+		return "proxy_not_found"
+	}
+	g.cfg.Selected = key
+	return "Success"
+}
+
+// 10-3. 取得所有策略組狀態
+func (a *App) GetProxyGroups() []ProxyGroupStatus {
+	a.mu.RLock()
+	groups := make([]*policyGroup, 0, len(a.groups))
+	for _, g := range a.groups {
+		groups = append(groups, g)
+	}
+	active := a.activeGroup
+	a.mu.RUnlock()
+
+	result := make([]ProxyGroupStatus, 0, len(groups))
+	for _, g := range groups {
+		g.mu.Lock()
+		status := ProxyGroupStatus{
+			Name:    g.cfg.Name,
+			Type:    g.cfg.Type,
+			Active:  g.cfg.Name == active,
+			Current: g.current,
+		}
+		if g.cfg.Type == groupSelect {
+			status.Current = g.cfg.Selected
+		}
+		for i := range g.cfg.Proxies {
+			p := &g.cfg.Proxies[i]
+			key := proxyKey(p)
+			status.Members = append(status.Members, ProxyHealth{
+				Key:     key,
+				IP:      p.IP,
+				Port:    p.Port,
+				Alive:   g.alive[key],
+				Latency: g.latency[key],
+			})
+		}
+		g.mu.Unlock()
+		result = append(result, status)
+	}
+	return result
+}
+
+// 10-4. 透過策略組連線 (啟動中轉並設定系統代理)
+func (a *App) SetSystemProxyGroup(name string) string {
+	a.mu.Lock()
+	if a.groups[name] == nil {
+		a.mu.Unlock()
+		return "group_not_found"
+	}
+	a.activeGroup = name
+	old := a.activeRemote
+	a.activeRemote = nil
+	a.mu.Unlock()
+
+	if old != nil {
+		a.transports.invalidate(old)
+	}
+
+	result := a.activateLocalProxy()
+	if result != "Success" {
+		return result
+	}
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Proxy group %s activated", name))
+	}
+	wailsRuntime.EventsEmit(a.ctx, "connection_success", map[string]interface{}{
+		"group": name,
+	})
+	return "Success"
+}
+
+// 停止所有策略組的健康檢查
+func (a *App) stopProxyGroups() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, g := range a.groups {
+		if g.cancel != nil {
+			g.cancel()
+		}
+	}
+}
+
+// 複製節點，避免呼叫端修改策略組內部資料
+func copyProxy(p *Proxy) *Proxy {
+	cp := *p
+	return &cp
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testGroupProxies() []Proxy {
+	return []Proxy{
+		{IP: "10.0.0.1", Port: "1080"},
+		{IP: "10.0.0.2", Port: "1080"},
+		{IP: "10.0.0.3", Port: "1080"},
+	}
+}
+
+func TestPolicyGroupPick(t *testing.T) {
+	const (
+		a = "10.0.0.1:1080"
+		b = "10.0.0.2:1080"
+		c = "10.0.0.3:1080"
+	)
+	tests := []struct {
+		name     string
+		cfg      ProxyGroup
+		dead     []string
+		current  string
+		targets  []string
+		want     []string
+		noMember bool
+	}{
+		{name: "select chosen", cfg: ProxyGroup{Type: groupSelect, Selected: b}, targets: []string{"x:80"}, want: []string{b}},
+		{name: "select ignores health", cfg: ProxyGroup{Type: groupSelect, Selected: b}, dead: []string{b}, targets: []string{"x:80"}, want: []string{b}},
+		{name: "select unknown falls back to first", cfg: ProxyGroup{Type: groupSelect, Selected: "10.9.9.9:1"}, targets: []string{"x:80"}, want: []string{a}},
+		{name: "fallback first alive", cfg: ProxyGroup{Type: groupFallback}, targets: []string{"x:80"}, want: []string{a}},
+		{name: "fallback skips dead", cfg: ProxyGroup{Type: groupFallback}, dead: []string{a}, targets: []string{"x:80"}, want: []string{b}},
+		{name: "fallback all dead tries first", cfg: ProxyGroup{Type: groupFallback}, dead: []string{a, b, c}, targets: []string{"x:80"}, want: []string{a}},
+		{name: "round robin over alive", cfg: ProxyGroup{Type: groupLoadBalance, Strategy: lbRoundRobin}, dead: []string{b},
+			targets: []string{"x:80", "x:80", "x:80", "x:80"}, want: []string{a, c, a, c}},
+		{name: "round robin all dead", cfg: ProxyGroup{Type: groupLoadBalance}, dead: []string{a, b, c}, targets: []string{"x:80", "y:80"}, want: []string{a, a}},
+		{name: "url-test keeps current", cfg: ProxyGroup{Type: groupURLTest}, current: c, targets: []string{"x:80"}, want: []string{c}},
+		{name: "url-test current dead", cfg: ProxyGroup{Type: groupURLTest}, current: c, dead: []string{a, c}, targets: []string{"x:80"}, want: []string{b}},
+		{name: "url-test all dead", cfg: ProxyGroup{Type: groupURLTest}, dead: []string{a, b, c}, targets: []string{"x:80"}, want: []string{a}},
+		{name: "empty group", cfg: ProxyGroup{Type: groupFallback}, targets: []string{"x:80"}, noMember: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.noMember {
+				tt.cfg.Proxies = testGroupProxies()
+			}
+			g := newPolicyGroup(tt.cfg)
+			for _, key := range tt.dead {
+				g.alive[key] = false
+			}
+			g.current = tt.current
+
+			var got []string
+			for _, target := range tt.targets {
+				p := g.pick(target)
+				if p == nil {
+					got = append(got, "")
+					continue
+				}
+				got = append(got, proxyKey(p))
+			}
+			if tt.noMember {
+				if got[0] != "" {
+					t.Fatalf("pick() on empty group = %v, want nil", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pick() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyGroupPickReturnsCopy(t *testing.T) {
+	g := newPolicyGroup(ProxyGroup{Type: groupFallback, Proxies: testGroupProxies()})
+	p := g.pick("x:80")
+	p.IP = "changed"
+	if g.cfg.Proxies[0].IP != "10.0.0.1" {
+		t.Fatal("pick() returned a reference into the group configuration")
+	}
+}
+
+func TestConsistentHashPick(t *testing.T) {
+	g := newPolicyGroup(ProxyGroup{Type: groupLoadBalance, Strategy: lbConsistentHash, Proxies: testGroupProxies()})
+	hosts := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com", "f.example.com"}
+
+	first := make(map[string]string)
+	used := make(map[string]bool)
+	for _, host := range hosts {
+		first[host] = proxyKey(g.pick(host + ":443"))
+		used[first[host]] = true
+		// 同一主機不論端口都走同一節點
+		if got := proxyKey(g.pick(host + ":80")); got != first[host] {
+			t.Errorf("%s: port 80 picked %s, port 443 picked %s", host, got, first[host])
+		}
+	}
+	if len(used) < 2 {
+		t.Errorf("consistent hashing put every host on one node: %v", first)
+	}
+
+	// 節點失效時只有原本落在該節點的主機會移動
+	dead := proxyKey(&g.cfg.Proxies[0])
+	for i := 0; i < groupFailThreshold; i++ {
+		g.report(&g.cfg.Proxies[0], false)
+	}
+	for _, host := range hosts {
+		got := proxyKey(g.pick(host + ":443"))
+		if got == dead {
+			t.Errorf("%s still routed to dead node", host)
+		}
+		if first[host] != dead && got != first[host] {
+			t.Errorf("%s moved from %s to %s although its node is alive", host, first[host], got)
+		}
+	}
+}
+
+func TestPolicyGroupReselect(t *testing.T) {
+	const (
+		a = "10.0.0.1:1080"
+		b = "10.0.0.2:1080"
+		c = "10.0.0.3:1080"
+	)
+	tests := []struct {
+		name      string
+		tolerance int64
+		current   string
+		latency   map[string]int64
+		dead      []string
+		want      string
+	}{
+		{name: "lowest latency", latency: map[string]int64{a: 300, b: 100, c: 200}, want: b},
+		{name: "skips dead", latency: map[string]int64{a: 300, b: 100, c: 200}, dead: []string{b}, want: c},
+		{name: "within tolerance keeps current", tolerance: 50, current: c, latency: map[string]int64{a: 300, b: 100, c: 140}, want: c},
+		{name: "beyond tolerance switches", tolerance: 20, current: c, latency: map[string]int64{a: 300, b: 100, c: 140}, want: b},
+		{name: "current dead switches", tolerance: 1000, current: c, latency: map[string]int64{a: 300, b: 100, c: 50}, dead: []string{c}, want: b},
+		{name: "all dead", latency: map[string]int64{a: 1, b: 2, c: 3}, dead: []string{a, b, c}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newPolicyGroup(ProxyGroup{Type: groupURLTest, Tolerance: tt.tolerance, Proxies: testGroupProxies()})
+			for key, l := range tt.latency {
+				g.latency[key] = l
+			}
+			for _, key := range tt.dead {
+				g.alive[key] = false
+			}
+			g.current = tt.current
+			g.reselectLocked()
+			if g.current != tt.want {
+				t.Errorf("current = %q, want %q", g.current, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyGroupReport(t *testing.T) {
+	const key = "10.0.0.1:1080"
+	p := &Proxy{IP: "10.0.0.1", Port: "1080"}
+	tests := []struct {
+		name      string
+		dead      bool // 回報前已標記失效
+		reports   []bool
+		wantAlive bool
+	}{
+		{name: "single failure keeps alive", reports: []bool{false}, wantAlive: true},
+		{name: "below threshold", reports: []bool{false, false}, wantAlive: true},
+		{name: "threshold marks dead", reports: []bool{false, false, false}, wantAlive: false},
+		{name: "success resets count", reports: []bool{false, false, true, false, false}, wantAlive: true},
+		{name: "success revives", reports: []bool{false, false, false, true}, wantAlive: true},
+		{name: "dead after health check", dead: true, reports: []bool{false}, wantAlive: false},
+		{name: "health check dead revived", dead: true, reports: []bool{true}, wantAlive: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newPolicyGroup(ProxyGroup{Type: groupFallback, Proxies: testGroupProxies()})
+			g.alive[key] = !tt.dead
+			for _, ok := range tt.reports {
+				g.report(p, ok)
+			}
+			if g.alive[key] != tt.wantAlive {
+				t.Errorf("alive = %v, want %v", g.alive[key], tt.wantAlive)
+			}
+		})
+	}
+
+	// 非成員的回報不會加入狀態表
+	g := newPolicyGroup(ProxyGroup{Type: groupFallback, Proxies: testGroupProxies()})
+	g.report(&Proxy{IP: "192.0.2.1", Port: "1"}, false)
+	if _, ok := g.alive["192.0.2.1:1"]; ok {
+		t.Fatal("report() added a non-member")
+	}
+}
+
+// url-test 目前節點失效或恢復時立即重新選擇，不等下次健康檢查
+func TestPolicyGroupReportReselects(t *testing.T) {
+	g := newPolicyGroup(ProxyGroup{Type: groupURLTest, Proxies: testGroupProxies()})
+	g.latency = map[string]int64{"10.0.0.1:1080": 100, "10.0.0.2:1080": 200, "10.0.0.3:1080": 300}
+	g.reselectLocked()
+	if g.current != "10.0.0.1:1080" {
+		t.Fatalf("current = %q, want 10.0.0.1:1080", g.current)
+	}
+
+	best := &Proxy{IP: "10.0.0.1", Port: "1080"}
+	for i := 0; i < groupFailThreshold; i++ {
+		g.report(best, false)
+	}
+	if g.current != "10.0.0.2:1080" {
+		t.Errorf("current after failures = %q, want 10.0.0.2:1080", g.current)
+	}
+	g.report(best, true)
+	if g.current != "10.0.0.1:1080" {
+		t.Errorf("current after recovery = %q, want 10.0.0.1:1080", g.current)
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- 請求檢視器 (Inspector) 與 HAR 匯出 ----------------
+
+const (
+	defaultCaptureCapacity  = 500
+	defaultCaptureBodyLimit = 64 * 1024
+)
+
+// InspectorConfig 擷取設定
+type InspectorConfig struct {
+	Enabled       bool `json:"enabled"`
+	CaptureBodies bool `json:"captureBodies"`
+	BodyLimit     int  `json:"bodyLimit"` // 每個本體最多保留的位元組
+	Capacity      int  `json:"capacity"`  // 最多保留的紀錄數 (超過時覆蓋最舊的)
+}
+
+// CaptureEntry 單筆擷取紀錄 (HTTP 請求或通道)
+type CaptureEntry struct {
+	ID        int64  `json:"id"`
+	Kind      string `json:"kind"`
+	StartedAt int64  `json:"startedAt"` // Unix 毫秒
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	Client    string `json:"client"`
+	Upstream  string `json:"upstream"`
+
+	Status          int                 `json:"status"`
+	StatusText      string              `json:"statusText"`
+	Proto           string              `json:"proto"`
+	RequestHeaders  map[string][]string `json:"requestHeaders"`
+	ResponseHeaders map[string][]string `json:"responseHeaders"`
+	RequestSize     int64               `json:"requestSize"`
+	ResponseSize    int64               `json:"responseSize"`
+
+	RequestBody          string `json:"requestBody,omitempty"`
+	RequestBodyEncoding  string `json:"requestBodyEncoding,omitempty"` // 非 UTF-8 時為 base64
+	ResponseBody         string `json:"responseBody,omitempty"`
+	ResponseBodyEncoding string `json:"responseBodyEncoding,omitempty"`
+	BodyTruncated        bool   `json:"bodyTruncated,omitempty"`
+
+	WaitMs     int64  `json:"waitMs"`     // 送出請求到收到回應標頭
+	DurationMs int64  `json:"durationMs"` // 整體時間
+	Error      string `json:"error,omitempty"`
+	Done       bool   `json:"done"`
+}
+
+// limitedBuffer 只保留前 limit 個位元組
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) add(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	room := b.limit - len(b.buf)
+	if len(p) > room {
+		p = p[:room]
+		b.truncated = true
+	}
+	b.buf = append(b.buf, p...)
+}
+
+// 回傳本體內容與編碼 (非 UTF-8 內容以 base64 表示)
+func (b *limitedBuffer) text() (string, string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if utf8.Valid(b.buf) {
+		return string(b.buf), "", b.truncated
+	}
+	return base64.StdEncoding.EncodeToString(b.buf), "base64", b.truncated
+}
+
+// captureBody 讀取時複製一份到 limitedBuffer
+type captureBody struct {
+	io.ReadCloser
+	buf *limitedBuffer
+}
+
+func (c *captureBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.buf.add(p[:n])
+	}
+	return n, err
+}
+
+type inspector struct {
+	mu      sync.Mutex
+	cfg     InspectorConfig
+	entries []*CaptureEntry
+	next    int
+	seq     int64
+}
+
+// 進行中的擷取紀錄
+type captureRecord struct {
+	ins      *inspector
+	entry    *CaptureEntry
+	start    time.Time
+	reqBody  *limitedBuffer
+	respBody *limitedBuffer
+}
+
+// 新增紀錄到環狀緩衝區 (呼叫者需持有 ins.mu)
+func (ins *inspector) pushLocked(e *CaptureEntry) {
+	capacity := ins.cfg.Capacity
+	if capacity <= 0 {
+		capacity = defaultCaptureCapacity
+	}
+	ins.seq++
+	e.ID = ins.seq
+	if len(ins.entries) < capacity {
+		ins.entries = append(ins.entries, e)
+		return
+	}
+	ins.entries[ins.next] = e
+	ins.next = (ins.next + 1) % capacity
+}
+
+// 開始擷取一筆紀錄，未啟用時回傳 nil
+func (ins *inspector) begin(kind, method, rawURL, client, upstream string, header http.Header) *captureRecord {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	if !ins.cfg.Enabled {
+		return nil
+	}
+
+	now := time.Now()
+	rec := &captureRecord{
+		ins:   ins,
+		start: now,
+		entry: &CaptureEntry{
+			Kind:           kind,
+			StartedAt:      now.UnixMilli(),
+			Method:         method,
+			URL:            rawURL,
+			Client:         client,
+			Upstream:       upstream,
+			RequestHeaders: redactHeaders(header),
+		},
+	}
+	if ins.cfg.CaptureBodies && kind == connKindHTTP {
+		limit := ins.cfg.BodyLimit
+		if limit <= 0 {
+			limit = defaultCaptureBodyLimit
+		}
+		rec.reqBody = &limitedBuffer{limit: limit}
+		rec.respBody = &limitedBuffer{limit: limit}
+	}
+	ins.pushLocked(rec.entry)
+	return rec
+}
+
+// 複製標頭並隱藏認證資訊
+func redactHeaders(h http.Header) map[string][]string {
+	if h == nil {
+		return nil
+	}
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		switch http.CanonicalHeaderKey(k) {
+		case "Proxy-Authorization":
+			out[k] = []string{"[redacted]"}
+		default:
+			out[k] = append([]string(nil), v...)
+		}
+	}
+	return out
+}
+
+// 包裝請求本體以擷取內容 (未擷取本體時原樣回傳)
+func (rec *captureRecord) requestBody(rc io.ReadCloser) io.ReadCloser {
+	if rec == nil || rec.reqBody == nil || rc == nil || rc == http.NoBody {
+		return rc
+	}
+	return &captureBody{rc, rec.reqBody}
+}
+
+// 包裝回應本體以擷取內容
+func (rec *captureRecord) responseBody(rc io.ReadCloser) io.ReadCloser {
+	if rec == nil || rec.respBody == nil || rc == nil || rc == http.NoBody {
+		return rc
+	}
+	return &captureBody{rc, rec.respBody}
+}
+
+// 記錄收到的回應標頭
+func (rec *captureRecord) response(resp *http.Response) {
+	if rec == nil {
+		return
+	}
+	rec.ins.mu.Lock()
+	defer rec.ins.mu.Unlock()
+	rec.entry.Status = resp.StatusCode
+	rec.entry.StatusText = strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+	rec.entry.Proto = resp.Proto
+	rec.entry.ResponseHeaders = redactHeaders(resp.Header)
+	rec.entry.WaitMs = time.Since(rec.start).Milliseconds()
+}
+
+// 記錄通道或請求的回應狀態 (CONNECT / SOCKS5 沒有實際的 HTTP 回應)
+func (rec *captureRecord) status(code int) {
+	if rec == nil {
+		return
+	}
+	rec.ins.mu.Lock()
+	defer rec.ins.mu.Unlock()
+	rec.entry.Status = code
+	rec.entry.StatusText = http.StatusText(code)
+	rec.entry.Proto = "HTTP/1.1"
+	rec.entry.WaitMs = time.Since(rec.start).Milliseconds()
+}
+
+func (rec *captureRecord) fail(err error) {
+	if rec == nil || err == nil {
+		return
+	}
+	rec.ins.mu.Lock()
+	defer rec.ins.mu.Unlock()
+	rec.entry.Error = err.Error()
+}
+
+// 結束擷取，位元組數取自流量統計
+func (rec *captureRecord) finish(flow *trafficFlow) {
+	if rec == nil {
+		return
+	}
+	rec.ins.mu.Lock()
+	defer rec.ins.mu.Unlock()
+	e := rec.entry
+	e.DurationMs = time.Since(rec.start).Milliseconds()
+	if flow != nil {
+		e.RequestSize = flow.up.Load()
+		e.ResponseSize = flow.down.Load()
+	}
+	if rec.reqBody != nil {
+		var t1, t2 bool
+		e.RequestBody, e.RequestBodyEncoding, t1 = rec.reqBody.text()
+		e.ResponseBody, e.ResponseBodyEncoding, t2 = rec.respBody.text()
+		e.BodyTruncated = t1 || t2
+	}
+	e.Done = true
+}
+
+// 回傳依時間排序的紀錄副本
+func (ins *inspector) list(limit int) []CaptureEntry {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+
+	result := make([]CaptureEntry, 0, len(ins.entries))
+	for _, e := range ins.entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	return result
+}
+
+// ---------------- HAR 1.2 ----------------
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"` // 解壓縮後增加的位元組
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harTimings struct {
+	Send    int64 `json:"send"`
+	Wait    int64 `json:"wait"`
+	Receive int64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            int64       `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+func harHeaders(h map[string][]string) []harNameValue {
+	result := []harNameValue{}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			result = append(result, harNameValue{Name: k, Value: v})
+		}
+	}
+	return result
+}
+
+func harQuery(rawURL string) []harNameValue {
+	result := []harNameValue{}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return result
+	}
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			result = append(result, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// 解壓縮後最多保留的位元組，避免壓縮炸彈
+const harMaxDecodedBody = 4 * 1024 * 1024
+
+// 依 Content-Encoding 解壓縮本體 (不支援的編碼回傳錯誤)
+func decodeContent(encoding string, raw []byte) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "deflate":
+		// 規範為 zlib 格式，但部分伺服器送出未包裝的 deflate
+		if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(raw))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content-encoding %q", encoding)
+	}
+	return io.ReadAll(io.LimitReader(r, harMaxDecodedBody))
+}
+
+// HAR 的 content.text 為解壓縮後的內容
+// 無法解壓縮 (例如 br) 時以 base64 保留原始位元組，並回傳說明
+func harResponseContent(e CaptureEntry) (harContent, string) {
+	c := harContent{
+		Size:     e.ResponseSize,
+		MimeType: http.Header(e.ResponseHeaders).Get("Content-Type"),
+		Text:     e.ResponseBody,
+		Encoding: e.ResponseBodyEncoding,
+	}
+	encoding := strings.ToLower(strings.TrimSpace(http.Header(e.ResponseHeaders).Get("Content-Encoding")))
+	if e.ResponseBody == "" || encoding == "" || encoding == "identity" {
+		return c, ""
+	}
+
+	raw := []byte(e.ResponseBody)
+	if e.ResponseBodyEncoding == "base64" {
+		var err error
+		if raw, err = base64.StdEncoding.DecodeString(e.ResponseBody); err != nil {
+			return c, ""
+		}
+	}
+	// 本體被截斷時解壓縮必然不完整，保留已還原的部分
+	decoded, err := decodeContent(encoding, raw)
+	if err != nil && (!e.BodyTruncated || len(decoded) == 0) {
+		c.Text, c.Encoding = base64.StdEncoding.EncodeToString(raw), "base64"
+		return c, "content-encoding " + encoding + " not decoded"
+	}
+
+	if utf8.Valid(decoded) {
+		c.Text, c.Encoding = string(decoded), ""
+	} else {
+		c.Text, c.Encoding = base64.StdEncoding.EncodeToString(decoded), "base64"
+	}
+	if !e.BodyTruncated && len(decoded) < harMaxDecodedBody {
+		c.Size = int64(len(decoded))
+		c.Compression = c.Size - e.ResponseSize
+	}
+	return c, ""
+}
+
+// 將擷取紀錄轉為 HAR 1.2
+func buildHAR(entries []CaptureEntry) ([]byte, error) {
+	var har harLog
+	har.Log.Version = "1.2"
+	har.Log.Creator.Name = "ProxyMaster"
+	har.Log.Creator.Version = "1.0"
+	har.Log.Entries = []harEntry{}
+
+	for _, e := range entries {
+		proto := e.Proto
+		if proto == "" {
+			proto = "HTTP/1.1"
+		}
+		wait := e.WaitMs
+		receive := e.DurationMs - wait
+		if receive < 0 {
+			receive = 0
+		}
+
+		content, contentNote := harResponseContent(e)
+		he := harEntry{
+			StartedDateTime: time.UnixMilli(e.StartedAt).UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+			Time:            e.DurationMs,
+			Request: harRequest{
+				Method:      e.Method,
+				URL:         e.URL,
+				HTTPVersion: proto,
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(e.RequestHeaders),
+				QueryString: harQuery(e.URL),
+				HeadersSize: -1,
+				BodySize:    e.RequestSize,
+			},
+			Response: harResponse{
+				Status:      e.Status,
+				StatusText:  e.StatusText,
+				HTTPVersion: proto,
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(e.ResponseHeaders),
+				Content:     content,
+				RedirectURL: http.Header(e.ResponseHeaders).Get("Location"),
+				HeadersSize: -1,
+				BodySize:    e.ResponseSize,
+			},
+			Timings: harTimings{Send: 0, Wait: wait, Receive: receive},
+		}
+		if e.RequestBody != "" {
+			he.Request.PostData = &harPostData{
+				MimeType: http.Header(e.RequestHeaders).Get("Content-Type"),
+				Text:     e.RequestBody,
+			}
+		}
+
+		var notes []string
+		if e.Kind != connKindHTTP {
+			notes = append(notes, e.Kind+" tunnel via "+e.Upstream)
+		} else {
+			notes = append(notes, "via "+e.Upstream)
+		}
+		if e.BodyTruncated {
+			notes = append(notes, "body truncated")
+		}
+		if contentNote != "" {
+			notes = append(notes, contentNote)
+		}
+		if e.Error != "" {
+			notes = append(notes, "error: "+e.Error)
+		}
+		he.Comment = strings.Join(notes, "; ")
+
+		har.Log.Entries = append(har.Log.Entries, he)
+	}
+
+	return json.MarshalIndent(har, "", "  ")
+}
+
+// 19. 設定請求擷取 (變更容量時清空既有紀錄)
+func (a *App) SetInspector(cfg InspectorConfig) {
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = defaultCaptureCapacity
+	}
+	if cfg.BodyLimit <= 0 {
+		cfg.BodyLimit = defaultCaptureBodyLimit
+	}
+
+	a.inspector.mu.Lock()
+	defer a.inspector.mu.Unlock()
+	if cfg.Capacity != a.inspector.cfg.Capacity {
+		a.inspector.entries = nil
+		a.inspector.next = 0
+	}
+	a.inspector.cfg = cfg
+}
+
+// 19-1. 取得目前的擷取設定
+func (a *App) GetInspectorConfig() InspectorConfig {
+	a.inspector.mu.Lock()
+	defer a.inspector.mu.Unlock()
+	cfg := a.inspector.cfg
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = defaultCaptureCapacity
+	}
+	if cfg.BodyLimit <= 0 {
+		cfg.BodyLimit = defaultCaptureBodyLimit
+	}
+	return cfg
+}
+
+// 19-2. 取得擷取紀錄 (limit <= 0 表示全部)
+func (a *App) GetCapturedRequests(limit int) []CaptureEntry {
+	return a.inspector.list(limit)
+}
+
+// 19-3. 清除擷取紀錄
+func (a *App) ClearCapturedRequests() {
+	a.inspector.mu.Lock()
+	defer a.inspector.mu.Unlock()
+	a.inspector.entries = nil
+	a.inspector.next = 0
+}
+
+// 19-4. 將擷取紀錄匯出為 HAR 檔案
+func (a *App) SaveHARFile(path string) string {
+	data, err := buildHAR(a.inspector.list(0))
+	if err != nil {
+		return fmt.Sprintf("export_failed: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Sprintf("write_failed: %v", err)
+	}
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("HAR exported to %s", path))
+	}
+	return "Success"
+}
+
+// 19-5. 以對話框選擇位置並匯出 HAR
+func (a *App) ExportHAR() string {
+	f, err := wailsRuntime.SaveFileDialog(a.ctx, wailsRuntime.SaveDialogOptions{
+		Title:           "Export HAR",
+		DefaultFilename: fmt.Sprintf("proxymaster-%s.har", time.Now().Format("20060102-150405")),
+		Filters: []wailsRuntime.FileFilter{
+			{DisplayName: "HAR Files", Pattern: "*.har"},
+		},
+	})
+	if err != nil || f == "" {
+		return ""
+	}
+	return a.SaveHARFile(f)
+}
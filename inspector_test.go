@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		writes        []string
+		wantText      string
+		wantEncoding  string
+		wantTruncated bool
+	}{
+		{name: "under limit", limit: 10, writes: []string{"abc", "def"}, wantText: "abcdef"},
+		{name: "exact limit", limit: 6, writes: []string{"abc", "def"}, wantText: "abcdef"},
+		{name: "truncated", limit: 4, writes: []string{"abc", "def", "ghi"}, wantText: "abcd", wantTruncated: true},
+		{name: "utf-8", limit: 64, writes: []string{"你好"}, wantText: "你好"},
+		{name: "binary", limit: 64, writes: []string{"\x1f\x8b\x08\x00\xff"}, wantText: base64.StdEncoding.EncodeToString([]byte("\x1f\x8b\x08\x00\xff")), wantEncoding: "base64"},
+		{name: "empty", limit: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tt.limit}
+			for _, w := range tt.writes {
+				b.add([]byte(w))
+			}
+			text, enc, truncated := b.text()
+			if text != tt.wantText || enc != tt.wantEncoding || truncated != tt.wantTruncated {
+				t.Errorf("text() = %q, %q, %v, want %q, %q, %v", text, enc, truncated, tt.wantText, tt.wantEncoding, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{
+		"Proxy-Authorization": {"Basic c2VjcmV0"},
+		"Accept":              {"a", "b"},
+	}
+	got := redactHeaders(h)
+	want := map[string][]string{"Proxy-Authorization": {"[redacted]"}, "Accept": {"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactHeaders() = %v, want %v", got, want)
+	}
+	got["Accept"][0] = "changed"
+	if h.Get("Accept") != "a" {
+		t.Error("redactHeaders() shares value slices with the original header")
+	}
+	if redactHeaders(nil) != nil {
+		t.Error("redactHeaders(nil) != nil")
+	}
+}
+
+func TestInspectorRing(t *testing.T) {
+	ins := &inspector{cfg: InspectorConfig{Enabled: true, Capacity: 3}}
+	for i := 0; i < 5; i++ {
+		ins.begin(connKindHTTP, "GET", "http://example.com/"+string(rune('a'+i)), "127.0.0.1", "DIRECT", nil).finish(nil)
+	}
+
+	var urls []string
+	for _, e := range ins.list(0) {
+		urls = append(urls, e.URL)
+	}
+	want := []string{"http://example.com/c", "http://example.com/d", "http://example.com/e"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("list() = %v, want %v", urls, want)
+	}
+	if got := ins.list(2); len(got) != 2 || got[1].URL != "http://example.com/e" {
+		t.Errorf("list(2) = %+v, want the newest two", got)
+	}
+
+	ins.cfg.Enabled = false
+	if rec := ins.begin(connKindHTTP, "GET", "http://example.com/", "", "", nil); rec != nil {
+		t.Error("begin() recorded while disabled")
+	}
+	// 停用時回傳的 nil 紀錄可安全使用
+	var rec *captureRecord
+	rec.response(&http.Response{})
+	rec.status(200)
+	rec.fail(errors.New("x"))
+	rec.finish(nil)
+	if rec.requestBody(http.NoBody) != http.NoBody {
+		t.Error("nil record wrapped the body")
+	}
+}
+
+func TestCaptureRecord(t *testing.T) {
+	ins := &inspector{cfg: InspectorConfig{Enabled: true, CaptureBodies: true, BodyLimit: 8}}
+	rec := ins.begin(connKindHTTP, "POST", "http://example.com/api?q=1", "127.0.0.1", "DIRECT",
+		http.Header{"Content-Type": {"application/json"}})
+
+	io.ReadAll(rec.requestBody(io.NopCloser(strings.NewReader(`{"a":1}`))))
+	rec.response(&http.Response{StatusCode: 201, Status: "201 Created", Proto: "HTTP/1.1",
+		Header: http.Header{"Content-Type": {"text/plain"}}})
+	io.ReadAll(rec.responseBody(io.NopCloser(strings.NewReader("response body longer than limit"))))
+
+	var ts trafficStats
+	flow := ts.begin("example.com", "DIRECT")
+	flow.addUp(7)
+	flow.addDown(31)
+	rec.finish(flow)
+
+	e := ins.list(0)[0]
+	if e.Status != 201 || e.StatusText != "Created" || !e.Done {
+		t.Errorf("status = %d %q done=%v", e.Status, e.StatusText, e.Done)
+	}
+	if e.RequestBody != `{"a":1}` || e.ResponseBody != "response" || !e.BodyTruncated {
+		t.Errorf("bodies = %q / %q truncated=%v", e.RequestBody, e.ResponseBody, e.BodyTruncated)
+	}
+	if e.RequestSize != 7 || e.ResponseSize != 31 {
+		t.Errorf("sizes = %d/%d, want 7/31", e.RequestSize, e.ResponseSize)
+	}
+
+	// 通道不擷取本體
+	tunnel := ins.begin(connKindConnect, "CONNECT", "example.com:443", "127.0.0.1", "DIRECT", nil)
+	body := io.NopCloser(strings.NewReader("x"))
+	if tunnel.requestBody(body) != body {
+		t.Error("tunnel body was wrapped")
+	}
+	tunnel.status(http.StatusOK)
+	tunnel.fail(errors.New("reset"))
+	tunnel.finish(nil)
+	if e := ins.list(0)[1]; e.StatusText != "OK" || e.Error != "reset" {
+		t.Errorf("tunnel entry = %+v", e)
+	}
+}
+
+func TestBuildHAR(t *testing.T) {
+	entries := []CaptureEntry{
+		{
+			ID: 1, Kind: connKindHTTP, StartedAt: 1700000000123, Method: "POST", URL: "http://example.com/p?b=2&a=1",
+			Upstream: "DIRECT", Status: 302, StatusText: "Found", Proto: "HTTP/1.1",
+			RequestHeaders:  map[string][]string{"Content-Type": {"application/json"}, "Accept": {"*/*"}},
+			ResponseHeaders: map[string][]string{"Content-Type": {"text/html"}, "Location": {"/next"}},
+			RequestSize:     7, ResponseSize: 5, RequestBody: `{"a":1}`, ResponseBody: "hello",
+			WaitMs: 40, DurationMs: 100, BodyTruncated: true, Done: true,
+		},
+		{
+			ID: 2, Kind: connKindConnect, StartedAt: 1700000000500, Method: "CONNECT", URL: "example.com:443",
+			Upstream: "http://10.0.0.1:8080", Status: 200, StatusText: "OK",
+			ResponseBody: "AAEC", ResponseBodyEncoding: "base64", WaitMs: 50, DurationMs: 20, Error: "reset",
+		},
+	}
+	data, err := buildHAR(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("invalid HAR JSON: %v", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("log = %+v", har.Log)
+	}
+
+	e := har.Log.Entries[0]
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"startedDateTime", e.StartedDateTime, "2023-11-14T22:13:20.123Z"},
+		{"query", e.Request.QueryString, []harNameValue{{"a", "1"}, {"b", "2"}}},
+		{"request headers sorted", e.Request.Headers, []harNameValue{{"Accept", "*/*"}, {"Content-Type", "application/json"}}},
+		{"post data", *e.Request.PostData, harPostData{MimeType: "application/json", Text: `{"a":1}`}},
+		{"content", e.Response.Content, harContent{Size: 5, MimeType: "text/html", Text: "hello"}},
+		{"redirect", e.Response.RedirectURL, "/next"},
+		{"timings", e.Timings, harTimings{Wait: 40, Receive: 60}},
+		{"comment", e.Comment, "via DIRECT; body truncated"},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	tunnel := har.Log.Entries[1]
+	if tunnel.Request.PostData != nil || tunnel.Request.HTTPVersion != "HTTP/1.1" {
+		t.Errorf("tunnel request = %+v", tunnel.Request)
+	}
+	if tunnel.Response.Content.Encoding != "base64" || tunnel.Timings.Receive != 0 {
+		t.Errorf("tunnel response = %+v timings = %+v", tunnel.Response.Content, tunnel.Timings)
+	}
+	if tunnel.Comment != "connect tunnel via http://10.0.0.1:8080; error: reset" {
+		t.Errorf("tunnel comment = %q", tunnel.Comment)
+	}
+
+	// 空紀錄仍需輸出 entries 陣列
+	data, _ = buildHAR(nil)
+	if !strings.Contains(string(data), `"entries": []`) {
+		t.Errorf("empty HAR = %s", data)
+	}
+}
+
+func TestHARResponseContent(t *testing.T) {
+	compress := func(w io.WriteCloser, buf *bytes.Buffer, data string) []byte {
+		io.WriteString(w, data)
+		w.Close()
+		return buf.Bytes()
+	}
+	var gzBuf, zlBuf, flBuf bytes.Buffer
+	gz := compress(gzip.NewWriter(&gzBuf), &gzBuf, strings.Repeat("hello ", 100))
+	zl := compress(zlib.NewWriter(&zlBuf), &zlBuf, "zlib body")
+	fw, _ := flate.NewWriter(&flBuf, flate.DefaultCompression)
+	fl := compress(fw, &flBuf, "raw deflate")
+	b64 := base64.StdEncoding.EncodeToString
+
+	tests := []struct {
+		name      string
+		encoding  string
+		body      []byte
+		truncated bool
+		want      harContent
+		note      string
+	}{
+		{name: "identity", body: []byte("plain"), want: harContent{Size: 5, Text: "plain"}},
+		{
+			name: "gzip", encoding: "gzip", body: gz,
+			want: harContent{Size: 600, Compression: 600 - int64(len(gz)), Text: strings.Repeat("hello ", 100)},
+		},
+		{
+			name: "zlib deflate", encoding: "Deflate", body: zl,
+			want: harContent{Size: 9, Compression: 9 - int64(len(zl)), Text: "zlib body"},
+		},
+		{
+			name: "raw deflate", encoding: "deflate", body: fl,
+			want: harContent{Size: 11, Compression: 11 - int64(len(fl)), Text: "raw deflate"},
+		},
+		{
+			name: "brotli kept as base64", encoding: "br", body: []byte{0x1b, 0x03},
+			want: harContent{Size: 2, Text: b64([]byte{0x1b, 0x03}), Encoding: "base64"},
+			note: "content-encoding br not decoded",
+		},
+		{
+			name: "corrupt gzip kept as base64", encoding: "gzip", body: []byte("not gzip"),
+			want: harContent{Size: 8, Text: b64([]byte("not gzip")), Encoding: "base64"},
+			note: "content-encoding gzip not decoded",
+		},
+		{
+			// 截斷的本體保留已解壓縮的部分，大小維持傳輸量
+			name: "truncated gzip", encoding: "gzip", body: gz[:len(gz)-8], truncated: true,
+			want: harContent{Size: int64(len(gz) - 8), Text: strings.Repeat("hello ", 100)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := CaptureEntry{ResponseSize: int64(len(tt.body)), ResponseHeaders: map[string][]string{}, BodyTruncated: tt.truncated}
+			if tt.encoding != "" {
+				e.ResponseHeaders["Content-Encoding"] = []string{tt.encoding}
+			}
+			var lb limitedBuffer
+			lb.limit = len(tt.body)
+			lb.add(tt.body)
+			e.ResponseBody, e.ResponseBodyEncoding, _ = lb.text()
+
+			got, note := harResponseContent(e)
+			if !reflect.DeepEqual(got, tt.want) || note != tt.note {
+				t.Errorf("harResponseContent() = %+v, %q, want %+v, %q", got, note, tt.want, tt.note)
+			}
+		})
+	}
+}
+
+func TestSaveHARFile(t *testing.T) {
+	a := &App{}
+	a.SetInspector(InspectorConfig{Enabled: true})
+	a.inspector.begin(connKindHTTP, "GET", "http://example.com/", "127.0.0.1", "DIRECT", nil).finish(nil)
+
+	path := filepath.Join(t.TempDir(), "out.har")
+	if got := a.SaveHARFile(path); got != "Success" {
+		t.Fatalf("SaveHARFile() = %q", got)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `"url": "http://example.com/"`) {
+		t.Errorf("HAR file = %s, %v", data, err)
+	}
+	if got := a.SaveHARFile(filepath.Join(t.TempDir(), "missing", "out.har")); !strings.HasPrefix(got, "write_failed") {
+		t.Errorf("SaveHARFile(bad path) = %q", got)
+	}
+}
+
+func TestSetInspector(t *testing.T) {
+	a := &App{}
+	if cfg := a.GetInspectorConfig(); cfg.Capacity != defaultCaptureCapacity || cfg.BodyLimit != defaultCaptureBodyLimit {
+		t.Errorf("default config = %+v", cfg)
+	}
+	a.SetInspector(InspectorConfig{Enabled: true, Capacity: 10})
+	a.inspector.begin(connKindHTTP, "GET", "http://a/", "", "", nil)
+	a.SetInspector(InspectorConfig{Enabled: true, Capacity: 10, CaptureBodies: true})
+	if n := len(a.GetCapturedRequests(0)); n != 1 {
+		t.Errorf("entries after same-capacity change = %d, want 1", n)
+	}
+	a.SetInspector(InspectorConfig{Enabled: true, Capacity: 20})
+	if n := len(a.GetCapturedRequests(0)); n != 0 {
+		t.Errorf("entries after capacity change = %d, want 0", n)
+	}
+	a.inspector.begin(connKindHTTP, "GET", "http://a/", "", "", nil)
+	a.ClearCapturedRequests()
+	if n := len(a.GetCapturedRequests(0)); n != 0 {
+		t.Errorf("entries after clear = %d, want 0", n)
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- 區域網路分享 (LAN Sharing) ----------------
+
+// LANConfig 區域網路分享設定
+type LANConfig struct {
+	Enabled    bool     `json:"enabled"`
+	ListenAddr string   `json:"listenAddr"` // 綁定的位址，留空為 0.0.0.0
+	AllowCIDRs []string `json:"allowCidrs"` // 允許的客戶端網段，留空則允許私有網段
+	Username   string   `json:"username,omitempty"`
+	Password   string   `json:"password,omitempty"`
+}
+
+// ClientInfo 目前連線中的客戶端
+type ClientInfo struct {
+	Addr        string `json:"addr"`
+	Connections int    `json:"connections"`
+	ConnectedAt int64  `json:"connectedAt"` // Unix 毫秒
+	LastSeen    int64  `json:"lastSeen"`    // Unix 毫秒
+}
+
+// LANStatus 提供給前端的分享狀態 (不含密碼)
+type LANStatus struct {
+	Enabled      bool         `json:"enabled"`
+	ListenAddr   string       `json:"listenAddr"`
+	AllowCIDRs   []string     `json:"allowCidrs"`
+	AuthRequired bool         `json:"authRequired"`
+	HTTPPort     string       `json:"httpPort"`
+	SocksPort    string       `json:"socksPort"`
+	IPv6Loopback bool         `json:"ipv6Loopback"`
+	Clients      []ClientInfo `json:"clients"`
+}
+
+// 連線中客戶端的統計 (以來源 IP 為單位)
+type clientTracker struct {
+	mu      sync.Mutex
+	clients map[string]*ClientInfo
+}
+
+func (t *clientTracker) add(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.clients == nil {
+		t.clients = make(map[string]*ClientInfo)
+	}
+	now := time.Now().UnixMilli()
+	c := t.clients[ip]
+	if c == nil {
+		c = &ClientInfo{Addr: ip, ConnectedAt: now}
+		t.clients[ip] = c
+	}
+	c.Connections++
+	c.LastSeen = now
+}
+
+func (t *clientTracker) remove(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.clients[ip]
+	if c == nil {
+		return
+	}
+	c.Connections--
+	c.LastSeen = time.Now().UnixMilli()
+	if c.Connections <= 0 {
+		delete(t.clients, ip)
+	}
+}
+
+func (t *clientTracker) list() []ClientInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]ClientInfo, 0, len(t.clients))
+	for _, c := range t.clients {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Addr < result[j].Addr })
+	return result
+}
+
+// trackedListener 記錄每個入站連線的來源，連線關閉時移除
+type trackedListener struct {
+	net.Listener
+	tracker *clientTracker
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	ip := remoteIP(conn.RemoteAddr())
+	l.tracker.add(ip)
+	return &trackedConn{Conn: conn, tracker: l.tracker, ip: ip}, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *clientTracker
+	ip      string
+	once    sync.Once
+}
+
+func (c *trackedConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.tracker.remove(c.ip) })
+	return c.Conn.Close()
+}
+
+// 取出位址中的 IP (不含端口)
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// 解析允許清單，單一 IP 視為 /32 或 /128
+func parseAllowCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// 本地中轉與 SOCKS5 入站的綁定位址
+// 呼叫者需持有 a.mu
+func (a *App) bindAddrLocked() string {
+	if !a.lan.Enabled {
+		return "127.0.0.1"
+	}
+	if a.lan.ListenAddr == "" {
+		return "0.0.0.0"
+	}
+	return a.lan.ListenAddr
+}
+
+// 實際監聽的位址列表
+// 啟用 IPv6 loopback 時，本機模式額外監聽 ::1，全部介面則改為雙堆疊
+// 呼叫者需持有 a.mu
+func (a *App) listenAddrsLocked() []string {
+	bind := a.bindAddrLocked()
+	if !a.ipv6Loopback {
+		return []string{bind}
+	}
+	if bind == "0.0.0.0" {
+		return []string{""}
+	}
+	if ip := net.ParseIP(bind); ip != nil && ip.To4() == nil {
+		return []string{bind} // 已是 IPv6 位址
+	}
+	return []string{bind, "::1"}
+}
+
+// 在多個位址上監聽同一端口，任一失敗則全部關閉
+func listenTCP(addrs []string, port string) (net.Listener, error) {
+	if len(addrs) == 1 {
+		return net.Listen("tcp", net.JoinHostPort(addrs[0], port))
+	}
+	ml := &multiListener{
+		conns: make(chan net.Conn),
+		errs:  make(chan error, len(addrs)),
+		done:  make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		ln, err := net.Listen("tcp", net.JoinHostPort(addr, port))
+		if err != nil {
+			ml.Close()
+			return nil, err
+		}
+		ml.listeners = append(ml.listeners, ln)
+	}
+	for _, ln := range ml.listeners {
+		go ml.serve(ln)
+	}
+	return ml, nil
+}
+
+// multiListener 將多個 Listener 合併為一個 (Addr 回傳第一個)
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	once      sync.Once
+}
+
+func (l *multiListener) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+			}
+			return
+		}
+		select {
+		case l.conns <- conn:
+		case <-l.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (l *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *multiListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+		for _, ln := range l.listeners {
+			ln.Close()
+		}
+	})
+	return nil
+}
+
+func (l *multiListener) Addr() net.Addr {
+	return l.listeners[0].Addr()
+}
+
+// 本機連到中轉使用的位址 (綁定特定介面時無法經由 127.0.0.1 連線)
+func (a *App) localProxyHost() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	bind := net.ParseIP(a.bindAddrLocked())
+	if bind == nil || bind.IsUnspecified() {
+		return "127.0.0.1"
+	}
+	return bind.String()
+}
+
+// 判斷來源位址是否允許連線：本機一律允許，其餘需符合允許清單
+func (a *App) clientAllowed(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+
+	a.mu.RLock()
+	enabled := a.lan.Enabled
+	allow := a.lanAllow
+	a.mu.RUnlock()
+
+	if !enabled {
+		return false
+	}
+	if len(allow) == 0 {
+		return ip.IsPrivate() || ip.IsLinkLocalUnicast()
+	}
+	for _, n := range allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 取得來源位址需要的入站帳密，本機客戶端不需認證
+func (a *App) inboundCredentials(addr string) (string, string) {
+	if ip := net.ParseIP(addr); ip != nil && ip.IsLoopback() {
+		return "", ""
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.lan.Enabled {
+		return "", ""
+	}
+	return a.lan.Username, a.lan.Password
+}
+
+// 驗證 HTTP 入站請求的 Proxy-Authorization (Basic)
+func checkProxyAuthorization(r *http.Request, user, pass string) bool {
+	auth := r.Header.Get("Proxy-Authorization")
+	scheme, encoded, ok := strings.Cut(auth, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return false
+	}
+	u, p, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(p), []byte(pass)) == 1
+}
+
+// 14. 設定區域網路分享 (會重啟本地中轉，連線中則自動重新套用)
+func (a *App) SetLANSharing(cfg LANConfig) string {
+	cfg.ListenAddr = strings.TrimSpace(cfg.ListenAddr)
+	if cfg.ListenAddr != "" && net.ParseIP(cfg.ListenAddr) == nil {
+		return "invalid_listen_addr"
+	}
+	allow, err := parseAllowCIDRs(cfg.AllowCIDRs)
+	if err != nil {
+		return fmt.Sprintf("invalid_allowlist: %v", err)
+	}
+	if cfg.Username == "" {
+		cfg.Password = ""
+	}
+
+	a.mu.Lock()
+	a.lan = cfg
+	a.lanAllow = allow
+	a.closeAllConnections()
+	if a.localServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+		a.localServer.Shutdown(ctx)
+		a.localServer = nil
+	}
+	a.stopSocksServerLocked()
+	connected := a.activeRemote != nil || a.activeGroup != ""
+	a.mu.Unlock()
+
+	if a.ctx != nil {
+		if cfg.Enabled {
+			wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("LAN sharing enabled on %s (allow: %v, auth: %v)",
+				a.localProxyHost(), cfg.AllowCIDRs, cfg.Username != ""))
+		} else {
+			wailsRuntime.LogInfo(a.ctx, "LAN sharing disabled")
+		}
+	}
+
+	if connected {
+		return a.activateLocalProxy()
+	}
+	return "Success"
+}
+
+// 14-1. 取得區域網路分享狀態與目前連線中的客戶端
+func (a *App) GetLANStatus() LANStatus {
+	a.mu.RLock()
+	status := LANStatus{
+		Enabled:      a.lan.Enabled,
+		ListenAddr:   a.bindAddrLocked(),
+		AllowCIDRs:   append([]string{}, a.lan.AllowCIDRs...),
+		AuthRequired: a.lan.Enabled && a.lan.Username != "",
+		HTTPPort:     a.localPort,
+		SocksPort:    a.socksPort,
+		IPv6Loopback: a.ipv6Loopback,
+	}
+	a.mu.RUnlock()
+
+	status.Clients = a.clients.list()
+	return status
+}
+
+// 14-2. 設定是否同時監聽 IPv6 loopback (::1)，會重啟本地中轉
+func (a *App) SetIPv6Loopback(enabled bool) string {
+	a.mu.Lock()
+	if a.ipv6Loopback == enabled {
+		a.mu.Unlock()
+		return "Success"
+	}
+	a.ipv6Loopback = enabled
+	a.closeAllConnections()
+	if a.localServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+		a.localServer.Shutdown(ctx)
+		a.localServer = nil
+	}
+	a.stopSocksServerLocked()
+	connected := a.activeRemote != nil || a.activeGroup != ""
+	a.mu.Unlock()
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("IPv6 loopback listener: %v", enabled))
+	}
+	if connected {
+		return a.activateLocalProxy()
+	}
+	return "Success"
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseAllowCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", in: nil, want: nil},
+		{name: "cidr", in: []string{"192.168.1.0/24", " 10.0.0.0/8 "}, want: []string{"192.168.1.0/24", "10.0.0.0/8"}},
+		{name: "normalizes host bits", in: []string{"192.168.1.77/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "single ipv4", in: []string{"192.168.1.5"}, want: []string{"192.168.1.5/32"}},
+		{name: "single ipv6", in: []string{"fd00::1"}, want: []string{"fd00::1/128"}},
+		{name: "skips blanks", in: []string{"", "  ", "10.0.0.0/8"}, want: []string{"10.0.0.0/8"}},
+		{name: "bad ip", in: []string{"192.168.1"}, wantErr: true},
+		{name: "bad cidr", in: []string{"10.0.0.0/40"}, wantErr: true},
+		{name: "hostname", in: []string{"router.lan"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets, err := parseAllowCIDRs(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAllowCIDRs(%q) = %v, want error", tt.in, nets)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAllowCIDRs(%q) error: %v", tt.in, err)
+			}
+			var got []string
+			for _, n := range nets {
+				got = append(got, n.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAllowCIDRs(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientAllowed(t *testing.T) {
+	allow, err := parseAllowCIDRs([]string{"192.168.1.0/24", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		enabled bool
+		allow   []*net.IPNet
+		addr    string
+		want    bool
+	}{
+		{name: "loopback when disabled", addr: "127.0.0.1", want: true},
+		{name: "loopback v6", addr: "::1", want: true},
+		{name: "lan when disabled", addr: "192.168.1.10", want: false},
+		{name: "default private", enabled: true, addr: "10.1.2.3", want: true},
+		{name: "default link-local", enabled: true, addr: "169.254.1.1", want: true},
+		{name: "default public", enabled: true, addr: "8.8.8.8", want: false},
+		{name: "listed", enabled: true, allow: allow, addr: "192.168.1.10", want: true},
+		{name: "listed v6", enabled: true, allow: allow, addr: "fd12::5", want: true},
+		{name: "private but unlisted", enabled: true, allow: allow, addr: "192.168.2.10", want: false},
+		{name: "loopback with allowlist", enabled: true, allow: allow, addr: "127.0.0.1", want: true},
+		{name: "not an ip", enabled: true, addr: "pipe", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{lan: LANConfig{Enabled: tt.enabled}, lanAllow: tt.allow}
+			if got := a.clientAllowed(tt.addr); got != tt.want {
+				t.Errorf("clientAllowed(%q) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInboundCredentials(t *testing.T) {
+	lan := LANConfig{Enabled: true, Username: "u", Password: "p"}
+	tests := []struct {
+		name     string
+		cfg      LANConfig
+		addr     string
+		wantUser string
+	}{
+		{name: "lan client", cfg: lan, addr: "192.168.1.10", wantUser: "u"},
+		{name: "loopback exempt", cfg: lan, addr: "127.0.0.1"},
+		{name: "sharing disabled", cfg: LANConfig{Username: "u", Password: "p"}, addr: "192.168.1.10"},
+	}
+	for _, tt := range tests {
+		a := &App{lan: tt.cfg}
+		if user, _ := a.inboundCredentials(tt.addr); user != tt.wantUser {
+			t.Errorf("%s: inboundCredentials(%q) user = %q, want %q", tt.name, tt.addr, user, tt.wantUser)
+		}
+	}
+}
+
+func TestCheckProxyAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "valid", header: basicAuth("alice", "s3cret:x"), want: true},
+		{name: "scheme case", header: "basic " + basicAuth("alice", "s3cret:x")[len("Basic "):], want: true},
+		{name: "wrong password", header: basicAuth("alice", "nope"), want: false},
+		{name: "wrong user", header: basicAuth("bob", "s3cret:x"), want: false},
+		{name: "missing", header: "", want: false},
+		{name: "bearer", header: "Bearer abc", want: false},
+		{name: "bad base64", header: "Basic !!!", want: false},
+		{name: "no colon", header: "Basic YWxpY2U=", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/", nil)
+			if tt.header != "" {
+				r.Header.Set("Proxy-Authorization", tt.header)
+			}
+			if got := checkProxyAuthorization(r, "alice", "s3cret:x"); got != tt.want {
+				t.Errorf("checkProxyAuthorization(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientTracker(t *testing.T) {
+	var tr clientTracker
+	tr.add("192.168.1.20")
+	tr.add("192.168.1.10")
+	tr.add("192.168.1.10")
+
+	list := tr.list()
+	if len(list) != 2 || list[0].Addr != "192.168.1.10" || list[0].Connections != 2 || list[1].Connections != 1 {
+		t.Fatalf("list() = %+v", list)
+	}
+
+	tr.remove("192.168.1.10")
+	tr.remove("192.168.1.20")
+	tr.remove("10.0.0.1") // 未追蹤的位址不影響
+	list = tr.list()
+	if len(list) != 1 || list[0].Addr != "192.168.1.10" || list[0].Connections != 1 {
+		t.Fatalf("list() after remove = %+v", list)
+	}
+}
+
+func TestTrackedListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tr clientTracker
+	tl := &trackedListener{Listener: ln, tracker: &tr}
+	defer tl.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := tl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := tr.list(); len(list) != 1 || list[0].Addr != "127.0.0.1" {
+		t.Fatalf("list() = %+v, want 127.0.0.1", list)
+	}
+	conn.Close()
+	conn.Close() // 重複關閉只扣一次
+	if list := tr.list(); len(list) != 0 {
+		t.Fatalf("list() after close = %+v, want empty", list)
+	}
+}
+
+func TestLocalProxyHost(t *testing.T) {
+	tests := []struct {
+		cfg      LANConfig
+		wantBind string
+		wantHost string
+	}{
+		{cfg: LANConfig{}, wantBind: "127.0.0.1", wantHost: "127.0.0.1"},
+		{cfg: LANConfig{Enabled: true}, wantBind: "0.0.0.0", wantHost: "127.0.0.1"},
+		{cfg: LANConfig{Enabled: true, ListenAddr: "192.168.1.2"}, wantBind: "192.168.1.2", wantHost: "192.168.1.2"},
+		{cfg: LANConfig{ListenAddr: "192.168.1.2"}, wantBind: "127.0.0.1", wantHost: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		a := &App{lan: tt.cfg}
+		if got := a.bindAddrLocked(); got != tt.wantBind {
+			t.Errorf("%+v: bindAddrLocked() = %q, want %q", tt.cfg, got, tt.wantBind)
+		}
+		if got := a.localProxyHost(); got != tt.wantHost {
+			t.Errorf("%+v: localProxyHost() = %q, want %q", tt.cfg, got, tt.wantHost)
+		}
+	}
+}
+
+func TestSetLANSharingValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  LANConfig
+		want string
+	}{
+		{name: "bad listen addr", cfg: LANConfig{Enabled: true, ListenAddr: "lan0"}, want: "invalid_listen_addr"},
+		{name: "bad allowlist", cfg: LANConfig{Enabled: true, AllowCIDRs: []string{"x"}}, want: `invalid_allowlist: invalid address "x"`},
+		{name: "ok", cfg: LANConfig{Enabled: true, ListenAddr: " 0.0.0.0 ", AllowCIDRs: []string{"10.0.0.0/8"}, Password: "orphan"}, want: "Success"},
+	}
+	for _, tt := range tests {
+		a := &App{}
+		if got := a.SetLANSharing(tt.cfg); got != tt.want {
+			t.Errorf("%s: SetLANSharing() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	a := &App{}
+	a.SetLANSharing(LANConfig{Enabled: true, Password: "orphan"})
+	if a.lan.Password != "" {
+		t.Error("password kept without a username")
+	}
+	if st := a.GetLANStatus(); !st.Enabled || st.AuthRequired || st.ListenAddr != "0.0.0.0" {
+		t.Errorf("GetLANStatus() = %+v", st)
+	}
+}
+
+func TestListenAddrs(t *testing.T) {
+	tests := []struct {
+		cfg  LANConfig
+		ipv6 bool
+		want []string
+	}{
+		{cfg: LANConfig{}, want: []string{"127.0.0.1"}},
+		{cfg: LANConfig{}, ipv6: true, want: []string{"127.0.0.1", "::1"}},
+		{cfg: LANConfig{Enabled: true}, want: []string{"0.0.0.0"}},
+		{cfg: LANConfig{Enabled: true}, ipv6: true, want: []string{""}},
+		{cfg: LANConfig{Enabled: true, ListenAddr: "192.168.1.2"}, ipv6: true, want: []string{"192.168.1.2", "::1"}},
+		{cfg: LANConfig{Enabled: true, ListenAddr: "fd00::2"}, ipv6: true, want: []string{"fd00::2"}},
+	}
+	for _, tt := range tests {
+		a := &App{lan: tt.cfg, ipv6Loopback: tt.ipv6}
+		if got := a.listenAddrsLocked(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v ipv6=%v: listenAddrsLocked() = %q, want %q", tt.cfg, tt.ipv6, got, tt.want)
+		}
+	}
+}
+
+// 同一端口同時監聽 IPv4 與 IPv6 loopback，兩邊的連線都由同一個 Listener 交出
+func TestListenTCPMulti(t *testing.T) {
+	probe, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback unavailable")
+	}
+	probe.Close()
+
+	// 端口 0 在兩個位址上會各自分配，先取得一個空閒端口
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(first.Addr().String())
+	first.Close()
+
+	ln, err := listenTCP([]string{"127.0.0.1", "::1"}, port)
+	if err != nil {
+		t.Skipf("port %s taken: %v", port, err)
+	}
+	if ln.Addr().String() != net.JoinHostPort("127.0.0.1", port) {
+		t.Errorf("Addr() = %s", ln.Addr())
+	}
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		c, err := net.Dial("tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := remoteIP(conn.RemoteAddr()); got != host {
+			t.Errorf("accepted from %s, want %s", got, host)
+		}
+		conn.Close()
+		c.Close()
+	}
+
+	ln.Close()
+	ln.Close()
+	if _, err := ln.Accept(); err == nil {
+		t.Error("Accept() after Close succeeded")
+	}
+	if _, err := net.Dial("tcp", net.JoinHostPort("::1", port)); err == nil {
+		t.Error("IPv6 listener still open after Close")
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- DNS 洩漏測試 ----------------
+
+const (
+	defaultLeakLookups   = 6
+	maxLeakLookups       = 32
+	leakLookupTimeout    = 5 * time.Second
+	leakResultSettleTime = time.Second // 等待服務端記錄查詢
+	leakStandInDomain    = "leak.test"
+)
+
+// LeakTestConfig 洩漏測試服務設定 ({session} 與 {n} 會被替換)
+// 預設為 bash.ws；結果需為 JSON 陣列，type 為 "dns" 的項目視為解析器
+type LeakTestConfig struct {
+	SessionURL string `json:"sessionUrl"` // 取得工作階段 ID，空白時自行產生
+	LookupHost string `json:"lookupHost"` // 例如 {n}.{session}.bash.ws
+	ResultURL  string `json:"resultUrl"`  // 例如 https://bash.ws/dnsleak/test/{session}?json
+	Lookups    int    `json:"lookups"`
+}
+
+// LeakResolver 測試服務觀察到的解析器
+type LeakResolver struct {
+	IP           string `json:"ip"`
+	Country      string `json:"country"`
+	ASN          string `json:"asn"`
+	LocalNetwork bool   `json:"localNetwork"` // 屬於本機網路 (私有位址或本機介面所在網段)
+	MatchesExit  bool   `json:"matchesExit"`  // 與出口 IP 相同
+	// 與出口 IP 同 ASN 或同國家 (服務未提供出口資訊時為 false)
+	MatchesExitNetwork bool `json:"matchesExitNetwork"`
+}
+
+// LeakTestResult 洩漏測試結果
+type LeakTestResult struct {
+	Session   string         `json:"session"`
+	Lookups   int            `json:"lookups"`
+	ExitIP    string         `json:"exitIp"`
+	Resolvers []LeakResolver `json:"resolvers"`
+	// leak: 有本機網路的解析器；suspect: 有解析器與出口 IP、ASN、國家都不同
+	Verdict     string `json:"verdict"` // ok / suspect / leak / inconclusive
+	ExitCountry string `json:"exitCountry,omitempty"`
+	ExitASN     string `json:"exitAsn,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func defaultLeakTestConfig() LeakTestConfig {
+	return LeakTestConfig{
+		SessionURL: "https://bash.ws/id",
+		LookupHost: "{n}.{session}.bash.ws",
+		ResultURL:  "https://bash.ws/dnsleak/test/{session}?json",
+		Lookups:    defaultLeakLookups,
+	}
+}
+
+// 透過本地中轉發送請求的 client
+func (a *App) middlewareClient(timeout time.Duration) (*http.Client, error) {
+	a.mu.RLock()
+	port := a.localPort
+	running := a.localServer != nil
+	a.mu.RUnlock()
+	if !running {
+		return nil, fmt.Errorf("local server not running")
+	}
+
+	proxyURL := &url.URL{Scheme: "http", Host: net.JoinHostPort(a.localProxyHost(), port)}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxyURL),
+			DisableKeepAlives: true,
+		},
+		Timeout: timeout,
+	}, nil
+}
+
+// 取得工作階段與結果用的 client
+// 服務位於本機 (測試服務) 時直接連線，經中轉可能被 PROXY 規則送往遠端而連不到
+func leakServiceClient(rawURL string, middleware *http.Client) *http.Client {
+	if u, err := url.Parse(rawURL); err == nil && isLoopbackHost(u.Hostname()) {
+		return &http.Client{
+			Transport: &http.Transport{Proxy: nil, DisableKeepAlives: true},
+			Timeout:   middleware.Timeout,
+		}
+	}
+	return middleware
+}
+
+// 測試服務只能經由 DoH 觀察到中轉的查詢 (系統解析器不會轉送 leak.test)
+// 查詢測試服務的網域時，DNS 策略的 DoH 位址必須指向該服務 (doh 模式，或 remote 模式的 DIRECT 規則)
+func (a *App) checkLeakStandIn(lookupHost string) error {
+	host, _, err := net.SplitHostPort(lookupHost)
+	if err != nil {
+		host = lookupHost
+	}
+	if !strings.HasSuffix(strings.ToLower(host), "."+leakStandInDomain) {
+		return nil
+	}
+
+	a.mu.RLock()
+	s := a.leakService
+	a.mu.RUnlock()
+	if s == nil {
+		return fmt.Errorf("leak test service not running")
+	}
+	a.dns.mu.Lock()
+	policy := a.dns.policy
+	a.dns.mu.Unlock()
+	if policy.Mode == "" || policy.Mode == dnsModeSystem || policy.DoHURL != s.dohURL {
+		return fmt.Errorf("DNS policy must use DoH via %s", s.dohURL)
+	}
+	return nil
+}
+
+// 隨機子網域標籤，無法取得亂數時改用時間戳 (仍可區分不同次測試)
+func randomLabel() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// 位址是否屬於本機網路: 私有、迴路、鏈路本地位址，或與本機介面在同一網段
+func isLocalNetworkIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if n, ok := addr.(*net.IPNet); ok && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析測試服務的結果 (bash.ws 格式)
+// type 為 "ip" 的項目是服務看到的出口位址，回傳其國家與 ASN 供比對
+func parseLeakResults(data []byte) (LeakResolver, []LeakResolver, error) {
+	var entries []struct {
+		IP          string `json:"ip"`
+		Country     string `json:"country"`
+		CountryName string `json:"country_name"`
+		ASN         string `json:"asn"`
+		Type        string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return LeakResolver{}, nil, err
+	}
+
+	var exit LeakResolver
+	seen := make(map[string]bool)
+	var resolvers []LeakResolver
+	for _, e := range entries {
+		if net.ParseIP(e.IP) == nil {
+			continue
+		}
+		country := e.Country
+		if country == "" {
+			country = e.CountryName
+		}
+		switch {
+		case e.Type == "ip" && exit.IP == "":
+			exit = LeakResolver{IP: e.IP, Country: country, ASN: e.ASN}
+		case e.Type == "dns" && !seen[e.IP]:
+			seen[e.IP] = true
+			resolvers = append(resolvers, LeakResolver{IP: e.IP, Country: country, ASN: e.ASN})
+		}
+	}
+	return exit, resolvers, nil
+}
+
+// 依解析器與出口位址的關係判定結果
+func leakVerdict(resolvers []LeakResolver) string {
+	verdict := "inconclusive"
+	for _, r := range resolvers {
+		switch {
+		case r.LocalNetwork:
+			return "leak"
+		case !r.MatchesExit && !r.MatchesExitNetwork:
+			verdict = "suspect"
+		case verdict == "inconclusive":
+			verdict = "ok"
+		}
+	}
+	return verdict
+}
+
+// 23. 執行 DNS 洩漏測試 (經由本地中轉查詢隨機子網域，再向服務取得觀察到的解析器)
+func (a *App) RunDNSLeakTest(cfg LeakTestConfig) LeakTestResult {
+	defaults := defaultLeakTestConfig()
+	if cfg.LookupHost == "" || cfg.ResultURL == "" {
+		cfg.SessionURL, cfg.LookupHost, cfg.ResultURL = defaults.SessionURL, defaults.LookupHost, defaults.ResultURL
+	}
+	if cfg.Lookups <= 0 {
+		cfg.Lookups = defaults.Lookups
+	}
+	if cfg.Lookups > maxLeakLookups {
+		cfg.Lookups = maxLeakLookups
+	}
+
+	result := LeakTestResult{Lookups: cfg.Lookups, Verdict: "inconclusive"}
+	if err := a.checkLeakStandIn(cfg.LookupHost); err != nil {
+		result.Error = fmt.Sprintf("stand_in_requires_doh: %v", err)
+		return result
+	}
+	client, err := a.middlewareClient(leakLookupTimeout)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// 取得工作階段 ID
+	result.Session = randomLabel()
+	if cfg.SessionURL != "" {
+		resp, err := leakServiceClient(cfg.SessionURL, client).Get(cfg.SessionURL)
+		if err != nil {
+			result.Error = fmt.Sprintf("session_failed: %v", err)
+			return result
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		resp.Body.Close()
+		if id := strings.TrimSpace(string(body)); resp.StatusCode == http.StatusOK && id != "" {
+			result.Session = id
+		}
+	}
+
+	// 查詢唯一的子網域，強制解析器向測試服務的權威 DNS 查詢 (回應內容不重要)
+	var wg sync.WaitGroup
+	for i := 1; i <= cfg.Lookups; i++ {
+		host := strings.NewReplacer("{n}", strconv.Itoa(i), "{session}", result.Session).Replace(cfg.LookupHost)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := client.Get("http://" + host + "/"); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	time.Sleep(leakResultSettleTime)
+
+	resultURL := strings.ReplaceAll(cfg.ResultURL, "{session}", result.Session)
+	resp, err := leakServiceClient(resultURL, client).Get(resultURL)
+	if err != nil {
+		result.Error = fmt.Sprintf("result_failed: %v", err)
+		return result
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+	exit, resolvers, err := parseLeakResults(data)
+	if err != nil {
+		result.Error = fmt.Sprintf("result_failed: %v", err)
+		return result
+	}
+
+	// 與出口 IP 比對；服務回報的出口位址與實際相同時才採用其 ASN 與國家
+	if ip := strings.TrimSpace(a.GetSystemProxyExitIP()); net.ParseIP(ip) != nil {
+		result.ExitIP = ip
+	} else {
+		result.ExitIP = exit.IP
+	}
+	if exit.IP != "" && net.ParseIP(exit.IP).Equal(net.ParseIP(result.ExitIP)) {
+		result.ExitCountry, result.ExitASN = exit.Country, exit.ASN
+	}
+	for i := range resolvers {
+		r := &resolvers[i]
+		ip := net.ParseIP(r.IP)
+		r.LocalNetwork = isLocalNetworkIP(ip)
+		r.MatchesExit = result.ExitIP != "" && ip.Equal(net.ParseIP(result.ExitIP))
+		r.MatchesExitNetwork = (result.ExitASN != "" && r.ASN == result.ExitASN) ||
+			(result.ExitCountry != "" && strings.EqualFold(r.Country, result.ExitCountry))
+	}
+	sort.Slice(resolvers, func(i, j int) bool { return resolvers[i].IP < resolvers[j].IP })
+	result.Resolvers = resolvers
+	result.Verdict = leakVerdict(resolvers)
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("DNS leak test %s: %s (%d resolvers)", result.Session, result.Verdict, len(resolvers)))
+	}
+	return result
+}
+
+// 23-1. 預設的洩漏測試服務設定
+func (a *App) GetDefaultLeakTestConfig() LeakTestConfig {
+	return defaultLeakTestConfig()
+}
+
+// ---------------- 本機洩漏測試服務 (測試用) ----------------
+
+// leakStandIn 模擬洩漏測試服務: 以 DoH 與 UDP DNS 回應 *.leak.test，並記錄查詢來源
+// RunDNSLeakTest 需將 DNS 策略的 DoH 位址設為 /dns-query 才能觀察到中轉的查詢；
+// UDP 連接埠只會收到直接送來的查詢 (例如手動以 dig 測試，或另外設定轉送 leak.test 的解析器)
+type leakStandIn struct {
+	mu     sync.Mutex
+	server *http.Server
+	udp    net.PacketConn
+	dohURL string
+	seen   map[string]map[string]bool // session -> 解析器 IP
+}
+
+// 記錄查詢 {n}.{session}.leak.test 的來源，回傳回應封包
+func (s *leakStandIn) answer(query []byte, from net.IP) ([]byte, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		return nil, err
+	}
+	msg.Header.Response = true
+	msg.Header.Authoritative = true
+	for _, q := range msg.Questions {
+		name, ok := strings.CutSuffix(strings.ToLower(q.Name.String()), "."+leakStandInDomain+".")
+		if labels := strings.Split(name, "."); ok && len(labels) == 2 {
+			s.mu.Lock()
+			if s.seen[labels[1]] == nil {
+				s.seen[labels[1]] = make(map[string]bool)
+			}
+			s.seen[labels[1]][from.String()] = true
+			s.mu.Unlock()
+		}
+		if q.Type == dnsmessage.TypeA {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class},
+				Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+			})
+		}
+	}
+	return msg.Pack()
+}
+
+func (s *leakStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	from := net.ParseIP(host)
+
+	switch {
+	case r.URL.Path == "/id":
+		io.WriteString(w, randomLabel())
+	case r.URL.Path == "/dns-query":
+		query, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		reply, err := s.answer(query, from)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(reply)
+	case strings.HasPrefix(r.URL.Path, "/results/"):
+		session := strings.TrimPrefix(r.URL.Path, "/results/")
+		type entry struct {
+			IP   string `json:"ip"`
+			Type string `json:"type"`
+		}
+		entries := []entry{}
+		s.mu.Lock()
+		for ip := range s.seen[session] {
+			entries = append(entries, entry{IP: ip, Type: "dns"})
+		}
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	default:
+		// 查詢子網域時的 HTTP 請求
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *leakStandIn) serveUDP() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		from := net.ParseIP(remoteIP(addr))
+		if reply, err := s.answer(buf[:n], from); err == nil {
+			s.udp.WriteTo(reply, addr)
+		}
+	}
+}
+
+func (s *leakStandIn) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.server.Shutdown(ctx)
+	s.udp.Close()
+}
+
+// 23-2. 啟動本機洩漏測試服務，回傳對應的測試設定
+// 執行測試前需以 SetDNSPolicy 將 DoH 位址設為 {base}/dns-query
+func (a *App) StartLeakTestService() LeakTestConfig {
+	a.StopLeakTestService()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return LeakTestConfig{}
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	udp, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		ln.Close()
+		return LeakTestConfig{}
+	}
+
+	base := "http://" + ln.Addr().String()
+	s := &leakStandIn{udp: udp, dohURL: base + "/dns-query", seen: make(map[string]map[string]bool)}
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 5 * time.Second}
+	go s.server.Serve(ln)
+	go s.serveUDP()
+
+	a.mu.Lock()
+	a.leakService = s
+	a.mu.Unlock()
+
+	return LeakTestConfig{
+		SessionURL: base + "/id",
+		LookupHost: fmt.Sprintf("{n}.{session}.%s:%d", leakStandInDomain, port),
+		ResultURL:  base + "/results/{session}",
+		Lookups:    defaultLeakLookups,
+	}
+}
+
+// 23-3. 停止本機洩漏測試服務
+func (a *App) StopLeakTestService() {
+	a.mu.Lock()
+	s := a.leakService
+	a.leakService = nil
+	a.mu.Unlock()
+	if s != nil {
+		s.close()
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseLeakResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantExit LeakResolver
+		want     []LeakResolver
+		wantErr  bool
+	}{
+		{name: "empty", data: `[]`},
+		{
+			name: "bash.ws format",
+			data: `[
+				{"ip":"203.0.113.5","country":"JP","asn":"AS1","type":"ip"},
+				{"ip":"203.0.113.6","country":"JP","asn":"AS1","type":"ip"},
+				{"ip":"198.51.100.1","country_name":"Germany","asn":"AS2","type":"dns"},
+				{"ip":"198.51.100.2","country":"US","country_name":"United States","asn":"AS3","type":"dns"},
+				{"ip":"198.51.100.1","country":"DE","type":"dns"},
+				{"ip":"not-an-ip","type":"dns"},
+				{"type":"conclusion"}
+			]`,
+			wantExit: LeakResolver{IP: "203.0.113.5", Country: "JP", ASN: "AS1"},
+			want: []LeakResolver{
+				{IP: "198.51.100.1", Country: "Germany", ASN: "AS2"},
+				{IP: "198.51.100.2", Country: "US", ASN: "AS3"},
+			},
+		},
+		{
+			name:     "exit with invalid ip",
+			data:     `[{"ip":"","type":"ip"},{"ip":"192.0.2.1","country_name":"Japan","type":"ip"}]`,
+			wantExit: LeakResolver{IP: "192.0.2.1", Country: "Japan"},
+		},
+		{name: "not json", data: `<html>`, wantErr: true},
+		{name: "object", data: `{"ip":"1.1.1.1"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exit, got, err := parseLeakResults([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLeakResults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if exit != tt.wantExit {
+				t.Errorf("parseLeakResults() exit = %+v, want %+v", exit, tt.wantExit)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLeakResults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeakVerdict(t *testing.T) {
+	var (
+		local   = LeakResolver{IP: "192.168.1.1", LocalNetwork: true}
+		exit    = LeakResolver{IP: "203.0.113.5", MatchesExit: true}
+		network = LeakResolver{IP: "203.0.113.9", MatchesExitNetwork: true}
+		foreign = LeakResolver{IP: "198.51.100.1"}
+	)
+	tests := []struct {
+		name      string
+		resolvers []LeakResolver
+		want      string
+	}{
+		{name: "none", want: "inconclusive"},
+		{name: "exit ip", resolvers: []LeakResolver{exit}, want: "ok"},
+		{name: "same network", resolvers: []LeakResolver{network, exit}, want: "ok"},
+		{name: "foreign resolver", resolvers: []LeakResolver{exit, foreign}, want: "suspect"},
+		{name: "foreign first", resolvers: []LeakResolver{foreign, network}, want: "suspect"},
+		{name: "local network", resolvers: []LeakResolver{foreign, local, exit}, want: "leak"},
+	}
+	for _, tt := range tests {
+		if got := leakVerdict(tt.resolvers); got != tt.want {
+			t.Errorf("%s: leakVerdict() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsLocalNetworkIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"192.168.1.1", true},
+		{"10.20.30.40", true},
+		{"172.16.5.4", true},
+		{"fd00::53", true},
+		{"169.254.1.1", true},
+		{"fe80::1", true},
+		{"0.0.0.0", true},
+		{"8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	}
+	for _, tt := range tests {
+		if got := isLocalNetworkIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isLocalNetworkIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestIsLoopbackHost(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":   true,
+		"127.0.0.53":  true,
+		"::1":         true,
+		"LocalHost":   true,
+		"10.0.0.1":    false,
+		"example.com": false,
+		"":            false,
+	}
+	for host, want := range tests {
+		if got := isLoopbackHost(host); got != want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func leakQuery(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 7, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestLeakStandInAnswer(t *testing.T) {
+	s := &leakStandIn{seen: make(map[string]map[string]bool)}
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     dnsmessage.Type
+		from      string
+		wantA     bool
+		wantTrack string // 記錄到的 session
+	}{
+		{name: "tracked A", qname: "1.abc.leak.test.", qtype: dnsmessage.TypeA, from: "192.0.2.1", wantA: true, wantTrack: "abc"},
+		{name: "tracked AAAA", qname: "2.ABC.Leak.Test.", qtype: dnsmessage.TypeAAAA, from: "192.0.2.2", wantTrack: "abc"},
+		{name: "other domain", qname: "1.abc.example.com.", qtype: dnsmessage.TypeA, from: "192.0.2.3", wantA: true},
+		{name: "too many labels", qname: "x.1.abc.leak.test.", qtype: dnsmessage.TypeA, from: "192.0.2.4", wantA: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := s.answer(leakQuery(t, tt.qname, tt.qtype), net.ParseIP(tt.from))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(reply); err != nil {
+				t.Fatal(err)
+			}
+			if !msg.Header.Response || msg.Header.ID != 7 {
+				t.Errorf("header = %+v", msg.Header)
+			}
+			if gotA := len(msg.Answers) == 1; gotA != tt.wantA {
+				t.Errorf("answers = %v, want A = %v", msg.Answers, tt.wantA)
+			}
+			s.mu.Lock()
+			tracked := s.seen[tt.wantTrack][tt.from]
+			s.mu.Unlock()
+			if tt.wantTrack != "" && !tracked {
+				t.Errorf("query from %s not recorded for session %s", tt.from, tt.wantTrack)
+			}
+		})
+	}
+	if _, err := s.answer([]byte("junk"), net.ParseIP("192.0.2.1")); err == nil {
+		t.Error("answer(junk) succeeded")
+	}
+}
+
+// 本機測試服務: 取得工作階段、以 DoH 與 UDP 查詢後取回記錄的解析器
+func TestLeakTestService(t *testing.T) {
+	a := &App{}
+	cfg := a.StartLeakTestService()
+	defer a.StopLeakTestService()
+	if cfg.SessionURL == "" || !strings.Contains(cfg.LookupHost, "{session}.leak.test:") {
+		t.Fatalf("StartLeakTestService() = %+v", cfg)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(cfg.SessionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	session := strings.TrimSpace(string(body))
+	if len(session) != 12 {
+		t.Fatalf("session = %q", session)
+	}
+	base := strings.TrimSuffix(cfg.SessionURL, "/id")
+
+	// DoH
+	resp, err = client.Post(base+"/dns-query", "application/dns-message",
+		strings.NewReader(string(leakQuery(t, "1."+session+".leak.test.", dnsmessage.TypeA))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/dns-message" {
+		t.Fatalf("DoH response = %s %v", resp.Status, resp.Header)
+	}
+
+	// UDP (與 HTTP 相同端口)
+	conn, err := net.Dial("udp", strings.TrimPrefix(base, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write(leakQuery(t, "2."+session+".leak.test.", dnsmessage.TypeA))
+	buf := make([]byte, 512)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("UDP reply: %v", err)
+	}
+
+	resp, err = client.Get(strings.ReplaceAll(cfg.ResultURL, "{session}", session))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []struct{ IP, Type string }
+	json.NewDecoder(resp.Body).Decode(&entries)
+	resp.Body.Close()
+	if len(entries) != 1 || entries[0].IP != "127.0.0.1" || entries[0].Type != "dns" {
+		t.Errorf("results = %+v, want 127.0.0.1", entries)
+	}
+
+	a.StopLeakTestService()
+	if _, err := client.Get(cfg.SessionURL); err == nil {
+		t.Error("service still running after stop")
+	}
+}
+
+func TestRunDNSLeakTestRequiresMiddleware(t *testing.T) {
+	result := (&App{}).RunDNSLeakTest(LeakTestConfig{})
+	if result.Verdict != "inconclusive" || result.Error == "" || result.Lookups != defaultLeakLookups {
+		t.Errorf("RunDNSLeakTest() = %+v", result)
+	}
+}
+
+// 經由中轉執行完整的洩漏測試: 子網域查詢經 DoH 送到測試服務，工作階段與結果直接向服務取得
+func TestRunDNSLeakTestWithStandIn(t *testing.T) {
+	a := &App{}
+	cfg := a.StartLeakTestService()
+	defer a.StopLeakTestService()
+	cfg.Lookups = 2
+
+	_, a.localPort, _ = net.SplitHostPort(closedAddr(t))
+	if err := a.StartLocalMiddleware(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		a.mu.Lock()
+		a.localServer.Close()
+		a.stopSocksServerLocked()
+		a.mu.Unlock()
+	}()
+
+	// 未設定 DoH 時查詢不會到達測試服務
+	if result := a.RunDNSLeakTest(cfg); !strings.HasPrefix(result.Error, "stand_in_requires_doh") {
+		t.Fatalf("RunDNSLeakTest() without DoH = %+v", result)
+	}
+	dohURL := strings.TrimSuffix(cfg.SessionURL, "/id") + "/dns-query"
+	if got := a.SetDNSPolicy(DNSPolicy{Mode: dnsModeDoH, DoHURL: dohURL}); got != "Success" {
+		t.Fatal(got)
+	}
+
+	tests := []struct {
+		name        string
+		rules       string
+		wantVerdict string
+	}{
+		{name: "direct", rules: "MATCH,DIRECT", wantVerdict: "leak"},
+		// 沒有可用節點時查詢失敗，但仍能直接取得結果
+		{name: "proxy without node", rules: "MATCH,PROXY", wantVerdict: "inconclusive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.SetRules(tt.rules); got != "Success" {
+				t.Fatal(got)
+			}
+			result := a.RunDNSLeakTest(cfg)
+			if result.Error != "" || result.Verdict != tt.wantVerdict || len(result.Session) != 12 {
+				t.Errorf("RunDNSLeakTest() = %+v, want verdict %s", result, tt.wantVerdict)
+			}
+		})
+	}
+}
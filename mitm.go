@@ -0,0 +1,438 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- HTTPS 解密 (MITM) ----------------
+
+const (
+	mitmCAFile        = "ca.pem"
+	mitmCAKeyFile     = "ca-key.pem"
+	mitmCAValidity    = 10 * 365 * 24 * time.Hour
+	mitmLeafValidity  = 397 * 24 * time.Hour // 瀏覽器接受的憑證效期上限
+	mitmLeafCacheSize = 1024
+	mitmHandshakeWait = 10 * time.Second
+)
+
+// MITMConfig HTTPS 解密設定，只有允許清單內的主機會被解密
+type MITMConfig struct {
+	Enabled bool     `json:"enabled"`
+	Hosts   []string `json:"hosts"` // example.com 或 *.example.com
+}
+
+// MITMStatus 目前的解密設定與根憑證資訊
+type MITMStatus struct {
+	Enabled       bool     `json:"enabled"`
+	Hosts         []string `json:"hosts"`
+	CAReady       bool     `json:"caReady"`
+	CAFingerprint string   `json:"caFingerprint"` // SHA-256
+	CANotAfter    int64    `json:"caNotAfter"`    // Unix 毫秒
+	CAPath        string   `json:"caPath"`
+}
+
+type mitmState struct {
+	mu      sync.Mutex
+	cfg     MITMConfig
+	ca      *x509.Certificate
+	caKey   crypto.Signer
+	caPEM   []byte
+	leafKey *ecdsa.PrivateKey
+	leaves  map[string]*tls.Certificate
+}
+
+// 根憑證存放目錄
+func mitmDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ProxyMaster"), nil
+}
+
+// 產生新的根憑證，回傳 PEM 格式的憑證與私鑰
+func generateCA() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "ProxyMaster Local CA", Organization: []string{"ProxyMaster"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(mitmCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// 寫入根憑證與私鑰 (私鑰僅限目前使用者讀取)
+func writeCAFiles(dir string, certPEM, keyPEM []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, mitmCAKeyFile), keyPEM, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, mitmCAFile), certPEM, 0644)
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// 載入已儲存的根憑證；create 為 true 且不存在時產生新的 (呼叫者需持有 m.mu)
+func (m *mitmState) loadCALocked(create bool) error {
+	if m.ca != nil {
+		return nil
+	}
+	dir, err := mitmDir()
+	if err != nil {
+		return err
+	}
+	certPEM, certErr := os.ReadFile(filepath.Join(dir, mitmCAFile))
+	keyPEM, keyErr := os.ReadFile(filepath.Join(dir, mitmCAKeyFile))
+	if certErr != nil || keyErr != nil {
+		if !create {
+			return errors.New("CA not generated")
+		}
+		if certPEM, keyPEM, err = generateCA(); err != nil {
+			return err
+		}
+		if err := writeCAFiles(dir, certPEM, keyPEM); err != nil {
+			return err
+		}
+	}
+	return m.setCALocked(certPEM, keyPEM)
+}
+
+func (m *mitmState) setCALocked(certPEM, keyPEM []byte) error {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok || !cert.IsCA {
+		return errors.New("invalid CA certificate")
+	}
+	m.ca, m.caKey, m.caPEM = cert, signer, certPEM
+	m.leaves = nil
+	return nil
+}
+
+// 取得 (或簽發) 指定主機的憑證
+func (m *mitmState) leafFor(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(host)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ca == nil {
+		return nil, errors.New("CA not loaded")
+	}
+	if leaf := m.leaves[host]; leaf != nil && time.Now().Before(leaf.Leaf.NotAfter) {
+		return leaf, nil
+	}
+	if m.leafKey == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		m.leafKey = key
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(mitmLeafValidity)
+	if notAfter.After(m.ca.NotAfter) {
+		notAfter = m.ca.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host, Organization: []string{"ProxyMaster"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, m.ca, &m.leafKey.PublicKey, m.caKey)
+	if err != nil {
+		return nil, err
+	}
+	leafCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	leaf := &tls.Certificate{
+		Certificate: [][]byte{der, m.ca.Raw},
+		PrivateKey:  m.leafKey,
+		Leaf:        leafCert,
+	}
+
+	if m.leaves == nil || len(m.leaves) >= mitmLeafCacheSize {
+		m.leaves = make(map[string]*tls.Certificate)
+	}
+	m.leaves[host] = leaf
+	return leaf, nil
+}
+
+// 主機是否在允許清單內 (*.example.com 只比對子網域)
+func mitmHostAllowed(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(p, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == p {
+			return true
+		}
+	}
+	return false
+}
+
+// 判斷 CONNECT 目標是否需要解密
+func (a *App) shouldIntercept(target string) bool {
+	host, _ := splitTarget(target, 443)
+	a.mitm.mu.Lock()
+	defer a.mitm.mu.Unlock()
+	return a.mitm.cfg.Enabled && a.mitm.ca != nil && mitmHostAllowed(a.mitm.cfg.Hosts, host)
+}
+
+// singleConnListener 只交出一條連線，該連線關閉後 Accept 才返回錯誤
+type singleConnListener struct {
+	conn   net.Conn
+	once   sync.Once
+	closed chan struct{}
+	done   sync.Once
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{conn: conn, closed: make(chan struct{})}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	var c net.Conn
+	l.once.Do(func() { c = &notifyConn{Conn: l.conn, l: l} })
+	if c != nil {
+		return c, nil
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *singleConnListener) Close() error {
+	l.done.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+type notifyConn struct {
+	net.Conn
+	l *singleConnListener
+}
+
+func (c *notifyConn) Close() error {
+	c.l.Close()
+	return c.Conn.Close()
+}
+
+// 以本地根憑證簽發的憑證終結客戶端 TLS，再將解密後的請求重新以 TLS 送往目標
+func (a *App) serveMITM(clientConn net.Conn, target, clientIP string, remote *Proxy) {
+	host, port := splitTarget(target, 443)
+	tlsConn := tls.Server(clientConn, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		// 憑證一律依 CONNECT 目標簽發；SNI 與目標不符時拒絕，避免替允許清單外的主機簽發
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if sni := hello.ServerName; sni != "" && !strings.EqualFold(strings.TrimSuffix(sni, "."), host) {
+				return nil, fmt.Errorf("SNI %q does not match CONNECT host %q", sni, host)
+			}
+			return a.mitm.leafFor(host)
+		},
+	})
+	tlsConn.SetDeadline(time.Now().Add(mitmHandshakeWait))
+	if err := tlsConn.Handshake(); err != nil {
+		if a.ctx != nil {
+			wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("MITM handshake with %s failed: %v", target, err))
+		}
+		return
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	origin := host
+	if strings.Contains(host, ":") {
+		origin = "[" + host + "]" // IPv6 位址需加上中括號
+	}
+	if port != 443 {
+		origin = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u := *r.URL
+			u.Scheme = "https"
+			u.Host = origin
+			a.forwardHTTP(w, r, u, clientIP, remote)
+		}),
+		ReadHeaderTimeout: upstreamHeaderTimeout,
+		IdleTimeout:       upstreamIdleTimeout,
+	}
+	server.Serve(newSingleConnListener(tlsConn))
+}
+
+// 20. 設定 HTTPS 解密 (啟用時自動產生並保存根憑證)
+func (a *App) SetMITM(cfg MITMConfig) string {
+	hosts := make([]string, 0, len(cfg.Hosts))
+	for _, h := range cfg.Hosts {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	cfg.Hosts = hosts
+
+	a.mitm.mu.Lock()
+	defer a.mitm.mu.Unlock()
+	if cfg.Enabled {
+		if err := a.mitm.loadCALocked(true); err != nil {
+			return fmt.Sprintf("ca_failed: %v", err)
+		}
+	}
+	a.mitm.cfg = cfg
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("MITM enabled=%v hosts=%v", cfg.Enabled, cfg.Hosts))
+	}
+	return "Success"
+}
+
+// 20-1. 取得解密設定與根憑證資訊
+func (a *App) GetMITMStatus() MITMStatus {
+	a.mitm.mu.Lock()
+	defer a.mitm.mu.Unlock()
+	a.mitm.loadCALocked(false)
+
+	status := MITMStatus{
+		Enabled: a.mitm.cfg.Enabled,
+		Hosts:   append([]string{}, a.mitm.cfg.Hosts...),
+	}
+	if dir, err := mitmDir(); err == nil {
+		status.CAPath = filepath.Join(dir, mitmCAFile)
+	}
+	if a.mitm.ca != nil {
+		sum := sha256.Sum256(a.mitm.ca.Raw)
+		status.CAReady = true
+		status.CAFingerprint = strings.ToUpper(hex.EncodeToString(sum[:]))
+		status.CANotAfter = a.mitm.ca.NotAfter.UnixMilli()
+	}
+	return status
+}
+
+// 20-2. 將根憑證 (不含私鑰) 存到指定路徑，供測試瀏覽器匯入
+func (a *App) SaveCACertFile(path string) string {
+	a.mitm.mu.Lock()
+	err := a.mitm.loadCALocked(true)
+	data := a.mitm.caPEM
+	a.mitm.mu.Unlock()
+	if err != nil {
+		return fmt.Sprintf("ca_failed: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Sprintf("write_failed: %v", err)
+	}
+	return "Success"
+}
+
+// 20-3. 以對話框選擇位置並匯出根憑證
+func (a *App) ExportCACert() string {
+	f, err := wailsRuntime.SaveFileDialog(a.ctx, wailsRuntime.SaveDialogOptions{
+		Title:           "Export CA Certificate",
+		DefaultFilename: "ProxyMaster-CA.crt",
+		Filters: []wailsRuntime.FileFilter{
+			{DisplayName: "Certificates", Pattern: "*.crt;*.pem"},
+		},
+	})
+	if err != nil || f == "" {
+		return ""
+	}
+	return a.SaveCACertFile(f)
+}
+
+// 20-4. 重新產生根憑證 (舊憑證需自瀏覽器移除並重新匯入)
+func (a *App) RegenerateCA() string {
+	certPEM, keyPEM, err := generateCA()
+	if err != nil {
+		return fmt.Sprintf("ca_failed: %v", err)
+	}
+	dir, err := mitmDir()
+	if err != nil {
+		return fmt.Sprintf("ca_failed: %v", err)
+	}
+	if err := writeCAFiles(dir, certPEM, keyPEM); err != nil {
+		return fmt.Sprintf("write_failed: %v", err)
+	}
+
+	a.mitm.mu.Lock()
+	defer a.mitm.mu.Unlock()
+	a.mitm.ca = nil
+	if err := a.mitm.setCALocked(certPEM, keyPEM); err != nil {
+		return fmt.Sprintf("ca_failed: %v", err)
+	}
+	return "Success"
+}
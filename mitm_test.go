@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMITMHostAllowed(t *testing.T) {
+	patterns := []string{"example.com", " *.Internal.test ", ""}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com.", true},
+		{"www.example.com", false},
+		{"api.internal.test", true},
+		{"a.b.internal.test", true},
+		{"internal.test", false},
+		{"evilinternal.test", false},
+		{"other.net", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := mitmHostAllowed(patterns, tt.host); got != tt.want {
+			t.Errorf("mitmHostAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+// 建立只存在記憶體中的根憑證
+func newTestMITM(t *testing.T) (*mitmState, *x509.CertPool) {
+	t.Helper()
+	certPEM, keyPEM, err := generateCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mitmState{}
+	if err := m.setCALocked(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return m, pool
+}
+
+func TestLeafFor(t *testing.T) {
+	m, pool := newTestMITM(t)
+	tests := []struct {
+		host   string
+		verify string
+	}{
+		{host: "Example.COM", verify: "example.com"},
+		{host: "10.0.0.1", verify: "10.0.0.1"},
+		{host: "::1", verify: "::1"},
+	}
+	for _, tt := range tests {
+		leaf, err := m.leafFor(tt.host)
+		if err != nil {
+			t.Fatalf("leafFor(%q) error: %v", tt.host, err)
+		}
+		if _, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: tt.verify, Roots: pool}); err != nil {
+			t.Errorf("leafFor(%q) does not verify for %q: %v", tt.host, tt.verify, err)
+		}
+		if leaf.Leaf.NotAfter.After(m.ca.NotAfter) || leaf.Leaf.NotAfter.Sub(time.Now()) > mitmLeafValidity {
+			t.Errorf("leafFor(%q) validity too long: %v", tt.host, leaf.Leaf.NotAfter)
+		}
+	}
+
+	a, _ := m.leafFor("example.com")
+	b, _ := m.leafFor("EXAMPLE.com")
+	if a != b {
+		t.Error("leafFor() did not reuse the cached certificate")
+	}
+
+	if _, err := (&mitmState{}).leafFor("example.com"); err == nil {
+		t.Error("leafFor() without CA succeeded")
+	}
+}
+
+func TestSetCALockedRejectsLeaf(t *testing.T) {
+	m, _ := newTestMITM(t)
+	leaf, err := m.leafFor("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(m.leafKey)
+	certPEM := pemBlock("CERTIFICATE", leaf.Certificate[0])
+	keyPEM := pemBlock("EC PRIVATE KEY", keyDER)
+	if err := (&mitmState{}).setCALocked(certPEM, keyPEM); err == nil {
+		t.Error("setCALocked() accepted a non-CA certificate")
+	}
+	if err := (&mitmState{}).setCALocked([]byte("junk"), []byte("junk")); err == nil {
+		t.Error("setCALocked() accepted junk")
+	}
+}
+
+func TestShouldIntercept(t *testing.T) {
+	m, _ := newTestMITM(t)
+	tests := []struct {
+		name   string
+		cfg    MITMConfig
+		noCA   bool
+		target string
+		want   bool
+	}{
+		{name: "allowed", cfg: MITMConfig{Enabled: true, Hosts: []string{"example.com"}}, target: "example.com:443", want: true},
+		{name: "other port", cfg: MITMConfig{Enabled: true, Hosts: []string{"example.com"}}, target: "example.com:8443", want: true},
+		{name: "not listed", cfg: MITMConfig{Enabled: true, Hosts: []string{"example.com"}}, target: "other.com:443", want: false},
+		{name: "disabled", cfg: MITMConfig{Hosts: []string{"example.com"}}, target: "example.com:443", want: false},
+		{name: "no ca", cfg: MITMConfig{Enabled: true, Hosts: []string{"example.com"}}, noCA: true, target: "example.com:443", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{}
+			a.mitm.cfg = tt.cfg
+			if !tt.noCA {
+				a.mitm.ca, a.mitm.caKey = m.ca, m.caKey
+			}
+			if got := a.shouldIntercept(tt.target); got != tt.want {
+				t.Errorf("shouldIntercept(%q) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+// 客戶端信任本地根憑證時，解密端的憑證需能通過驗證
+func TestServeMITMHandshake(t *testing.T) {
+	m, pool := newTestMITM(t)
+	tests := []struct {
+		name       string
+		target     string
+		serverName string // 客戶端送出的 SNI (IP 位址不會送出)
+		verifyName string
+		wantErr    bool
+	}{
+		{name: "matching sni", target: "example.com:443", serverName: "example.com", verifyName: "example.com"},
+		{name: "sni case differs", target: "example.com:443", serverName: "EXAMPLE.com", verifyName: "example.com"},
+		{name: "no sni uses connect host", target: "192.0.2.1:443", serverName: "192.0.2.1", verifyName: "192.0.2.1"},
+		{name: "mismatched sni", target: "example.com:443", serverName: "other.example.net", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{}
+			a.mitm.ca, a.mitm.caKey = m.ca, m.caKey
+
+			client, server := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				a.serveMITM(server, tt.target, "127.0.0.1", nil)
+				server.Close()
+				close(done)
+			}()
+
+			tlsClient := tls.Client(client, &tls.Config{ServerName: tt.serverName, RootCAs: pool})
+			tlsClient.SetDeadline(time.Now().Add(5 * time.Second))
+			err := tlsClient.Handshake()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("handshake with mismatched SNI succeeded")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("handshake failed: %v", err)
+				}
+				leaf := tlsClient.ConnectionState().PeerCertificates[0]
+				if err := leaf.VerifyHostname(tt.verifyName); err != nil {
+					t.Errorf("leaf not valid for %s: %v", tt.verifyName, err)
+				}
+				if proto := tlsClient.ConnectionState().NegotiatedProtocol; proto != "" && proto != "http/1.1" {
+					t.Errorf("negotiated %q, want http/1.1", proto)
+				}
+			}
+			tlsClient.Close()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("serveMITM did not return after the client closed")
+			}
+		})
+	}
+}
+
+func TestSingleConnListener(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	l := newSingleConnListener(server)
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		second <- err
+	}()
+	select {
+	case <-second:
+		t.Fatal("second Accept returned before the connection closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.Close()
+	if err := <-second; err != net.ErrClosed {
+		t.Errorf("second Accept error = %v, want net.ErrClosed", err)
+	}
+}
+
+func TestMITMConfigPersistsCA(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("APPDATA", dir)
+	t.Setenv("HOME", dir)
+
+	a := &App{}
+	if got := a.SetMITM(MITMConfig{Enabled: true, Hosts: []string{" example.com ", ""}}); got != "Success" {
+		t.Fatalf("SetMITM() = %q", got)
+	}
+	status := a.GetMITMStatus()
+	if !status.CAReady || len(status.Hosts) != 1 || status.Hosts[0] != "example.com" || len(status.CAFingerprint) != 64 {
+		t.Fatalf("GetMITMStatus() = %+v", status)
+	}
+	if _, err := os.Stat(status.CAPath); err != nil {
+		t.Fatalf("CA file not written: %v", err)
+	}
+
+	// 重新啟動後沿用同一張根憑證
+	b := &App{}
+	if got := b.GetMITMStatus(); got.CAFingerprint != status.CAFingerprint {
+		t.Errorf("reloaded fingerprint = %s, want %s", got.CAFingerprint, status.CAFingerprint)
+	}
+
+	out := filepath.Join(t.TempDir(), "ca.crt")
+	if got := b.SaveCACertFile(out); got != "Success" {
+		t.Fatalf("SaveCACertFile() = %q", got)
+	}
+	if data, _ := os.ReadFile(out); len(data) == 0 {
+		t.Error("exported CA is empty")
+	}
+
+	if got := b.RegenerateCA(); got != "Success" {
+		t.Fatalf("RegenerateCA() = %q", got)
+	}
+	if got := b.GetMITMStatus(); got.CAFingerprint == status.CAFingerprint {
+		t.Error("RegenerateCA() kept the old certificate")
+	}
+}
+
+func pemBlock(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- PAC 自動設定 ----------------
+
+// 系統代理模式
+const (
+	proxyModeManual = "manual" // 固定 host:port
+	proxyModePAC    = "pac"    // 自動設定 URL (由本地中轉提供 /proxy.pac)
+)
+
+const pacPath = "/proxy.pac"
+
+// 本地與內網位址一律直連 (與 Windows ProxyOverride 的清單一致)
+var pacBypassNets = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+}
+
+// 依目前的分流規則產生 PAC 內容
+// 註: IP-CIDR 只比對 IP 字面值 (不在瀏覽器端解析網域)，與中轉端行為一致
+func generatePAC(proxyAddr string, rules []*compiledRule) string {
+	proxy := "PROXY " + proxyAddr
+	var b strings.Builder
+
+	b.WriteString("// Generated by ProxyMaster\n")
+	b.WriteString("function FindProxyForURL(url, host) {\n")
+	b.WriteString("  host = host.toLowerCase();\n")
+	b.WriteString("  var isIP = /^\\d+\\.\\d+\\.\\d+\\.\\d+$/.test(host);\n")
+	b.WriteString("  var m = url.match(/^[a-z]+:\\/\\/[^\\/]*:(\\d+)/i);\n")
+	b.WriteString("  var port = m ? parseInt(m[1], 10) : (url.substring(0, 6).toLowerCase() == \"https:\" ? 443 : 80);\n")
+	b.WriteString("\n")
+	b.WriteString("  // local and private networks\n")
+	b.WriteString("  if (isPlainHostName(host) || host == \"localhost\") return \"DIRECT\";\n")
+	for _, cidr := range pacBypassNets {
+		_, n, _ := net.ParseCIDR(cidr)
+		fmt.Fprintf(&b, "  if (isIP && isInNet(host, %q, %q)) return \"DIRECT\";\n", n.IP.String(), net.IP(n.Mask).String())
+	}
+
+	if len(rules) > 0 {
+		b.WriteString("\n  // routing rules\n")
+	}
+	for _, r := range rules {
+		cond := pacCondition(r)
+		if cond == "" {
+			continue
+		}
+		// REJECT 交由本地中轉回應 403，瀏覽器端無法直接阻擋
+		result := proxy
+		if r.Action == actionDirect {
+			result = "DIRECT"
+		}
+		fmt.Fprintf(&b, "  if (%s) return %q; // %s\n", cond, result, r.Rule)
+	}
+
+	fmt.Fprintf(&b, "\n  return %q;\n}\n", proxy)
+	return b.String()
+}
+
+// 將單條規則轉為 PAC 條件式，無法表達的規則回傳空字串
+func pacCondition(r *compiledRule) string {
+	switch r.Type {
+	case ruleDomain:
+		return fmt.Sprintf("host == %s", strconv.Quote(r.Payload))
+	case ruleDomainSuffix:
+		return fmt.Sprintf("(host == %s || dnsDomainIs(host, %s))",
+			strconv.Quote(r.Payload), strconv.Quote("."+r.Payload))
+	case ruleDomainKeyword:
+		return fmt.Sprintf("host.indexOf(%s) >= 0", strconv.Quote(r.Payload))
+	case ruleDomainRegex:
+		return fmt.Sprintf("new RegExp(%s).test(host)", strconv.Quote(r.Payload))
+	case ruleIPCIDR, ruleIPCIDR6:
+		// isInNet 只支援 IPv4
+		if r.cidr.IP.To4() == nil {
+			return ""
+		}
+		return fmt.Sprintf("isIP && isInNet(host, %q, %q)", r.cidr.IP.String(), net.IP(r.cidr.Mask).String())
+	case ruleDstPort:
+		return fmt.Sprintf("(port >= %d && port <= %d)", r.portMin, r.portMax)
+	case ruleMatch:
+		return "true"
+	}
+	return ""
+}
+
+// 提供 /proxy.pac (每次請求依最新規則產生)
+func (a *App) servePAC(w http.ResponseWriter, r *http.Request) {
+	a.mu.RLock()
+	port := a.localPort
+	rules := a.rules
+	a.mu.RUnlock()
+
+	// 指向客戶端連進來的位址 (區域網路客戶端不能使用 127.0.0.1)
+	host := a.localProxyHost()
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		host = remoteIP(local)
+	}
+	addr := net.JoinHostPort(host, port)
+
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write([]byte(generatePAC(addr, rules)))
+}
+
+// 依目前模式將系統代理指向本地中轉
+func (a *App) enableSystemProxyMode(lhost, lport string) error {
+	a.mu.RLock()
+	mode := a.proxyMode
+	a.mu.RUnlock()
+
+	if mode == proxyModePAC {
+		return EnableSystemProxyPAC(a.PACURL())
+	}
+	return EnableSystemProxy(lhost, lport)
+}
+
+// 13. 設定系統代理模式 ("manual" 或 "pac")，連線中會立即重新套用
+func (a *App) SetSystemProxyMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		mode = proxyModeManual
+	case proxyModeManual, proxyModePAC:
+	default:
+		return "invalid_mode"
+	}
+
+	a.mu.Lock()
+	a.proxyMode = mode
+	connected := a.activeRemote != nil || a.activeGroup != ""
+	lport := a.localPort
+	a.mu.Unlock()
+
+	if !connected {
+		return "Success"
+	}
+	if err := a.enableSystemProxyMode(a.localProxyHost(), lport); err != nil {
+		if a.ctx != nil {
+			wailsRuntime.LogError(a.ctx, fmt.Sprintf("Failed to set system proxy: %v", err))
+		}
+		return "system_proxy_failed"
+	}
+	return "Success"
+}
+
+// 13-1. 取得目前的系統代理模式
+func (a *App) GetSystemProxyMode() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.proxyMode == "" {
+		return proxyModeManual
+	}
+	return a.proxyMode
+}
+
+// 13-2. 取得本地中轉提供的 PAC 網址
+func (a *App) PACURL() string {
+	host := a.localProxyHost()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(host, a.localPort), pacPath)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPacCondition(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"DOMAIN,example.com,DIRECT", `host == "example.com"`},
+		{"DOMAIN-SUFFIX,example.com,DIRECT", `(host == "example.com" || dnsDomainIs(host, ".example.com"))`},
+		{"DOMAIN-KEYWORD,goo\"gle,PROXY", `host.indexOf("goo\"gle") >= 0`},
+		{`DOMAIN-REGEX,^ad\d+\.,REJECT`, `new RegExp("^ad\\d+\\.").test(host)`},
+		{"IP-CIDR,10.1.0.0/16,DIRECT", `isIP && isInNet(host, "10.1.0.0", "255.255.0.0")`},
+		{"IP-CIDR6,2001:db8::/32,DIRECT", ""},
+		{"DST-PORT,8000-8999,DIRECT", "(port >= 8000 && port <= 8999)"},
+		{"MATCH,DIRECT", "true"},
+	}
+	for _, tt := range tests {
+		if got := pacCondition(mustParseRule(t, tt.line)); got != tt.want {
+			t.Errorf("pacCondition(%q) = %s, want %s", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratePAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "no rules",
+			want: []string{
+				"function FindProxyForURL(url, host) {",
+				`if (isIP && isInNet(host, "192.168.0.0", "255.255.0.0")) return "DIRECT";`,
+				`if (isIP && isInNet(host, "172.16.0.0", "255.240.0.0")) return "DIRECT";`,
+				`return "PROXY 127.0.0.1:8899";`,
+			},
+			notWant: []string{"// routing rules"},
+		},
+		{
+			name:  "direct and proxy",
+			rules: []string{"DOMAIN-SUFFIX,cn,DIRECT", "DOMAIN,google.com,PROXY"},
+			want: []string{
+				`if ((host == "cn" || dnsDomainIs(host, ".cn"))) return "DIRECT"; // DOMAIN-SUFFIX,cn,DIRECT`,
+				`if (host == "google.com") return "PROXY 127.0.0.1:8899"; // DOMAIN,google.com,PROXY`,
+			},
+		},
+		{
+			name:  "reject goes through middleware",
+			rules: []string{"DOMAIN-KEYWORD,ads,REJECT"},
+			want:  []string{`if (host.indexOf("ads") >= 0) return "PROXY 127.0.0.1:8899";`},
+		},
+		{
+			name:    "ipv6 cidr skipped",
+			rules:   []string{"IP-CIDR6,fd00::/8,DIRECT"},
+			notWant: []string{"fd00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []*compiledRule
+			for _, line := range tt.rules {
+				rules = append(rules, mustParseRule(t, line))
+			}
+			pac := generatePAC("127.0.0.1:8899", rules)
+			for _, s := range tt.want {
+				if !strings.Contains(pac, s) {
+					t.Errorf("PAC missing %q:\n%s", s, pac)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(pac, s) {
+					t.Errorf("PAC unexpectedly contains %q:\n%s", s, pac)
+				}
+			}
+			// 規則依序排在預設回傳之前
+			if !strings.HasSuffix(pac, "return \"PROXY 127.0.0.1:8899\";\n}\n") {
+				t.Errorf("PAC does not end with the default route:\n%s", pac)
+			}
+		})
+	}
+}
+
+func TestServePAC(t *testing.T) {
+	a := &App{localPort: "8899", rules: []*compiledRule{mustParseRule(t, "DOMAIN,example.com,DIRECT")}}
+	rec := httptest.NewRecorder()
+	a.servePAC(rec, httptest.NewRequest(http.MethodGet, pacPath, nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ns-proxy-autoconfig" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `host == "example.com"`) {
+		t.Errorf("served PAC does not include rules:\n%s", rec.Body.String())
+	}
+	if got, want := a.PACURL(), "http://127.0.0.1:8899/proxy.pac"; got != want {
+		t.Errorf("PACURL() = %q, want %q", got, want)
+	}
+}
+
+func TestSetSystemProxyMode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		mode string
+	}{
+		{"pac", "Success", proxyModePAC},
+		{" MANUAL ", "Success", proxyModeManual},
+		{"", "Success", proxyModeManual},
+		{"auto", "invalid_mode", proxyModeManual},
+	}
+	for _, tt := range tests {
+		a := &App{}
+		if got := a.SetSystemProxyMode(tt.in); got != tt.want {
+			t.Errorf("SetSystemProxyMode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := a.GetSystemProxyMode(); got != tt.mode {
+			t.Errorf("SetSystemProxyMode(%q): mode = %q, want %q", tt.in, got, tt.mode)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ---------------- HTTPS (TLS 包裝) 上游代理 ----------------
+
+// 是否為需先與代理建立 TLS 的協定
+func isTLSProxy(p *Proxy) bool {
+	return strings.ToLower(p.Protocol) == "https"
+}
+
+// 建立與代理本身的 TLS 設定 (SNI、自訂 CA、客戶端憑證)
+// 注意: 這裡驗證的是代理伺服器憑證，與目標網站的 TLS 設定無關
+func proxyTLSConfig(p *Proxy) (*tls.Config, error) {
+	serverName := p.TLSServerName
+	if serverName == "" {
+		serverName = p.IP
+	}
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if p.TLSCAFile != "" {
+		pem, err := os.ReadFile(p.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read proxy CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates in %s", p.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if p.TLSCertFile != "" || p.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(p.TLSCertFile, p.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load proxy client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// 在已連到代理的連線上完成 TLS 握手；非 HTTPS 代理則原樣返回
+// 失敗時會關閉 conn
+func wrapProxyTLS(ctx context.Context, p *Proxy, conn net.Conn) (net.Conn, error) {
+	if !isTLSProxy(p) {
+		return conn, nil
+	}
+
+	cfg, err := proxyTLSConfig(p)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with proxy failed: %v", err)
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 將測試伺服器的憑證寫成 PEM 檔，作為自訂 CA
+func writeServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProxyTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	caFile := writeServerCA(t, srv)
+	badPEM := filepath.Join(t.TempDir(), "bad.pem")
+	os.WriteFile(badPEM, []byte("not a certificate"), 0o600)
+
+	tests := []struct {
+		name       string
+		proxy      Proxy
+		serverName string
+		customCA   bool
+		wantErr    bool
+	}{
+		{name: "server name defaults to ip", proxy: Proxy{IP: "203.0.113.5", Protocol: "https"}, serverName: "203.0.113.5"},
+		{name: "server name override", proxy: Proxy{IP: "203.0.113.5", Protocol: "https", TLSServerName: "proxy.example.com"}, serverName: "proxy.example.com"},
+		{name: "custom ca", proxy: Proxy{IP: "203.0.113.5", Protocol: "https", TLSCAFile: caFile}, serverName: "203.0.113.5", customCA: true},
+		{name: "missing ca file", proxy: Proxy{IP: "203.0.113.5", TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: true},
+		{name: "ca file without certificates", proxy: Proxy{IP: "203.0.113.5", TLSCAFile: badPEM}, wantErr: true},
+		{name: "client cert without key", proxy: Proxy{IP: "203.0.113.5", TLSCertFile: caFile}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := proxyTLSConfig(&tt.proxy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("proxyTLSConfig() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("proxyTLSConfig() error: %v", err)
+			}
+			if cfg.ServerName != tt.serverName {
+				t.Errorf("ServerName = %q, want %q", cfg.ServerName, tt.serverName)
+			}
+			if (cfg.RootCAs != nil) != tt.customCA {
+				t.Errorf("RootCAs set = %v, want %v", cfg.RootCAs != nil, tt.customCA)
+			}
+			if cfg.InsecureSkipVerify {
+				t.Error("proxy certificate verification must not be skipped")
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		protocol string
+		want     bool
+	}{{"https", true}, {"HTTPS", true}, {"http", false}, {"socks5", false}, {"", false}} {
+		if got := isTLSProxy(&Proxy{Protocol: tt.protocol}); got != tt.want {
+			t.Errorf("isTLSProxy(%q) = %v, want %v", tt.protocol, got, tt.want)
+		}
+	}
+}
+
+func TestWrapProxyTLSVerifiesCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	tests := []struct {
+		name    string
+		proxy   *Proxy
+		wantErr bool
+	}{
+		{"trusted ca", &Proxy{IP: host, Port: port, Protocol: "https", TLSCAFile: writeServerCA(t, srv)}, false},
+		{"untrusted certificate", &Proxy{IP: host, Port: port, Protocol: "https"}, true},
+		{"plain http proxy untouched", &Proxy{IP: host, Port: port, Protocol: "http"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := wrapProxyTLS(ctx, tt.proxy, raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wrapProxyTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if _, isTLS := conn.(interface{ Handshake() error }); isTLS != isTLSProxy(tt.proxy) {
+					t.Errorf("wrapped as TLS = %v, want %v", isTLS, isTLSProxy(tt.proxy))
+				}
+				conn.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- 分流規則 (Rule Engine) ----------------
+
+// 規則類型
+const (
+	ruleDomain        = "DOMAIN"
+	ruleDomainSuffix  = "DOMAIN-SUFFIX"
+	ruleDomainKeyword = "DOMAIN-KEYWORD"
+	ruleDomainRegex   = "DOMAIN-REGEX"
+	ruleIPCIDR        = "IP-CIDR"
+	ruleIPCIDR6       = "IP-CIDR6"
+	ruleDstPort       = "DST-PORT"
+	ruleMatch         = "MATCH"
+)
+
+// 規則動作
+const (
+	actionDirect = "DIRECT"
+	actionProxy  = "PROXY"
+	actionReject = "REJECT"
+)
+
+// Rule 單條分流規則
+type Rule struct {
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+	Action  string `json:"action"`
+}
+
+func (r Rule) String() string {
+	if r.Type == ruleMatch {
+		return fmt.Sprintf("%s,%s", r.Type, r.Action)
+	}
+	return fmt.Sprintf("%s,%s,%s", r.Type, r.Payload, r.Action)
+}
+
+// 編譯後的規則
+type compiledRule struct {
+	Rule
+	regex   *regexp.Regexp
+	cidr    *net.IPNet
+	portMin int
+	portMax int
+}
+
+// 判斷規則是否符合目標 (host 為小寫主機名或 IP，port 為數字)
+// 註: IP-CIDR 只比對 IP 字面值，不會在本地解析網域 (避免 DNS 洩漏)
+func (r *compiledRule) match(host string, port int) bool {
+	switch r.Type {
+	case ruleDomain:
+		return host == r.Payload
+	case ruleDomainSuffix:
+		return host == r.Payload || strings.HasSuffix(host, "."+r.Payload)
+	case ruleDomainKeyword:
+		return strings.Contains(host, r.Payload)
+	case ruleDomainRegex:
+		return r.regex.MatchString(host)
+	case ruleIPCIDR, ruleIPCIDR6:
+		ip := net.ParseIP(host)
+		return ip != nil && r.cidr.Contains(ip)
+	case ruleDstPort:
+		return port >= r.portMin && port <= r.portMax
+	case ruleMatch:
+		return true
+	}
+	return false
+}
+
+// 解析單行規則，格式: TYPE,PAYLOAD,ACTION 或 MATCH,ACTION
+func parseRule(line string) (*compiledRule, error) {
+	parts := strings.Split(line, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	r := &compiledRule{}
+	r.Type = strings.ToUpper(parts[0])
+	if r.Type == ruleMatch {
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("MATCH rule requires an action")
+		}
+		r.Action = strings.ToUpper(parts[1])
+	} else {
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("rule requires type, payload and action")
+		}
+		r.Payload = parts[1]
+		r.Action = strings.ToUpper(parts[2])
+		if r.Payload == "" {
+			return nil, fmt.Errorf("%s rule requires a payload", r.Type)
+		}
+	}
+
+	switch r.Action {
+	case actionDirect, actionProxy, actionReject:
+	default:
+		return nil, fmt.Errorf("unknown action %q", parts[len(parts)-1])
+	}
+
+	switch r.Type {
+	case ruleDomain, ruleDomainSuffix, ruleDomainKeyword:
+		r.Payload = strings.TrimSuffix(strings.ToLower(r.Payload), ".")
+	case ruleDomainRegex:
+		re, err := regexp.Compile(r.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %v", err)
+		}
+		r.regex = re
+	case ruleIPCIDR, ruleIPCIDR6:
+		_, cidr, err := net.ParseCIDR(r.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %v", err)
+		}
+		r.cidr = cidr
+	case ruleDstPort:
+		lo, hi, isRange := strings.Cut(r.Payload, "-")
+		min, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %s", r.Payload)
+		}
+		max := min
+		if isRange {
+			if max, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("invalid port: %s", r.Payload)
+			}
+		}
+		if min < 0 || max > 65535 || min > max {
+			return nil, fmt.Errorf("invalid port range: %s", r.Payload)
+		}
+		r.portMin, r.portMax = min, max
+	case ruleMatch:
+	default:
+		return nil, fmt.Errorf("unknown rule type %q", parts[0])
+	}
+
+	return r, nil
+}
+
+// 解析整份規則文字，忽略空行與 # 註解
+func parseRules(content string) ([]*compiledRule, error) {
+	var rules []*compiledRule
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// 相容 Clash YAML 清單寫法: "- DOMAIN-SUFFIX,example.com,DIRECT"
+		line = strings.TrimSpace(strings.TrimPrefix(line, "- "))
+
+		r, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, scanner.Err()
+}
+
+// 拆出目標的主機與端口，沒有端口時使用 defaultPort
+func splitTarget(target string, defaultPort int) (string, int) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		host = strings.Trim(target, "[]")
+		return strings.TrimSuffix(strings.ToLower(host), "."), defaultPort
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		port = defaultPort
+	}
+	return strings.TrimSuffix(strings.ToLower(host), "."), port
+}
+
+// 依序比對規則，未命中任何規則時走代理
+func (a *App) matchRule(target string, defaultPort int) (string, *Rule) {
+	host, port := splitTarget(target, defaultPort)
+
+	a.mu.RLock()
+	rules := a.rules
+	a.mu.RUnlock()
+
+	for _, r := range rules {
+		if r.match(host, port) {
+			if a.ctx != nil {
+				wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("規則匹配: %s -> %s (%s)", target, r.Action, r.Rule))
+			}
+			return r.Action, &r.Rule
+		}
+	}
+	if a.ctx != nil && len(rules) > 0 {
+		wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("規則匹配: %s -> %s (default)", target, actionProxy))
+	}
+	return actionProxy, nil
+}
+
+// 12. 由檔案載入規則
+func (a *App) LoadRulesFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Sprintf("read_failed: %v", err)
+	}
+	rules, err := parseRules(string(data))
+	if err != nil {
+		return fmt.Sprintf("parse_failed: %v", err)
+	}
+
+	a.mu.Lock()
+	a.rules = rules
+	a.rulesPath = path
+	a.mu.Unlock()
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Loaded %d rules from %s", len(rules), path))
+	}
+	return "Success"
+}
+
+// 12-1. 以對話框選擇規則檔並載入
+func (a *App) OpenRulesFile() string {
+	f, err := wailsRuntime.OpenFileDialog(a.ctx, wailsRuntime.OpenDialogOptions{
+		Title: "Open Rules File",
+		Filters: []wailsRuntime.FileFilter{
+			{DisplayName: "Rule Files", Pattern: "*.txt;*.list;*.conf;*.yaml"},
+		},
+	})
+	if err != nil || f == "" {
+		return ""
+	}
+	return a.LoadRulesFile(f)
+}
+
+// 12-2. 重新載入目前的規則檔 (執行中即時生效)
+func (a *App) ReloadRules() string {
+	a.mu.RLock()
+	path := a.rulesPath
+	a.mu.RUnlock()
+
+	if path == "" {
+		return "no_rules_file"
+	}
+	return a.LoadRulesFile(path)
+}
+
+// 12-3. 直接以文字設定規則 (不綁定檔案)
+func (a *App) SetRules(content string) string {
+	rules, err := parseRules(content)
+	if err != nil {
+		return fmt.Sprintf("parse_failed: %v", err)
+	}
+
+	a.mu.Lock()
+	a.rules = rules
+	a.rulesPath = ""
+	a.mu.Unlock()
+	return "Success"
+}
+
+// 12-4. 取得目前生效的規則
+func (a *App) GetRules() []Rule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	result := make([]Rule, 0, len(a.rules))
+	for _, r := range a.rules {
+		result = append(result, r.Rule)
+	}
+	return result
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Rule
+		portMin int
+		portMax int
+		wantErr bool
+	}{
+		{name: "domain", line: "DOMAIN,Example.COM.,DIRECT", want: Rule{Type: ruleDomain, Payload: "example.com", Action: actionDirect}},
+		{name: "domain suffix", line: " domain-suffix , example.com , proxy ", want: Rule{Type: ruleDomainSuffix, Payload: "example.com", Action: actionProxy}},
+		{name: "domain keyword", line: "DOMAIN-KEYWORD,google,REJECT", want: Rule{Type: ruleDomainKeyword, Payload: "google", Action: actionReject}},
+		{name: "domain regex", line: `DOMAIN-REGEX,^ad[0-9]+\.,REJECT`, want: Rule{Type: ruleDomainRegex, Payload: `^ad[0-9]+\.`, Action: actionReject}},
+		{name: "ip cidr", line: "IP-CIDR,10.0.0.0/8,DIRECT", want: Rule{Type: ruleIPCIDR, Payload: "10.0.0.0/8", Action: actionDirect}},
+		{name: "ip cidr6", line: "IP-CIDR6,2001:db8::/32,DIRECT", want: Rule{Type: ruleIPCIDR6, Payload: "2001:db8::/32", Action: actionDirect}},
+		{name: "clash no-resolve option", line: "IP-CIDR,192.168.0.0/16,DIRECT,no-resolve", want: Rule{Type: ruleIPCIDR, Payload: "192.168.0.0/16", Action: actionDirect}},
+		{name: "single port", line: "DST-PORT,443,PROXY", want: Rule{Type: ruleDstPort, Payload: "443", Action: actionProxy}, portMin: 443, portMax: 443},
+		{name: "port range", line: "DST-PORT,8000-8999,DIRECT", want: Rule{Type: ruleDstPort, Payload: "8000-8999", Action: actionDirect}, portMin: 8000, portMax: 8999},
+		{name: "full port range", line: "DST-PORT,0-65535,DIRECT", want: Rule{Type: ruleDstPort, Payload: "0-65535", Action: actionDirect}, portMin: 0, portMax: 65535},
+		{name: "match", line: "MATCH,direct", want: Rule{Type: ruleMatch, Action: actionDirect}},
+
+		{name: "empty", line: "", wantErr: true},
+		{name: "type only", line: "DOMAIN", wantErr: true},
+		{name: "missing action", line: "DOMAIN,example.com", wantErr: true},
+		{name: "empty payload", line: "DOMAIN,,DIRECT", wantErr: true},
+		{name: "empty action", line: "DOMAIN,example.com,", wantErr: true},
+		{name: "unknown action", line: "DOMAIN,example.com,ALLOW", wantErr: true},
+		{name: "unknown type", line: "GEOIP,CN,DIRECT", wantErr: true},
+		{name: "match without action", line: "MATCH", wantErr: true},
+		{name: "match with payload", line: "MATCH,example.com,DIRECT", wantErr: true},
+		{name: "invalid regex", line: "DOMAIN-REGEX,(,DIRECT", wantErr: true},
+		{name: "cidr without mask", line: "IP-CIDR,10.0.0.1,DIRECT", wantErr: true},
+		{name: "cidr mask oversized", line: "IP-CIDR,10.0.0.0/33,DIRECT", wantErr: true},
+		{name: "cidr malformed", line: "IP-CIDR,10.0.0/8,DIRECT", wantErr: true},
+		{name: "port not numeric", line: "DST-PORT,https,DIRECT", wantErr: true},
+		{name: "port oversized", line: "DST-PORT,65536,DIRECT", wantErr: true},
+		{name: "port overflow", line: "DST-PORT," + strings.Repeat("9", 30) + ",DIRECT", wantErr: true},
+		{name: "port negative", line: "DST-PORT,-1,DIRECT", wantErr: true},
+		{name: "port range truncated", line: "DST-PORT,80-,DIRECT", wantErr: true},
+		{name: "port range reversed", line: "DST-PORT,9000-8000,DIRECT", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseRule(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRule(%q) = %+v, want error", tt.line, r.Rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRule(%q) error: %v", tt.line, err)
+			}
+			if r.Rule != tt.want {
+				t.Errorf("parseRule(%q) = %+v, want %+v", tt.line, r.Rule, tt.want)
+			}
+			if r.Type == ruleDstPort && (r.portMin != tt.portMin || r.portMax != tt.portMax) {
+				t.Errorf("parseRule(%q) ports = %d-%d, want %d-%d", tt.line, r.portMin, r.portMax, tt.portMin, tt.portMax)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	content := `# 註解
+DOMAIN-SUFFIX,example.com,DIRECT
+
+  - IP-CIDR,10.0.0.0/8,DIRECT
+MATCH,PROXY
+`
+	rules, err := parseRules(content)
+	if err != nil {
+		t.Fatalf("parseRules() error: %v", err)
+	}
+	want := []Rule{
+		{Type: ruleDomainSuffix, Payload: "example.com", Action: actionDirect},
+		{Type: ruleIPCIDR, Payload: "10.0.0.0/8", Action: actionDirect},
+		{Type: ruleMatch, Action: actionProxy},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("parseRules() returned %d rules, want %d", len(rules), len(want))
+	}
+	for i, r := range rules {
+		if r.Rule != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, r.Rule, want[i])
+		}
+	}
+
+	_, err = parseRules("DOMAIN,a.com,DIRECT\n\nDOMAIN,b.com,ALLOW\n")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("parseRules() error = %v, want line 3", err)
+	}
+}
+
+func TestSplitTarget(t *testing.T) {
+	tests := []struct {
+		target   string
+		wantHost string
+		wantPort int
+	}{
+		{"Example.COM:443", "example.com", 443},
+		{"example.com.:80", "example.com", 80},
+		{"example.com", "example.com", 80},
+		{"10.0.0.1:8080", "10.0.0.1", 8080},
+		{"[2001:db8::1]:443", "2001:db8::1", 443},
+		{"[2001:db8::1]", "2001:db8::1", 80},
+		{"example.com:http", "example.com", 80},
+	}
+	for _, tt := range tests {
+		host, port := splitTarget(tt.target, 80)
+		if host != tt.wantHost || port != tt.wantPort {
+			t.Errorf("splitTarget(%q) = %q, %d, want %q, %d", tt.target, host, port, tt.wantHost, tt.wantPort)
+		}
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	rules, err := parseRules(`
+DOMAIN,exact.example.com,REJECT
+DOMAIN-SUFFIX,example.com,DIRECT
+DOMAIN-KEYWORD,tracker,REJECT
+DOMAIN-REGEX,^cdn[0-9]+\.,DIRECT
+IP-CIDR,192.168.0.0/16,DIRECT
+IP-CIDR6,fd00::/8,DIRECT
+DST-PORT,25,REJECT
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{rules: rules}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"exact.example.com:443", actionReject},
+		{"EXACT.example.com.:443", actionReject},
+		{"www.example.com:443", actionDirect},
+		{"example.com:443", actionDirect},
+		{"notexample.com:443", actionProxy},
+		{"ads.tracker.net:80", actionReject},
+		{"cdn12.other.net:443", actionDirect},
+		{"xcdn1.other.net:443", actionProxy},
+		{"192.168.1.10:22", actionDirect},
+		{"192.169.1.10:22", actionProxy},
+		{"[fd12::1]:443", actionDirect},
+		// IP-CIDR 不解析網域
+		{"localhost:22", actionProxy},
+		{"mail.other.net:25", actionReject},
+		{"other.net:443", actionProxy},
+	}
+	for _, tt := range tests {
+		if got, _ := a.matchRule(tt.target, 80); got != tt.want {
+			t.Errorf("matchRule(%q) = %s, want %s", tt.target, got, tt.want)
+		}
+	}
+
+	if action, rule := (&App{}).matchRule("example.com:443", 80); action != actionProxy || rule != nil {
+		t.Errorf("matchRule() without rules = %s, %v, want PROXY, nil", action, rule)
+	}
+	a.rules = append(a.rules, mustParseRule(t, "MATCH,DIRECT"))
+	if action, rule := a.matchRule("other.net:443", 80); action != actionDirect || rule == nil || rule.Type != ruleMatch {
+		t.Errorf("matchRule() fallthrough = %s, %v, want MATCH rule", action, rule)
+	}
+}
+
+func mustParseRule(t *testing.T, line string) *compiledRule {
+	t.Helper()
+	r, err := parseRule(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ---------------- 流量嗅探 (TLS SNI / HTTP Host) ----------------
+
+const (
+	sniffMaxTLSRecord = 16384 + 5 // TLS 記錄上限 (含 5 bytes 標頭)
+	sniffMaxHTTPHead  = 8192
+)
+
+var errSniffDone = errors.New("sniff done")
+
+// 從連線開頭的資料取出主機名稱 (TLS ClientHello 的 SNI 或 HTTP Host 標頭)
+// 呼叫者需先設定讀取期限；資料仍保留在 br 中，取不到時回傳空字串
+func sniffHost(br *bufio.Reader) string {
+	first, err := br.Peek(1)
+	if err != nil {
+		return ""
+	}
+
+	if first[0] == 0x16 { // TLS handshake
+		hdr, err := br.Peek(5)
+		if err != nil {
+			return ""
+		}
+		n := 5 + int(binary.BigEndian.Uint16(hdr[3:5]))
+		if n > sniffMaxTLSRecord || n > br.Size() {
+			return ""
+		}
+		record, err := br.Peek(n)
+		if err != nil {
+			return ""
+		}
+		return validSniffedHost(tlsServerName(record))
+	}
+
+	if first[0] >= 'A' && first[0] <= 'Z' {
+		return validSniffedHost(httpHost(br))
+	}
+	return ""
+}
+
+// 以 crypto/tls 解析 ClientHello，取得 SNI 後即中止握手
+func tlsServerName(record []byte) string {
+	var name string
+	conn := &sniffConn{r: bytes.NewReader(record)}
+	tls.Server(conn, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			name = info.ServerName
+			return nil, errSniffDone
+		},
+	}).Handshake()
+	return name
+}
+
+// 逐步讀入 HTTP 請求標頭直到取得 Host 或標頭結束
+func httpHost(br *bufio.Reader) string {
+	for {
+		buf, _ := br.Peek(br.Buffered())
+		// 只檢查前 sniffMaxHTTPHead 位元組，結果不受封包切割方式影響
+		if len(buf) > sniffMaxHTTPHead {
+			buf = buf[:sniffMaxHTTPHead]
+		}
+		if end := bytes.Index(buf, []byte("\r\n\r\n")); end >= 0 {
+			return parseHostHeader(buf[:end+4])
+		}
+		if host := parseHostHeader(buf); host != "" {
+			return host
+		}
+		if len(buf) >= sniffMaxHTTPHead || len(buf) >= br.Size() {
+			return ""
+		}
+		// 等待下一段資料 (逾時由呼叫者的讀取期限控制)
+		if _, err := br.Peek(len(buf) + 1); err != nil {
+			return ""
+		}
+	}
+}
+
+// 在已讀入的標頭中尋找完整的 Host 行
+func parseHostHeader(head []byte) string {
+	lines := strings.Split(string(head), "\r\n")
+	// 最後一段可能尚未收完整
+	for _, line := range lines[1 : len(lines)-1] {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key)) == "Host" {
+			host, _ := splitTarget(strings.TrimSpace(value), 0)
+			return host
+		}
+	}
+	return ""
+}
+
+// 只接受看起來像網域名稱的結果，IP 位址以原始目標為準
+func validSniffedHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || len(host) > 253 || net.ParseIP(host) != nil {
+		return ""
+	}
+	for _, c := range host {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_') {
+			return ""
+		}
+	}
+	return host
+}
+
+// sniffConn 只供解析 ClientHello 使用: 讀取已擷取的資料，寫入一律丟棄
+type sniffConn struct {
+	r io.Reader
+}
+
+func (c *sniffConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c *sniffConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *sniffConn) Close() error                       { return nil }
+func (c *sniffConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *sniffConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *sniffConn) SetDeadline(t time.Time) error      { return nil }
+func (c *sniffConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *sniffConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// 擷取 tls.Client 送出的 ClientHello
+type helloRecorder struct {
+	sniffConn
+	buf bytes.Buffer
+}
+
+func (c *helloRecorder) Write(b []byte) (int, error) { return c.buf.Write(b) }
+
+func clientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	conn := &helloRecorder{sniffConn: sniffConn{r: strings.NewReader("")}}
+	tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+	if conn.buf.Len() < 5 || conn.buf.Bytes()[0] != 0x16 {
+		t.Fatalf("no ClientHello recorded for %q", serverName)
+	}
+	return conn.buf.Bytes()
+}
+
+func TestSniffHost(t *testing.T) {
+	hello := clientHello(t, "www.example.com")
+	oversized := append([]byte{0x16, 0x03, 0x01}, binary.BigEndian.AppendUint16(nil, sniffMaxTLSRecord)...)
+	garbage := append([]byte{0x16, 0x03, 0x01, 0x00, 0x08}, bytes.Repeat([]byte{0xff}, 8)...)
+
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"tls sni", hello, "www.example.com"},
+		{"tls sni upper case", clientHello(t, "WWW.Example.COM"), "www.example.com"},
+		{"tls without sni", clientHello(t, "192.0.2.1"), ""},
+		{"tls record truncated", hello[:len(hello)/2], ""},
+		{"tls header truncated", hello[:3], ""},
+		{"tls record oversized", oversized, ""},
+		{"tls record malformed", garbage, ""},
+
+		{"http host", []byte("GET / HTTP/1.1\r\nHost: example.com\r\nAccept: */*\r\n\r\n"), "example.com"},
+		{"http host with port", []byte("POST /x HTTP/1.1\r\nhost: Example.com:8080\r\n\r\nbody"), "example.com"},
+		{"http host trailing dot", []byte("GET / HTTP/1.1\r\nHost: example.com.\r\n\r\n"), "example.com"},
+		{"http head truncated after host", []byte("GET / HTTP/1.1\r\nHost: example.com\r\nUser-Ag"), "example.com"},
+		{"http host line truncated", []byte("GET / HTTP/1.1\r\nHost: exam"), ""},
+		{"http without host", []byte("GET / HTTP/1.0\r\nAccept: */*\r\n\r\n"), ""},
+		{"http host is ip", []byte("GET / HTTP/1.1\r\nHost: 192.0.2.1\r\n\r\n"), ""},
+		{"http host is ipv6", []byte("GET / HTTP/1.1\r\nHost: [2001:db8::1]:80\r\n\r\n"), ""},
+		{"http host invalid characters", []byte("GET / HTTP/1.1\r\nHost: exa mple.com\r\n\r\n"), ""},
+		{"http head oversized", append([]byte("GET / HTTP/1.1\r\nX-Pad: "), bytes.Repeat([]byte("a"), sniffMaxHTTPHead)...), ""},
+		{"http host after oversized head", []byte("GET / HTTP/1.1\r\nX-Pad: " + strings.Repeat("a", sniffMaxHTTPHead) + "\r\nHost: example.com\r\n\r\n"), ""},
+
+		{"empty", nil, ""},
+		{"not tls or http", []byte{0x05, 0x01, 0x00}, ""},
+		{"lower case method", []byte("get / HTTP/1.1\r\nHost: example.com\r\n\r\n"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReaderSize(bytes.NewReader(tt.in), sniffMaxTLSRecord)
+			if got := sniffHost(br); got != tt.want {
+				t.Errorf("sniffHost() = %q, want %q", got, tt.want)
+			}
+			// 嗅探不可消耗資料，轉發時仍需送出完整內容
+			rest, _ := io.ReadAll(br)
+			if !bytes.Equal(rest, tt.in) {
+				t.Errorf("sniffHost() consumed data: %d of %d bytes left", len(rest), len(tt.in))
+			}
+		})
+	}
+}
+
+// HTTP 標頭分段抵達時需等待後續資料
+func TestSniffHostSplitHTTP(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		client.Write([]byte("GET / HTTP/1.1\r\nAcc"))
+		client.Write([]byte("ept: */*\r\nHost: split.example.com\r\n\r\n"))
+	}()
+	if got := sniffHost(bufio.NewReaderSize(server, sniffMaxTLSRecord)); got != "split.example.com" {
+		t.Errorf("sniffHost() = %q, want %q", got, "split.example.com")
+	}
+}
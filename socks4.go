@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ---------------- SOCKS4 / SOCKS4a 上游撥號器 ----------------
+
+const (
+	socks4Version    = 0x04
+	socks4CmdConnect = 0x01
+
+	socks4Granted          = 0x5A
+	socks4Rejected         = 0x5B
+	socks4IdentdFailed     = 0x5C
+	socks4IdentdMismatch   = 0x5D
+	socks4HandshakeTimeout = 10 * time.Second
+)
+
+var (
+	errSocks4IPv6     = errors.New("socks4: IPv6 destinations are not supported")
+	errSocks4Rejected = errors.New("socks4: request rejected or failed")
+)
+
+// socks4Dialer 透過 SOCKS4 代理建立 TCP 連線
+// remoteResolve 為 true 時使用 SOCKS4a，由代理端解析主機名稱
+type socks4Dialer struct {
+	addr          string
+	userID        string
+	remoteResolve bool
+	forward       proxy.Dialer
+}
+
+func (d *socks4Dialer) Dial(network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" {
+		return nil, fmt.Errorf("socks4: network %s not supported", network)
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("socks4: invalid port %q", portStr)
+	}
+
+	// SOCKS4 僅接受 IPv4；SOCKS4a 可將主機名稱交給代理解析
+	var ip net.IP
+	domain := ""
+	if parsed := net.ParseIP(host); parsed != nil {
+		if ip = parsed.To4(); ip == nil {
+			return nil, errSocks4IPv6
+		}
+	} else if d.remoteResolve {
+		// 0.0.0.x (x != 0) 告知代理使用後方附帶的主機名稱
+		ip = net.IPv4(0, 0, 0, 1).To4()
+		domain = host
+	} else {
+		addrs, err := net.LookupIP(host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			if v4 := a.To4(); v4 != nil {
+				ip = v4
+				break
+			}
+		}
+		if ip == nil {
+			return nil, fmt.Errorf("socks4: no IPv4 address for %s", host)
+		}
+	}
+
+	conn, err := d.forward.Dial("tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 在代理鏈中時沿用整條鏈的期限，由 dialChain 設定與清除
+	_, chained := d.forward.(*connDialer)
+	if !chained {
+		conn.SetDeadline(time.Now().Add(socks4HandshakeTimeout))
+	}
+	if err := socks4Handshake(conn, ip, uint16(port), d.userID, domain); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !chained {
+		conn.SetDeadline(time.Time{})
+	}
+
+	return conn, nil
+}
+
+// 發送 SOCKS4(a) CONNECT 請求並讀取回應
+// 請求: VN CD DSTPORT DSTIP USERID NUL [HOSTNAME NUL]
+// 回應: VN CD DSTPORT DSTIP
+func socks4Handshake(conn net.Conn, ip net.IP, port uint16, userID, domain string) error {
+	req := []byte{socks4Version, socks4CmdConnect}
+	req = binary.BigEndian.AppendUint16(req, port)
+	req = append(req, ip...)
+	req = append(req, userID...)
+	req = append(req, 0x00)
+	if domain != "" {
+		req = append(req, domain...)
+		req = append(req, 0x00)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 8)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+
+	switch resp[1] {
+	case socks4Granted:
+		return nil
+	case socks4Rejected:
+		return errSocks4Rejected
+	case socks4IdentdFailed:
+		return errors.New("socks4: proxy could not reach identd")
+	case socks4IdentdMismatch:
+		return errProxyAuthRequired
+	default:
+		return fmt.Errorf("socks4: unexpected reply code 0x%02x", resp[1])
+	}
+}
+
+// 是否為 SOCKS 系列協定
+func isSocksProtocol(protocol string) bool {
+	switch strings.ToLower(protocol) {
+	case "socks5", "socks4", "socks4a":
+		return true
+	}
+	return false
+}
+
+// 依協定建立 SOCKS 撥號器 (socks5 / socks4 / socks4a)
+func socksDialer(p *Proxy, forward proxy.Dialer) (proxy.Dialer, error) {
+	addr := net.JoinHostPort(p.IP, p.Port)
+
+	switch strings.ToLower(p.Protocol) {
+	case "socks5":
+		return proxy.SOCKS5("tcp", addr, socksAuth(p), forward)
+	case "socks4":
+		return &socks4Dialer{addr: addr, userID: p.Username, forward: forward}, nil
+	case "socks4a":
+		return &socks4Dialer{addr: addr, userID: p.Username, remoteResolve: true, forward: forward}, nil
+	default:
+		return nil, fmt.Errorf("unsupported socks protocol: %s", p.Protocol)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSocks4Handshake(t *testing.T) {
+	ip := net.IPv4(192, 0, 2, 10).To4()
+	plainReq := []byte{socks4Version, socks4CmdConnect, 0x01, 0xbb, 192, 0, 2, 10, 'u', 's', 'e', 'r', 0x00}
+	domainReq := append([]byte{socks4Version, socks4CmdConnect, 0x00, 0x50, 0, 0, 0, 1, 0x00}, append([]byte("example.com"), 0x00)...)
+
+	tests := []struct {
+		name    string
+		ip      net.IP
+		port    uint16
+		userID  string
+		domain  string
+		wantReq []byte
+		reply   []byte
+		err     error // nil 表示成功
+		anyErr  bool  // 只要求失敗，不比對錯誤
+	}{
+		{name: "granted", ip: ip, port: 443, userID: "user", wantReq: plainReq, reply: []byte{0, socks4Granted, 0, 0, 0, 0, 0, 0}},
+		{name: "granted socks4a", ip: net.IPv4(0, 0, 0, 1).To4(), port: 80, domain: "example.com", wantReq: domainReq, reply: []byte{0, socks4Granted, 0, 0, 0, 0, 0, 0}},
+		{name: "rejected", ip: ip, port: 443, userID: "user", wantReq: plainReq, reply: []byte{0, socks4Rejected, 0, 0, 0, 0, 0, 0}, err: errSocks4Rejected},
+		{name: "identd unreachable", ip: ip, port: 443, userID: "user", wantReq: plainReq, reply: []byte{0, socks4IdentdFailed, 0, 0, 0, 0, 0, 0}, anyErr: true},
+		{name: "identd mismatch", ip: ip, port: 443, userID: "user", wantReq: plainReq, reply: []byte{0, socks4IdentdMismatch, 0, 0, 0, 0, 0, 0}, err: errProxyAuthRequired},
+		{name: "unknown reply code", ip: ip, port: 443, userID: "user", wantReq: plainReq, reply: []byte{0, 0x00, 0, 0, 0, 0, 0, 0}, anyErr: true},
+		{name: "reply truncated", ip: ip, port: 443, userID: "user", wantReq: plainReq, reply: []byte{0, socks4Granted, 0, 0}, err: io.ErrUnexpectedEOF},
+		{name: "no reply", ip: ip, port: 443, userID: "user", wantReq: plainReq, reply: nil, err: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+
+			gotReq := make(chan []byte, 1)
+			go func() {
+				defer server.Close()
+				req := make([]byte, len(tt.wantReq))
+				if _, err := io.ReadFull(server, req); err != nil {
+					gotReq <- nil
+					return
+				}
+				gotReq <- req
+				server.Write(tt.reply)
+			}()
+
+			err := socks4Handshake(client, tt.ip, tt.port, tt.userID, tt.domain)
+			if req := <-gotReq; !bytes.Equal(req, tt.wantReq) {
+				t.Errorf("request = %x, want %x", req, tt.wantReq)
+			}
+			switch {
+			case tt.anyErr:
+				if err == nil {
+					t.Fatal("socks4Handshake() succeeded, want error")
+				}
+			case !errors.Is(err, tt.err):
+				t.Fatalf("socks4Handshake() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+// 回覆之後緊接的資料屬於通道，握手不可多讀
+func TestSocks4HandshakeLeavesTunnelData(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		io.ReadFull(server, make([]byte, 9))
+		server.Write(append([]byte{0, socks4Granted, 0, 0, 0, 0, 0, 0}, "HTTP/1.1 200 OK\r\n"...))
+	}()
+
+	if err := socks4Handshake(client, net.IPv4(192, 0, 2, 10).To4(), 80, "", ""); err != nil {
+		t.Fatalf("socks4Handshake() error: %v", err)
+	}
+	rest, _ := io.ReadAll(client)
+	if string(rest) != "HTTP/1.1 200 OK\r\n" {
+		t.Errorf("tunnel data = %q", rest)
+	}
+}
+
+// pipeDialer 回傳 net.Pipe 的一端，另一端交給測試模擬代理
+type pipeDialer struct {
+	server chan net.Conn
+}
+
+func (d *pipeDialer) Dial(network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	d.server <- server
+	return client, nil
+}
+
+func TestSocks4DialerDial(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		addr    string
+		remote  bool
+		wantReq []byte // nil 表示不應連線到代理
+		wantErr error
+	}{
+		{name: "ipv4", network: "tcp", addr: "192.0.2.10:80", wantReq: []byte{4, 1, 0, 80, 192, 0, 2, 10, 0}},
+		{name: "socks4a hostname", network: "tcp", addr: "example.com:443", remote: true,
+			wantReq: append([]byte{4, 1, 0x01, 0xbb, 0, 0, 0, 1, 0}, append([]byte("example.com"), 0)...)},
+		{name: "ipv6 destination", network: "tcp", addr: "[2001:db8::1]:80", wantErr: errSocks4IPv6},
+		{name: "udp network", network: "udp", addr: "192.0.2.10:53"},
+		{name: "port out of range", network: "tcp", addr: "192.0.2.10:70000"},
+		{name: "missing port", network: "tcp", addr: "192.0.2.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fwd := &pipeDialer{server: make(chan net.Conn, 1)}
+			d := &socks4Dialer{addr: "proxy:1080", remoteResolve: tt.remote, forward: fwd}
+
+			gotReq := make(chan []byte, 1)
+			go func() {
+				server, ok := <-fwd.server
+				if !ok {
+					return
+				}
+				defer server.Close()
+				req := make([]byte, len(tt.wantReq))
+				io.ReadFull(server, req)
+				gotReq <- req
+				server.Write([]byte{0, socks4Granted, 0, 0, 0, 0, 0, 0})
+			}()
+
+			conn, err := d.Dial(tt.network, tt.addr)
+			if tt.wantReq == nil {
+				close(fwd.server)
+				if err == nil {
+					conn.Close()
+					t.Fatal("Dial() succeeded, want error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Dial() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dial() error: %v", err)
+			}
+			conn.Close()
+			if req := <-gotReq; !bytes.Equal(req, tt.wantReq) {
+				t.Errorf("request = %x, want %x", req, tt.wantReq)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- SOCKS5 入站伺服器 ----------------
+
+// RFC 1928 / RFC 1929 常數
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xFF
+
+	socks5PasswordVersion = 0x01
+
+	socks5CmdConnect      = 0x01
+	socks5CmdUDPAssociate = 0x03
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5RepSucceeded        = 0x00
+	socks5RepGeneralFailure   = 0x01
+	socks5RepNotAllowed       = 0x02
+	socks5RepHostUnreachable  = 0x04
+	socks5RepCmdNotSupported  = 0x07
+	socks5RepAtypNotSupported = 0x08
+
+	socks5HandshakeTimeout = 10 * time.Second
+)
+
+var errSocksAtypNotSupported = errors.New("socks5: address type not supported")
+
+// 啟動 SOCKS5 入站監聽 (與 HTTP 中轉伺服器一同啟動)
+func (a *App) startSocksServer() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.socksListener != nil {
+		return nil // 已經啟動
+	}
+	// 端口留空表示停用 SOCKS5 入站
+	if a.socksPort == "" {
+		return nil
+	}
+
+	ln, err := listenTCP(a.listenAddrsLocked(), a.socksPort)
+	if err != nil {
+		return fmt.Errorf("socks5 port %s is already in use: %v", a.socksPort, err)
+	}
+	ln = &trackedListener{Listener: ln, tracker: &a.clients}
+	a.socksListener = ln
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Starting SOCKS5 inbound on port %s", a.socksPort))
+	}
+	go a.serveSocks(ln)
+	return nil
+}
+
+// 停止 SOCKS5 入站監聽 (呼叫者需持有 a.mu)
+func (a *App) stopSocksServerLocked() {
+	if a.socksListener != nil {
+		a.socksListener.Close()
+		a.socksListener = nil
+	}
+}
+
+func (a *App) serveSocks(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			// 監聽器已關閉
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if a.ctx != nil {
+				wailsRuntime.LogError(a.ctx, fmt.Sprintf("SOCKS5 accept error: %v", err))
+			}
+			return
+		}
+		go a.handleSocksConn(conn)
+	}
+}
+
+// 處理單一 SOCKS5 客戶端連線
+func (a *App) handleSocksConn(conn net.Conn) {
+	defer conn.Close()
+
+	// 區域網路客戶端需在允許清單內
+	if client := remoteIP(conn.RemoteAddr()); !a.clientAllowed(client) {
+		if a.ctx != nil {
+			wailsRuntime.LogWarning(a.ctx, fmt.Sprintf("SOCKS5 client %s not allowed", client))
+		}
+		return
+	}
+
+	conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	br := bufio.NewReader(conn)
+
+	if err := a.socksNegotiate(br, conn); err != nil {
+		if a.ctx != nil {
+			wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("SOCKS5 handshake failed from %s: %v", conn.RemoteAddr(), err))
+		}
+		return
+	}
+
+	// 讀取請求: VER CMD RSV ATYP DST.ADDR DST.PORT
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return
+	}
+	if header[0] != socks5Version {
+		return
+	}
+
+	target, err := readSocksAddr(br, header[3])
+	if err != nil {
+		if errors.Is(err, errSocksAtypNotSupported) {
+			writeSocksReply(conn, socks5RepAtypNotSupported, nil)
+		}
+		return
+	}
+
+	if header[1] == socks5CmdUDPAssociate {
+		a.handleUDPAssociate(conn, target)
+		return
+	}
+	if header[1] != socks5CmdConnect {
+		writeSocksReply(conn, socks5RepCmdNotSupported, nil)
+		return
+	}
+
+	// 依分流規則決定直連、走代理或阻擋
+	var remote *Proxy
+	switch action, _ := a.matchRule(target, 0); action {
+	case actionReject:
+		writeSocksReply(conn, socks5RepNotAllowed, nil)
+		return
+	case actionProxy:
+		remote = a.pickUpstream(target)
+		if remote == nil {
+			writeSocksReply(conn, socks5RepGeneralFailure, nil)
+			return
+		}
+	}
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("收到 SOCKS5 請求: CONNECT %s", target))
+	}
+
+	lc := a.conns.add(connKindSocks, remoteIP(conn.RemoteAddr()), target, remote)
+	defer a.conns.remove(lc)
+	lc.onKill(func() { conn.Close() })
+
+	var flow *trafficFlow
+	rec := a.inspector.begin(connKindSocks, http.MethodConnect, "socks5://"+target, remoteIP(conn.RemoteAddr()), transportLabel(remote), nil)
+	defer func() { rec.finish(flow) }()
+
+	upstream, err := dialUpstream(remote, target, a.routeResolver(remote))
+	if err != nil {
+		rec.status(http.StatusBadGateway)
+		rec.fail(err)
+	}
+	if errors.Is(err, errProxyAuthRequired) {
+		if a.ctx != nil {
+			wailsRuntime.EventsEmit(a.ctx, "proxy_auth_failed", remote.IP)
+		}
+		writeSocksReply(conn, socks5RepGeneralFailure, nil)
+		return
+	}
+	if err != nil {
+		if upstreamFault(err) {
+			a.reportUpstream(remote, false)
+		}
+		writeSocksReply(conn, socks5RepHostUnreachable, nil)
+		return
+	}
+	defer upstream.Close()
+	a.reportUpstream(remote, true)
+	rec.status(http.StatusOK)
+
+	flow = a.beginTraffic(remoteIP(conn.RemoteAddr()), target, remote)
+	defer flow.end()
+
+	lc.attach(flow)
+	lc.onKill(func() { upstream.Close() })
+	lc.setState(connStateEstablished)
+
+	if err := writeSocksReply(conn, socks5RepSucceeded, upstream.LocalAddr()); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	// 握手期間已緩衝的資料需先送出
+	if n := br.Buffered(); n > 0 {
+		buffered, _ := br.Peek(n)
+		if _, err := upstream.Write(buffered); err != nil {
+			return
+		}
+		flow.addUp(n)
+	}
+
+	relayConns(conn, upstream, a.tunnelLimits(), flow)
+}
+
+// 協商認證方式，若有設定帳密則要求 username/password 認證
+func (a *App) socksNegotiate(br *bufio.Reader, conn net.Conn) error {
+	// VER NMETHODS METHODS...
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return err
+	}
+	if head[0] != socks5Version {
+		return fmt.Errorf("unsupported version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	user, pass := a.socksUser, a.socksPass
+	a.mu.RUnlock()
+
+	// 未設定 SOCKS5 帳密時，區域網路客戶端沿用分享模式的入站帳密
+	if user == "" {
+		user, pass = a.inboundCredentials(remoteIP(conn.RemoteAddr()))
+	}
+
+	want := byte(socks5AuthNone)
+	if user != "" {
+		want = socks5AuthPassword
+	}
+
+	offered := false
+	for _, m := range methods {
+		if m == want {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return fmt.Errorf("no acceptable auth method")
+	}
+	if _, err := conn.Write([]byte{socks5Version, want}); err != nil {
+		return err
+	}
+
+	if want == socks5AuthNone {
+		return nil
+	}
+
+	// RFC 1929: VER ULEN UNAME PLEN PASSWD
+	ver, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	if ver != socks5PasswordVersion {
+		return fmt.Errorf("unsupported auth version %d", ver)
+	}
+	u, err := readSocksString(br)
+	if err != nil {
+		return err
+	}
+	p, err := readSocksString(br)
+	if err != nil {
+		return err
+	}
+
+	if u != user || p != pass {
+		conn.Write([]byte{socks5PasswordVersion, 0x01})
+		return fmt.Errorf("invalid credentials for user %q", u)
+	}
+	_, err = conn.Write([]byte{socks5PasswordVersion, 0x00})
+	return err
+}
+
+// 讀取一個長度前綴字串
+func readSocksString(r *bufio.Reader) (string, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// 依 ATYP 讀取目標位址，回傳 host:port
+func readSocksAddr(r *bufio.Reader, atyp byte) (string, error) {
+	var host string
+	switch atyp {
+	case socks5AtypIPv4:
+		buf := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		host = net.IP(buf).String()
+	case socks5AtypIPv6:
+		buf := make([]byte, net.IPv6len)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		host = net.IP(buf).String()
+	case socks5AtypDomain:
+		domain, err := readSocksString(r)
+		if err != nil {
+			return "", err
+		}
+		host = domain
+	default:
+		return "", errSocksAtypNotSupported
+	}
+
+	portBuf := make([]byte, 2)
+	if _, err := io.ReadFull(r, portBuf); err != nil {
+		return "", err
+	}
+	port := binary.BigEndian.Uint16(portBuf)
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// 回覆 SOCKS5 請求結果，bind 為 nil 時以 0.0.0.0:0 回覆
+func writeSocksReply(w io.Writer, rep byte, bind net.Addr) error {
+	var bindIP net.IP
+	port := 0
+	switch addr := bind.(type) {
+	case *net.TCPAddr:
+		bindIP, port = addr.IP, addr.Port
+	case *net.UDPAddr:
+		bindIP, port = addr.IP, addr.Port
+	}
+
+	ip := net.IPv4zero.To4()
+	if v4 := bindIP.To4(); v4 != nil {
+		ip = v4
+	} else if bindIP != nil {
+		ip = bindIP.To16()
+	}
+
+	atyp := byte(socks5AtypIPv4)
+	if len(ip) == net.IPv6len {
+		atyp = socks5AtypIPv6
+	}
+
+	reply := []byte{socks5Version, rep, 0x00, atyp}
+	reply = append(reply, ip...)
+	reply = binary.BigEndian.AppendUint16(reply, uint16(port))
+	_, err := w.Write(reply)
+	return err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestReadSocksAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		atyp byte
+		in   []byte
+		want string
+		err  error
+	}{
+		{name: "ipv4", atyp: socks5AtypIPv4, in: []byte{10, 0, 0, 1, 0x1f, 0x90}, want: "10.0.0.1:8080"},
+		{name: "ipv6", atyp: socks5AtypIPv6, in: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x01, 0xbb}, want: "[2001:db8::1]:443"},
+		{name: "domain", atyp: socks5AtypDomain, in: append([]byte{11}, append([]byte("example.com"), 0, 80)...), want: "example.com:80"},
+		{name: "unknown type", atyp: 0x02, in: []byte{1, 2, 3, 4, 0, 80}, err: errSocksAtypNotSupported},
+		{name: "ipv4 truncated", atyp: socks5AtypIPv4, in: []byte{10, 0}, err: io.ErrUnexpectedEOF},
+		{name: "ipv6 truncated", atyp: socks5AtypIPv6, in: []byte{0x20, 0x01}, err: io.ErrUnexpectedEOF},
+		{name: "domain length missing", atyp: socks5AtypDomain, in: nil, err: io.EOF},
+		{name: "domain truncated", atyp: socks5AtypDomain, in: []byte{20, 'a', 'b'}, err: io.ErrUnexpectedEOF},
+		{name: "port missing", atyp: socks5AtypIPv4, in: []byte{10, 0, 0, 1}, err: io.EOF},
+		{name: "port truncated", atyp: socks5AtypIPv4, in: []byte{10, 0, 0, 1, 0}, err: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSocksAddr(bufio.NewReader(bytes.NewReader(tt.in)), tt.atyp)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("readSocksAddr() = %q, %v, want error %v", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("readSocksAddr() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSocksReply(t *testing.T) {
+	tests := []struct {
+		name string
+		rep  byte
+		bind net.Addr
+		want []byte
+	}{
+		{"no bind", socks5RepHostUnreachable, nil, []byte{5, socks5RepHostUnreachable, 0, socks5AtypIPv4, 0, 0, 0, 0, 0, 0}},
+		{"ipv4 bind", socks5RepSucceeded, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1080}, []byte{5, 0, 0, socks5AtypIPv4, 127, 0, 0, 1, 0x04, 0x38}},
+		{"ipv6 bind", socks5RepSucceeded, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 1080},
+			[]byte{5, 0, 0, socks5AtypIPv6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x04, 0x38}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeSocksReply(&buf, tt.rep, tt.bind); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("writeSocksReply() = %x, want %x", buf.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSocksNegotiate(t *testing.T) {
+	auth := func(user, pass string) []byte {
+		b := []byte{socks5PasswordVersion, byte(len(user))}
+		b = append(b, user...)
+		b = append(b, byte(len(pass)))
+		return append(b, pass...)
+	}
+	tests := []struct {
+		name      string
+		user      string
+		pass      string
+		lan       LANConfig
+		in        []byte
+		wantReply []byte
+		wantErr   bool
+	}{
+		{name: "no auth", in: []byte{5, 1, socks5AuthNone}, wantReply: []byte{5, socks5AuthNone}},
+		{name: "no auth among methods", in: []byte{5, 2, socks5AuthPassword, socks5AuthNone}, wantReply: []byte{5, socks5AuthNone}},
+		{name: "password accepted", user: "u", pass: "p", in: append([]byte{5, 2, socks5AuthNone, socks5AuthPassword}, auth("u", "p")...),
+			wantReply: []byte{5, socks5AuthPassword, socks5PasswordVersion, 0}},
+		{name: "password rejected", user: "u", pass: "p", in: append([]byte{5, 1, socks5AuthPassword}, auth("u", "wrong")...),
+			wantReply: []byte{5, socks5AuthPassword, socks5PasswordVersion, 1}, wantErr: true},
+		{name: "password required but not offered", user: "u", pass: "p", in: []byte{5, 1, socks5AuthNone},
+			wantReply: []byte{5, socks5AuthNoAcceptable}, wantErr: true},
+		{name: "lan credentials", lan: LANConfig{Enabled: true, Username: "l", Password: "q"},
+			in:        append([]byte{5, 1, socks5AuthPassword}, auth("l", "q")...),
+			wantReply: []byte{5, socks5AuthPassword, socks5PasswordVersion, 0}},
+		{name: "socks credentials override lan", user: "u", pass: "p", lan: LANConfig{Enabled: true, Username: "l", Password: "q"},
+			in:        append([]byte{5, 1, socks5AuthPassword}, auth("l", "q")...),
+			wantReply: []byte{5, socks5AuthPassword, socks5PasswordVersion, 1}, wantErr: true},
+		{name: "wrong version", in: []byte{4, 1, socks5AuthNone}, wantErr: true},
+		{name: "methods truncated", in: []byte{5, 3, socks5AuthNone}, wantErr: true},
+		{name: "auth version invalid", user: "u", pass: "p", in: []byte{5, 1, socks5AuthPassword, 9, 1, 'u', 1, 'p'},
+			wantReply: []byte{5, socks5AuthPassword}, wantErr: true},
+		{name: "auth truncated", user: "u", pass: "p", in: []byte{5, 1, socks5AuthPassword, socks5PasswordVersion, 5, 'u'},
+			wantReply: []byte{5, socks5AuthPassword}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{socksUser: tt.user, socksPass: tt.pass, lan: tt.lan}
+			client, server := net.Pipe()
+			defer client.Close()
+
+			replies := make(chan []byte, 1)
+			go func() {
+				b, _ := io.ReadAll(client)
+				replies <- b
+			}()
+			err := a.socksNegotiate(bufio.NewReader(bytes.NewReader(tt.in)), server)
+			server.Close()
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("socksNegotiate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := <-replies; !bytes.Equal(got, tt.wantReply) {
+				t.Errorf("replies = %x, want %x", got, tt.wantReply)
+			}
+		})
+	}
+}
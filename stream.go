@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---------------- 回應串流轉發 ----------------
+
+const (
+	// 等待上游回應標頭的上限
+	upstreamHeaderTimeout = 30 * time.Second
+	// 回應本體連續沒有資料的上限 (長輪詢、SSE 心跳間隔需小於此值)
+	upstreamIdleTimeout = 2 * time.Minute
+)
+
+// 判斷回應是否需要即時送出 (SSE、串流 API、長度未知的 chunked 回應)
+func isStreamingResponse(resp *http.Response) bool {
+	if resp.ContentLength == -1 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/event-stream", "application/x-ndjson", "application/stream+json", "multipart/x-mixed-replace":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "application/grpc")
+}
+
+// 將上游回應本體轉給客戶端
+// 串流回應每次寫入後立即 flush；超過 idle 沒有資料時呼叫 cancel 中止上游請求
+func copyResponse(w http.ResponseWriter, resp *http.Response, idle time.Duration, cancel func()) error {
+	var flusher http.Flusher
+	if isStreamingResponse(resp) {
+		flusher, _ = w.(http.Flusher)
+	}
+	// 先送出標頭，讓客戶端在第一筆資料前就能確認連線
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	timer := time.AfterFunc(idle, cancel)
+	defer timer.Stop()
+	// 限速等待不算閒置，每段等待後重設計時
+	if sr, ok := resp.Body.(*shapedReadCloser); ok {
+		sr.slept = func() { timer.Reset(idle) }
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			timer.Reset(idle)
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				// 客戶端已斷線
+				cancel()
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsStreamingResponse(t *testing.T) {
+	tests := []struct {
+		contentType string
+		length      int64
+		want        bool
+	}{
+		{"text/html", 100, false},
+		{"text/html", -1, true},
+		{"text/event-stream", 100, true},
+		{"text/event-stream; charset=utf-8", 100, true},
+		{"application/x-ndjson", 0, true},
+		{"application/stream+json", 10, true},
+		{"multipart/x-mixed-replace; boundary=frame", 10, true},
+		{"application/grpc+proto", 10, true},
+		{"application/json", 10, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}, ContentLength: tt.length}
+		resp.Header.Set("Content-Type", tt.contentType)
+		if got := isStreamingResponse(resp); got != tt.want {
+			t.Errorf("isStreamingResponse(%q, %d) = %v, want %v", tt.contentType, tt.length, got, tt.want)
+		}
+	}
+}
+
+// 記錄每次 flush 時已寫入的內容
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushed = append(r.flushed, r.Body.String())
+	r.ResponseRecorder.Flush()
+}
+
+func TestCopyResponseFlushesStreams(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		wantFlushes int
+	}{
+		{name: "event stream", contentType: "text/event-stream", wantFlushes: 3}, // 標頭 + 兩筆資料
+		{name: "regular body", contentType: "text/plain", wantFlushes: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw := io.Pipe()
+			resp := &http.Response{Header: http.Header{"Content-Type": {tt.contentType}}, ContentLength: 100, Body: pr}
+			go func() {
+				pw.Write([]byte("data: 1\n\n"))
+				pw.Write([]byte("data: 2\n\n"))
+				pw.Close()
+			}()
+
+			rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+			if err := copyResponse(rec, resp, time.Second, func() {}); err != nil {
+				t.Fatal(err)
+			}
+			if got := rec.Body.String(); got != "data: 1\n\ndata: 2\n\n" {
+				t.Errorf("body = %q", got)
+			}
+			if len(rec.flushed) != tt.wantFlushes {
+				t.Errorf("flushes = %q, want %d", rec.flushed, tt.wantFlushes)
+			}
+			if tt.wantFlushes > 1 && rec.flushed[1] != "data: 1\n\n" {
+				t.Errorf("first event not flushed on its own: %q", rec.flushed)
+			}
+		})
+	}
+}
+
+func TestCopyResponseIdleTimeout(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	resp := &http.Response{Header: http.Header{}, ContentLength: -1, Body: pr}
+
+	errIdle := errors.New("idle")
+	canceled := make(chan struct{})
+	cancel := func() {
+		close(canceled)
+		pw.CloseWithError(errIdle)
+	}
+
+	go pw.Write([]byte("first"))
+	start := time.Now()
+	err := copyResponse(httptest.NewRecorder(), resp, 100*time.Millisecond, cancel)
+	if !errors.Is(err, errIdle) {
+		t.Fatalf("copyResponse() error = %v, want idle cancel", err)
+	}
+	select {
+	case <-canceled:
+	default:
+		t.Fatal("cancel not called")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("idle timeout took %v", elapsed)
+	}
+}
+
+// 客戶端寫入失敗時應中止上游請求
+type failingWriter struct{ http.ResponseWriter }
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("client gone") }
+
+func TestCopyResponseClientGone(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}, ContentLength: 5, Body: io.NopCloser(strings.NewReader("hello"))}
+	canceled := false
+	err := copyResponse(failingWriter{httptest.NewRecorder()}, resp, time.Second, func() { canceled = true })
+	if err == nil || !canceled {
+		t.Errorf("copyResponse() = %v, canceled = %v, want error and cancel", err, canceled)
+	}
+}
+
+// 限速等待超過閒置時間時，每段等待後應重設計時而不中止回應
+func TestCopyResponseShapedWait(t *testing.T) {
+	var l bandwidthLimiter
+	l.cfg = BandwidthConfig{PerHost: BandwidthLimit{Down: 16384}}
+	s := l.shaper("10.0.0.1", "example.com")
+	// 已有半個 burst 的負債: 先等 0.5 秒償還，再扣除後等 1 秒
+	s.pairs[2].b[dirDown].tokens = -8192
+
+	resp := &http.Response{Header: http.Header{}, ContentLength: 16384, Body: &shapedReadCloser{
+		ReadCloser: io.NopCloser(strings.NewReader(strings.Repeat("x", 16384))),
+		s:          s,
+		dir:        dirDown,
+	}}
+	var canceled atomic.Bool
+	rec := httptest.NewRecorder()
+	if err := copyResponse(rec, resp, 1200*time.Millisecond, func() { canceled.Store(true) }); err != nil {
+		t.Fatal(err)
+	}
+	if canceled.Load() {
+		t.Error("idle timer fired during a bandwidth wait")
+	}
+	if rec.Body.Len() != 16384 {
+		t.Errorf("copied %d bytes, want 16384", rec.Body.Len())
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ---------------- 目標網站 TLS 驗證策略 ----------------
+
+// 驗證模式
+const (
+	tlsModeSystem   = "system"    // 使用系統根憑證
+	tlsModeCustomCA = "custom_ca" // 只信任指定的 CA bundle
+	tlsModePinned   = "pinned"    // 系統根憑證 (或 CA bundle) 驗證後，指定主機需符合 SPKI 雜湊
+	tlsModeInsecure = "insecure"  // 不驗證 (不建議，代理可任意竄改 HTTPS)
+)
+
+// TLSPolicy 本程式發出的 HTTPS 請求 (節點檢測與中轉請求) 如何驗證目標憑證
+type TLSPolicy struct {
+	Mode   string              `json:"mode"`
+	CAFile string              `json:"caFile"` // PEM 格式的 CA bundle
+	Pins   map[string][]string `json:"pins"`   // 主機名稱 -> SPKI SHA-256 (base64，可加 sha256/ 前綴)，不適用於 IP 位址
+}
+
+// tlsVerifyError 目標憑證不符合 pin
+type tlsVerifyError struct {
+	Host string
+	Err  error
+}
+
+func (e *tlsVerifyError) Error() string {
+	return fmt.Sprintf("TLS verification failed for %s: %v", e.Host, e.Err)
+}
+
+func (e *tlsVerifyError) Unwrap() error {
+	return e.Err
+}
+
+type tlsVerifier struct {
+	mu     sync.RWMutex
+	policy TLSPolicy
+	roots  *x509.CertPool      // nil 表示系統根憑證
+	pins   map[string][][]byte // 已解碼的 SPKI 雜湊
+}
+
+// 解析並檢查策略，回傳 CA pool 與解碼後的 pins
+func compileTLSPolicy(policy TLSPolicy) (*x509.CertPool, map[string][][]byte, error) {
+	var roots *x509.CertPool
+	switch policy.Mode {
+	case tlsModeSystem, tlsModeInsecure:
+	case tlsModeCustomCA, tlsModePinned:
+		if policy.CAFile == "" {
+			if policy.Mode == tlsModeCustomCA {
+				return nil, nil, errors.New("CA file required")
+			}
+			break
+		}
+		data, err := os.ReadFile(policy.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("no valid certificates in %s", policy.CAFile)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown mode %q", policy.Mode)
+	}
+
+	pins := make(map[string][][]byte)
+	if policy.Mode == tlsModePinned {
+		for host, list := range policy.Pins {
+			host = strings.ToLower(strings.TrimSpace(host))
+			for _, pin := range list {
+				sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), "sha256/"))
+				if err != nil || len(sum) != sha256.Size {
+					return nil, nil, fmt.Errorf("invalid pin for %s: %q", host, pin)
+				}
+				pins[host] = append(pins[host], sum)
+			}
+		}
+	}
+	return roots, pins, nil
+}
+
+// 檢查已驗證的憑證鏈是否符合主機的 pin (鏈上任一憑證的公鑰符合即可)
+func checkPins(cs tls.ConnectionState, pins map[string][][]byte) error {
+	expected := pins[strings.ToLower(cs.ServerName)]
+	if len(expected) == 0 {
+		return nil
+	}
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range expected {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+		}
+	}
+	return &tlsVerifyError{Host: cs.ServerName, Err: errors.New("certificate does not match pinned keys")}
+}
+
+// 依目前策略建立連往目標網站的 TLS 設定
+// 策略變更後需重建 Transport 才會套用 (SetTLSPolicy 會清空連線池)
+func (a *App) upstreamTLSConfig() *tls.Config {
+	v := &a.tlsVerify
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.policy.Mode == tlsModeInsecure {
+		return &tls.Config{InsecureSkipVerify: true}
+	}
+	cfg := &tls.Config{RootCAs: v.roots}
+	if pins := v.pins; len(pins) > 0 {
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return checkPins(cs, pins)
+		}
+	}
+	return cfg
+}
+
+// 錯誤是否為目標憑證驗證失敗 (而非連線失敗)
+func isTLSVerifyError(err error) bool {
+	var (
+		pinErr       *tlsVerifyError
+		verifyErr    *tls.CertificateVerificationError
+		hostErr      x509.HostnameError
+		authorityErr x509.UnknownAuthorityError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.As(err, &pinErr) || errors.As(err, &verifyErr) || errors.As(err, &hostErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &invalidErr)
+}
+
+// 21. 設定 TLS 驗證策略
+func (a *App) SetTLSPolicy(policy TLSPolicy) string {
+	if policy.Mode == "" {
+		policy.Mode = tlsModeSystem
+	}
+	roots, pins, err := compileTLSPolicy(policy)
+	if err != nil {
+		return fmt.Sprintf("invalid_policy: %v", err)
+	}
+
+	a.tlsVerify.mu.Lock()
+	a.tlsVerify.policy = policy
+	a.tlsVerify.roots = roots
+	a.tlsVerify.pins = pins
+	a.tlsVerify.mu.Unlock()
+
+	// 關閉既有連線，避免沿用以舊策略驗證過的連線
+	a.transports.closeAll()
+	a.dns.reset()
+	return "Success"
+}
+
+// 21-1. 取得目前的 TLS 驗證策略
+func (a *App) GetTLSPolicy() TLSPolicy {
+	a.tlsVerify.mu.RLock()
+	defer a.tlsVerify.mu.RUnlock()
+	policy := a.tlsVerify.policy
+	if policy.Mode == "" {
+		policy.Mode = tlsModeSystem
+	}
+	return policy
+}
+
+// 憑證公鑰的 SPKI 雜湊，格式與 pins 相同
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// 21-2. 讀取 PEM 憑證檔並回傳第一張憑證的 SPKI pin (供設定 pins 使用)
+func (a *App) GetCertificatePin(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return ""
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			return spkiPin(cert)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileTLSPolicy(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	caFile := writeServerCA(t, srv)
+	badPEM := filepath.Join(t.TempDir(), "bad.pem")
+	os.WriteFile(badPEM, []byte("junk"), 0o600)
+
+	pin := spkiPin(srv.Certificate())
+	tests := []struct {
+		name      string
+		policy    TLSPolicy
+		wantRoots bool
+		wantPins  map[string]int
+		wantErr   string
+	}{
+		{name: "system", policy: TLSPolicy{Mode: tlsModeSystem}},
+		{name: "insecure", policy: TLSPolicy{Mode: tlsModeInsecure}},
+		{name: "custom ca", policy: TLSPolicy{Mode: tlsModeCustomCA, CAFile: caFile}, wantRoots: true},
+		{name: "custom ca missing file", policy: TLSPolicy{Mode: tlsModeCustomCA}, wantErr: "CA file required"},
+		{name: "custom ca unreadable", policy: TLSPolicy{Mode: tlsModeCustomCA, CAFile: filepath.Join(t.TempDir(), "none.pem")}, wantErr: "no such file"},
+		{name: "custom ca bad pem", policy: TLSPolicy{Mode: tlsModeCustomCA, CAFile: badPEM}, wantErr: "no valid certificates"},
+		{name: "pinned", policy: TLSPolicy{Mode: tlsModePinned, Pins: map[string][]string{" Example.COM ": {pin, strings.TrimPrefix(pin, "sha256/")}}},
+			wantPins: map[string]int{"example.com": 2}},
+		{name: "pinned with ca", policy: TLSPolicy{Mode: tlsModePinned, CAFile: caFile, Pins: map[string][]string{"example.com": {pin}}},
+			wantRoots: true, wantPins: map[string]int{"example.com": 1}},
+		{name: "pins ignored outside pinned mode", policy: TLSPolicy{Mode: tlsModeSystem, Pins: map[string][]string{"example.com": {"bad"}}}},
+		{name: "pin not base64", policy: TLSPolicy{Mode: tlsModePinned, Pins: map[string][]string{"example.com": {"!!"}}}, wantErr: "invalid pin"},
+		{name: "pin wrong length", policy: TLSPolicy{Mode: tlsModePinned, Pins: map[string][]string{"example.com": {"sha256/AAAA"}}}, wantErr: "invalid pin"},
+		{name: "unknown mode", policy: TLSPolicy{Mode: "strict"}, wantErr: "unknown mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots, pins, err := compileTLSPolicy(tt.policy)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("compileTLSPolicy() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("compileTLSPolicy() error: %v", err)
+			}
+			if (roots != nil) != tt.wantRoots {
+				t.Errorf("roots = %v, want set = %v", roots, tt.wantRoots)
+			}
+			if len(pins) != len(tt.wantPins) {
+				t.Errorf("pins = %v, want %v", pins, tt.wantPins)
+			}
+			for host, n := range tt.wantPins {
+				if len(pins[host]) != n {
+					t.Errorf("pins[%q] = %d entries, want %d", host, len(pins[host]), n)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPins(t *testing.T) {
+	cert := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("leaf key")}
+	root := &x509.Certificate{RawSubjectPublicKeyInfo: []byte("root key")}
+	sum := func(c *x509.Certificate) []byte {
+		s := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		return s[:]
+	}
+	chain := [][]*x509.Certificate{{cert, root}}
+	tests := []struct {
+		name   string
+		server string
+		pins   map[string][][]byte
+		ok     bool
+	}{
+		{name: "no pins", server: "example.com", pins: nil, ok: true},
+		{name: "other host", server: "other.com", pins: map[string][][]byte{"example.com": {[]byte("x")}}, ok: true},
+		{name: "leaf match", server: "example.com", pins: map[string][][]byte{"example.com": {sum(cert)}}, ok: true},
+		{name: "root match", server: "Example.com", pins: map[string][][]byte{"example.com": {[]byte("x"), sum(root)}}, ok: true},
+		{name: "mismatch", server: "example.com", pins: map[string][][]byte{"example.com": {make([]byte, 32)}}, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPins(tls.ConnectionState{ServerName: tt.server, VerifiedChains: chain}, tt.pins)
+			if (err == nil) != tt.ok {
+				t.Fatalf("checkPins() = %v, want ok = %v", err, tt.ok)
+			}
+			if err != nil && !isTLSVerifyError(err) {
+				t.Errorf("checkPins() error %v is not a TLS verification error", err)
+			}
+		})
+	}
+}
+
+// 以目前策略連線到測試伺服器 (憑證涵蓋 example.com)
+func TestUpstreamTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	caFile := writeServerCA(t, srv)
+	pin := spkiPin(srv.Certificate())
+	otherPin := "sha256/" + base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name       string
+		policy     TLSPolicy
+		wantVerify bool // 預期憑證驗證失敗
+	}{
+		{name: "system rejects test ca", policy: TLSPolicy{Mode: tlsModeSystem}, wantVerify: true},
+		{name: "insecure", policy: TLSPolicy{Mode: tlsModeInsecure}},
+		{name: "custom ca", policy: TLSPolicy{Mode: tlsModeCustomCA, CAFile: caFile}},
+		{name: "pin match", policy: TLSPolicy{Mode: tlsModePinned, CAFile: caFile, Pins: map[string][]string{"example.com": {pin}}}},
+		{name: "pin mismatch", policy: TLSPolicy{Mode: tlsModePinned, CAFile: caFile, Pins: map[string][]string{"example.com": {otherPin}}}, wantVerify: true},
+		{name: "pin other host", policy: TLSPolicy{Mode: tlsModePinned, CAFile: caFile, Pins: map[string][]string{"other.com": {otherPin}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{}
+			if got := a.SetTLSPolicy(tt.policy); got != "Success" {
+				t.Fatalf("SetTLSPolicy() = %q", got)
+			}
+			transport := &http.Transport{
+				TLSClientConfig: a.upstreamTLSConfig(),
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+				},
+			}
+			defer transport.CloseIdleConnections()
+
+			resp, err := (&http.Client{Transport: transport}).Get("https://example.com/")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tt.wantVerify {
+				if !isTLSVerifyError(err) {
+					t.Fatalf("request error = %v, want TLS verification error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsTLSVerifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("connection refused"), false},
+		{&tlsVerifyError{Host: "a", Err: errors.New("x")}, true},
+		{fmt.Errorf("Get: %w", x509.UnknownAuthorityError{}), true},
+		{x509.HostnameError{Host: "a", Certificate: &x509.Certificate{}}, true},
+		{x509.CertificateInvalidError{Reason: x509.Expired}, true},
+		{&tls.CertificateVerificationError{Err: errors.New("x")}, true},
+	}
+	for _, tt := range tests {
+		if got := isTLSVerifyError(tt.err); got != tt.want {
+			t.Errorf("isTLSVerifyError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestTLSPolicyAccessors(t *testing.T) {
+	a := &App{}
+	if got := a.GetTLSPolicy().Mode; got != tlsModeSystem {
+		t.Errorf("default mode = %q, want system", got)
+	}
+	if got := a.SetTLSPolicy(TLSPolicy{Mode: "strict"}); !strings.HasPrefix(got, "invalid_policy") {
+		t.Errorf("SetTLSPolicy(strict) = %q", got)
+	}
+	a.SetTLSPolicy(TLSPolicy{})
+	if got := a.GetTLSPolicy().Mode; got != tlsModeSystem {
+		t.Errorf("empty mode stored as %q", got)
+	}
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	if got, want := a.GetCertificatePin(writeServerCA(t, srv)), spkiPin(srv.Certificate()); got != want {
+		t.Errorf("GetCertificatePin() = %q, want %q", got, want)
+	}
+	if got := a.GetCertificatePin(filepath.Join(t.TempDir(), "none.pem")); got != "" {
+		t.Errorf("GetCertificatePin(missing) = %q", got)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- 流量統計 ----------------
+
+const (
+	trafficReportInterval = time.Second
+	defaultTrafficTopN    = 10
+	trafficMaxHosts       = 1024    // 超過時將流量最少的主機併入 other
+	trafficOtherHost      = "other" // 併入後的彙總項目名稱
+)
+
+// TrafficEntry 單一目標主機或上游節點的累計流量
+type TrafficEntry struct {
+	Name        string `json:"name"`
+	Up          int64  `json:"up"`   // 上傳位元組 (客戶端 -> 目標)
+	Down        int64  `json:"down"` // 下載位元組 (目標 -> 客戶端)
+	Connections int64  `json:"connections"`
+	Active      int64  `json:"active"`
+	DurationMs  int64  `json:"durationMs"` // 已結束連線的累計時間
+}
+
+// TrafficSnapshot 本次工作階段的流量統計
+type TrafficSnapshot struct {
+	StartedAt   int64          `json:"startedAt"` // Unix 毫秒
+	Up          int64          `json:"up"`
+	Down        int64          `json:"down"`
+	UpRate      int64          `json:"upRate"`   // 位元組/秒
+	DownRate    int64          `json:"downRate"` // 位元組/秒
+	Connections int64          `json:"connections"`
+	Active      int64          `json:"active"`
+	TopHosts    []TrafficEntry `json:"topHosts"`
+	Upstreams   []TrafficEntry `json:"upstreams"`
+	Bandwidth   BandwidthStats `json:"bandwidth"`
+}
+
+// 可同時更新的計數器
+type trafficCounter struct {
+	up       atomic.Int64
+	down     atomic.Int64
+	conns    atomic.Int64
+	active   atomic.Int64
+	duration atomic.Int64 // 毫秒
+}
+
+func (c *trafficCounter) entry(name string) TrafficEntry {
+	return TrafficEntry{
+		Name:        name,
+		Up:          c.up.Load(),
+		Down:        c.down.Load(),
+		Connections: c.conns.Load(),
+		Active:      c.active.Load(),
+		DurationMs:  c.duration.Load(),
+	}
+}
+
+type trafficStats struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	total     *trafficCounter
+	hosts     map[string]*trafficCounter
+	upstreams map[string]*trafficCounter
+
+	// 由回報週期計算的即時速率
+	lastUp, lastDown int64
+	lastSample       time.Time
+	upRate, downRate int64
+	reporting        bool
+	stopReport       chan struct{}
+}
+
+// trafficFlow 單一 CONNECT 通道或 HTTP 請求的流量，同時累加到主機與上游統計
+type trafficFlow struct {
+	counters []*trafficCounter
+	start    time.Time
+	up       atomic.Int64
+	down     atomic.Int64
+	ended    sync.Once
+	shaper   *shaper // 頻寬限制
+}
+
+func (f *trafficFlow) addUp(n int) {
+	if f == nil || n <= 0 {
+		return
+	}
+	f.up.Add(int64(n))
+	for _, c := range f.counters {
+		c.up.Add(int64(n))
+	}
+}
+
+func (f *trafficFlow) addDown(n int) {
+	if f == nil || n <= 0 {
+		return
+	}
+	f.down.Add(int64(n))
+	for _, c := range f.counters {
+		c.down.Add(int64(n))
+	}
+}
+
+// 連線的頻寬限制 (flow 為 nil 時不限制)
+func (f *trafficFlow) limiter() *shaper {
+	if f == nil {
+		return nil
+	}
+	return f.shaper
+}
+
+// 結束連線並記錄持續時間 (可重複呼叫)
+func (f *trafficFlow) end() {
+	if f == nil {
+		return
+	}
+	f.ended.Do(func() {
+		ms := time.Since(f.start).Milliseconds()
+		for _, c := range f.counters {
+			c.active.Add(-1)
+			c.duration.Add(ms)
+		}
+	})
+}
+
+func (t *trafficStats) resetLocked() {
+	t.startedAt = time.Now()
+	t.total = &trafficCounter{}
+	t.hosts = make(map[string]*trafficCounter)
+	t.upstreams = make(map[string]*trafficCounter)
+	t.lastUp, t.lastDown = 0, 0
+	t.lastSample = t.startedAt
+	t.upRate, t.downRate = 0, 0
+}
+
+// 開始記錄一條連線
+func (t *trafficStats) begin(host, upstream string) *trafficFlow {
+	t.mu.Lock()
+	if t.total == nil {
+		t.resetLocked()
+	}
+	h := t.hosts[host]
+	if h == nil && len(t.hosts) >= trafficMaxHosts {
+		t.foldHostsLocked()
+		// 所有主機都仍有連線而無法併入時，新主機直接記在 other
+		if len(t.hosts) >= trafficMaxHosts {
+			host = trafficOtherHost
+			h = t.hosts[host]
+		}
+	}
+	if h == nil {
+		h = &trafficCounter{}
+		t.hosts[host] = h
+	}
+	u := t.upstreams[upstream]
+	if u == nil {
+		u = &trafficCounter{}
+		t.upstreams[upstream] = u
+	}
+	f := &trafficFlow{counters: []*trafficCounter{t.total, h, u}, start: time.Now()}
+	t.mu.Unlock()
+
+	for _, c := range f.counters {
+		c.conns.Add(1)
+		c.active.Add(1)
+	}
+	return f
+}
+
+// 將流量最少且已無連線的主機併入 other，直到剩下一半上限
+// 仍有連線的主機保留，避免進行中的 flow 累加到已移除的計數器 (呼叫者需持有 t.mu)
+func (t *trafficStats) foldHostsLocked() {
+	type idleHost struct {
+		name   string
+		c      *trafficCounter
+		volume int64
+	}
+	var idle []idleHost
+	for name, c := range t.hosts {
+		if name != trafficOtherHost && c.active.Load() == 0 {
+			idle = append(idle, idleHost{name, c, c.up.Load() + c.down.Load()})
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].volume < idle[j].volume })
+	if n := len(t.hosts) - trafficMaxHosts/2; n < len(idle) {
+		idle = idle[:n]
+	}
+	if len(idle) == 0 {
+		return
+	}
+
+	other := t.hosts[trafficOtherHost]
+	if other == nil {
+		other = &trafficCounter{}
+		t.hosts[trafficOtherHost] = other
+	}
+	for _, h := range idle {
+		other.up.Add(h.c.up.Load())
+		other.down.Add(h.c.down.Load())
+		other.conns.Add(h.c.conns.Load())
+		other.duration.Add(h.c.duration.Load())
+		delete(t.hosts, h.name)
+	}
+}
+
+// 依週期更新即時速率
+func (t *trafficStats) sample() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.total == nil {
+		t.resetLocked()
+	}
+	now := time.Now()
+	elapsed := now.Sub(t.lastSample).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	up, down := t.total.up.Load(), t.total.down.Load()
+	t.upRate = int64(float64(up-t.lastUp) / elapsed)
+	t.downRate = int64(float64(down-t.lastDown) / elapsed)
+	t.lastUp, t.lastDown, t.lastSample = up, down, now
+}
+
+func (t *trafficStats) snapshot(topN int) TrafficSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.total == nil {
+		t.resetLocked()
+	}
+
+	snap := TrafficSnapshot{
+		StartedAt:   t.startedAt.UnixMilli(),
+		Up:          t.total.up.Load(),
+		Down:        t.total.down.Load(),
+		UpRate:      t.upRate,
+		DownRate:    t.downRate,
+		Connections: t.total.conns.Load(),
+		Active:      t.total.active.Load(),
+		TopHosts:    make([]TrafficEntry, 0, len(t.hosts)),
+		Upstreams:   make([]TrafficEntry, 0, len(t.upstreams)),
+	}
+	for name, c := range t.hosts {
+		snap.TopHosts = append(snap.TopHosts, c.entry(name))
+	}
+	for name, c := range t.upstreams {
+		snap.Upstreams = append(snap.Upstreams, c.entry(name))
+	}
+
+	byVolume := func(list []TrafficEntry) func(i, j int) bool {
+		return func(i, j int) bool {
+			return list[i].Up+list[i].Down > list[j].Up+list[j].Down
+		}
+	}
+	sort.Slice(snap.TopHosts, byVolume(snap.TopHosts))
+	sort.Slice(snap.Upstreams, byVolume(snap.Upstreams))
+	if topN > 0 && len(snap.TopHosts) > topN {
+		snap.TopHosts = snap.TopHosts[:topN]
+	}
+	return snap
+}
+
+// countingReadCloser 讀取時累加流量
+type countingReadCloser struct {
+	io.ReadCloser
+	add func(int)
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.add(n)
+	return n, err
+}
+
+// 開始記錄一條經過中轉的連線 (target 為 host:port 或主機名)，並套用頻寬限制
+func (a *App) beginTraffic(client, target string, p *Proxy) *trafficFlow {
+	host, _ := splitTarget(target, 0)
+	a.startTrafficReporter()
+	flow := a.traffic.begin(host, transportLabel(p))
+	flow.shaper = a.bandwidth.shaper(client, host)
+	return flow
+}
+
+// 流量統計附上頻寬限制狀態
+func (a *App) trafficSnapshot(topN int) TrafficSnapshot {
+	snap := a.traffic.snapshot(topN)
+	snap.Bandwidth = a.bandwidth.stats()
+	return snap
+}
+
+// 啟動週期性的 traffic_stats 事件 (只啟動一次，直到 stopTrafficReporter)
+func (a *App) startTrafficReporter() {
+	a.traffic.mu.Lock()
+	if a.traffic.reporting {
+		a.traffic.mu.Unlock()
+		return
+	}
+	a.traffic.reporting = true
+	stop := make(chan struct{})
+	a.traffic.stopReport = stop
+	a.traffic.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(trafficReportInterval)
+		defer ticker.Stop()
+		var last TrafficSnapshot
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			a.traffic.sample()
+			snap := a.trafficSnapshot(defaultTrafficTopN)
+			// 沒有任何變化 (閒置) 時不重複發送
+			if !trafficChanged(last, snap) {
+				continue
+			}
+			last = snap
+			if a.ctx != nil {
+				wailsRuntime.EventsEmit(a.ctx, "traffic_stats", snap)
+			}
+		}
+	}()
+}
+
+// 停止 traffic_stats 事件，之後有新連線時會再次啟動
+func (a *App) stopTrafficReporter() {
+	a.traffic.mu.Lock()
+	defer a.traffic.mu.Unlock()
+	if !a.traffic.reporting {
+		return
+	}
+	close(a.traffic.stopReport)
+	a.traffic.stopReport = nil
+	a.traffic.reporting = false
+}
+
+// 比較兩次回報的統計數字 (主機排行隨位元組數變動，不需另外比較)
+func trafficChanged(prev, next TrafficSnapshot) bool {
+	return prev.StartedAt != next.StartedAt ||
+		prev.Up != next.Up || prev.Down != next.Down ||
+		prev.UpRate != next.UpRate || prev.DownRate != next.DownRate ||
+		prev.Connections != next.Connections || prev.Active != next.Active ||
+		prev.Bandwidth != next.Bandwidth
+}
+
+// 17. 取得本次工作階段的流量統計 (topN <= 0 時預設 10 個主機)
+func (a *App) GetTrafficStats(topN int) TrafficSnapshot {
+	if topN <= 0 {
+		topN = defaultTrafficTopN
+	}
+	return a.trafficSnapshot(topN)
+}
+
+// 17-1. 重新開始統計
+func (a *App) ResetTrafficStats() {
+	a.traffic.mu.Lock()
+	defer a.traffic.mu.Unlock()
+	a.traffic.resetLocked()
+	a.bandwidth.resetStats()
+}
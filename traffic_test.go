@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrafficSnapshot(t *testing.T) {
+	type flow struct {
+		host, upstream string
+		up, down       int
+		ended          bool
+	}
+	tests := []struct {
+		name          string
+		flows         []flow
+		topN          int
+		wantHosts     []string
+		wantUpstreams []string
+		wantUp        int64
+		wantDown      int64
+		wantActive    int64
+		wantConns     int64
+	}{
+		{name: "empty", topN: 10},
+		{
+			name: "ordered by volume",
+			flows: []flow{
+				{host: "a.com", upstream: "DIRECT", up: 10, down: 10},
+				{host: "b.com", upstream: "http://10.0.0.1:8080", up: 100, down: 900, ended: true},
+				{host: "c.com", upstream: "http://10.0.0.1:8080", up: 50, down: 50},
+			},
+			topN:          10,
+			wantHosts:     []string{"b.com", "c.com", "a.com"},
+			wantUpstreams: []string{"http://10.0.0.1:8080", "DIRECT"},
+			wantUp:        160, wantDown: 960, wantActive: 2, wantConns: 3,
+		},
+		{
+			name: "same host aggregated",
+			flows: []flow{
+				{host: "a.com", upstream: "DIRECT", up: 10, down: 10, ended: true},
+				{host: "a.com", upstream: "DIRECT", up: 5, down: 5, ended: true},
+			},
+			topN:          10,
+			wantHosts:     []string{"a.com"},
+			wantUpstreams: []string{"DIRECT"},
+			wantUp:        15, wantDown: 15, wantActive: 0, wantConns: 2,
+		},
+		{
+			name: "top n",
+			flows: []flow{
+				{host: "a.com", upstream: "DIRECT", up: 1},
+				{host: "b.com", upstream: "DIRECT", up: 3},
+				{host: "c.com", upstream: "DIRECT", up: 2},
+			},
+			topN:          2,
+			wantHosts:     []string{"b.com", "c.com"},
+			wantUpstreams: []string{"DIRECT"},
+			wantUp:        6, wantActive: 3, wantConns: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ts trafficStats
+			for _, f := range tt.flows {
+				fl := ts.begin(f.host, f.upstream)
+				fl.addUp(f.up)
+				fl.addDown(f.down)
+				if f.ended {
+					fl.end()
+					fl.end() // 重複結束不重複扣除
+				}
+			}
+			snap := ts.snapshot(tt.topN)
+
+			var hosts, upstreams []string
+			for _, e := range snap.TopHosts {
+				hosts = append(hosts, e.Name)
+			}
+			for _, e := range snap.Upstreams {
+				upstreams = append(upstreams, e.Name)
+			}
+			if !reflect.DeepEqual(hosts, tt.wantHosts) {
+				t.Errorf("TopHosts = %v, want %v", hosts, tt.wantHosts)
+			}
+			if !reflect.DeepEqual(upstreams, tt.wantUpstreams) {
+				t.Errorf("Upstreams = %v, want %v", upstreams, tt.wantUpstreams)
+			}
+			if snap.Up != tt.wantUp || snap.Down != tt.wantDown || snap.Active != tt.wantActive || snap.Connections != tt.wantConns {
+				t.Errorf("totals = up %d down %d active %d conns %d, want %d %d %d %d",
+					snap.Up, snap.Down, snap.Active, snap.Connections, tt.wantUp, tt.wantDown, tt.wantActive, tt.wantConns)
+			}
+		})
+	}
+}
+
+func TestTrafficFlowNil(t *testing.T) {
+	var f *trafficFlow
+	f.addUp(10)
+	f.addDown(10)
+	f.end()
+}
+
+// 主機數達上限時，流量最少且已結束的主機併入 other，總量不變
+func TestTrafficHostsCapped(t *testing.T) {
+	var ts trafficStats
+	busy := ts.begin("busy.com", "DIRECT")
+	busy.addUp(1)
+	for i := 1; i < trafficMaxHosts; i++ {
+		f := ts.begin(fmt.Sprintf("h%d.com", i), "DIRECT")
+		f.addDown(i)
+		f.end()
+	}
+
+	ts.begin("new.com", "DIRECT").addUp(7)
+	snap := ts.snapshot(0)
+	if n := len(snap.TopHosts); n > trafficMaxHosts/2+2 {
+		t.Fatalf("%d hosts after folding, want at most %d", n, trafficMaxHosts/2+2)
+	}
+	var sumUp, sumDown, sumConns int64
+	names := make(map[string]TrafficEntry)
+	for _, e := range snap.TopHosts {
+		sumUp, sumDown, sumConns = sumUp+e.Up, sumDown+e.Down, sumConns+e.Connections
+		names[e.Name] = e
+	}
+	if sumUp != snap.Up || sumDown != snap.Down || sumConns != snap.Connections {
+		t.Errorf("host sums = %d/%d/%d, want totals %d/%d/%d", sumUp, sumDown, sumConns, snap.Up, snap.Down, snap.Connections)
+	}
+	// 仍有連線的主機不併入，最大的主機保留
+	for _, name := range []string{"busy.com", "new.com", trafficOtherHost, fmt.Sprintf("h%d.com", trafficMaxHosts-1)} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("host %s missing after folding", name)
+		}
+	}
+	if _, ok := names["h1.com"]; ok {
+		t.Error("smallest host h1.com not folded")
+	}
+
+	// 全部主機都有連線時，新主機記在 other
+	var full trafficStats
+	for i := 0; i < trafficMaxHosts; i++ {
+		full.begin(fmt.Sprintf("h%d.com", i), "DIRECT")
+	}
+	full.begin("late.com", "DIRECT").addUp(5)
+	snap = full.snapshot(0)
+	if len(snap.TopHosts) != trafficMaxHosts+1 || snap.TopHosts[0].Name != trafficOtherHost || snap.TopHosts[0].Up != 5 {
+		t.Errorf("hosts = %d, top = %+v, want late.com recorded as other", len(snap.TopHosts), snap.TopHosts[0])
+	}
+}
+
+func TestTrafficSample(t *testing.T) {
+	var ts trafficStats
+	f := ts.begin("a.com", "DIRECT")
+	ts.mu.Lock()
+	ts.lastSample = time.Now().Add(-2 * time.Second)
+	ts.mu.Unlock()
+
+	f.addUp(2000)
+	f.addDown(4000)
+	ts.sample()
+	snap := ts.snapshot(0)
+	// 約 2 秒內的平均速率
+	if snap.UpRate < 900 || snap.UpRate > 1000 || snap.DownRate < 1800 || snap.DownRate > 2000 {
+		t.Errorf("rates = %d/%d, want about 1000/2000", snap.UpRate, snap.DownRate)
+	}
+}
+
+func TestCountingReadCloser(t *testing.T) {
+	var total int
+	r := &countingReadCloser{ReadCloser: io.NopCloser(strings.NewReader("hello world")), add: func(n int) { total += n }}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if total != len("hello world") {
+		t.Errorf("counted %d bytes, want %d", total, len("hello world"))
+	}
+}
+
+func TestRelayConnsCountsTraffic(t *testing.T) {
+	client, relayClient := tcpPair(t)
+	relayUpstream, server := tcpPair(t)
+	go func() {
+		io.ReadAll(server)
+		server.Write([]byte("0123456789"))
+		server.Close()
+	}()
+
+	var ts trafficStats
+	flow := ts.begin("example.com", "DIRECT")
+	done := make(chan struct{})
+	go func() {
+		relayConns(relayClient, relayUpstream, tunnelLimits{}, flow)
+		flow.end()
+		close(done)
+	}()
+
+	client.Write([]byte("abc"))
+	client.CloseWrite()
+	io.ReadAll(client)
+	<-done
+
+	snap := ts.snapshot(0)
+	if snap.Up != 3 || snap.Down != 10 || snap.Active != 0 {
+		t.Errorf("snapshot = up %d down %d active %d, want 3/10/0", snap.Up, snap.Down, snap.Active)
+	}
+	if len(snap.TopHosts) != 1 || snap.TopHosts[0].Up != 3 || snap.TopHosts[0].Down != 10 {
+		t.Errorf("TopHosts = %+v", snap.TopHosts)
+	}
+}
+
+func TestResetTrafficStats(t *testing.T) {
+	a := &App{}
+	a.traffic.begin("a.com", "DIRECT").addUp(100)
+	a.ResetTrafficStats()
+	if snap := a.GetTrafficStats(0); snap.Up != 0 || len(snap.TopHosts) != 0 {
+		t.Errorf("snapshot after reset = %+v", snap)
+	}
+}
+
+func TestTrafficChanged(t *testing.T) {
+	base := TrafficSnapshot{StartedAt: 1, Up: 10, Down: 20, Connections: 2, Active: 1}
+	tests := []struct {
+		name   string
+		modify func(*TrafficSnapshot)
+		want   bool
+	}{
+		{name: "identical", modify: func(*TrafficSnapshot) {}},
+		{name: "top hosts only", modify: func(s *TrafficSnapshot) { s.TopHosts = []TrafficEntry{{Name: "a.com"}} }},
+		{name: "reset", modify: func(s *TrafficSnapshot) { s.StartedAt = 2 }, want: true},
+		{name: "bytes up", modify: func(s *TrafficSnapshot) { s.Up++ }, want: true},
+		{name: "bytes down", modify: func(s *TrafficSnapshot) { s.Down++ }, want: true},
+		{name: "rate drops to zero", modify: func(s *TrafficSnapshot) { s.UpRate = 0; s.DownRate = 5 }, want: true},
+		{name: "new connection", modify: func(s *TrafficSnapshot) { s.Connections++ }, want: true},
+		{name: "connection ended", modify: func(s *TrafficSnapshot) { s.Active-- }, want: true},
+		{name: "bandwidth drops", modify: func(s *TrafficSnapshot) { s.Bandwidth.Drops++ }, want: true},
+		{name: "bandwidth limits", modify: func(s *TrafficSnapshot) { s.Bandwidth.Limits.Global.Up = 1 }, want: true},
+	}
+	for _, tt := range tests {
+		next := base
+		tt.modify(&next)
+		if got := trafficChanged(base, next); got != tt.want {
+			t.Errorf("%s: trafficChanged() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrafficReporterStop(t *testing.T) {
+	a := &App{}
+	a.stopTrafficReporter() // 未啟動時不做任何事
+	a.beginTraffic("127.0.0.1", "example.com:443", nil).end()
+	a.traffic.mu.Lock()
+	stop := a.traffic.stopReport
+	running := a.traffic.reporting
+	a.traffic.mu.Unlock()
+	if !running || stop == nil {
+		t.Fatal("reporter not started by the first flow")
+	}
+
+	a.stopTrafficReporter()
+	select {
+	case <-stop:
+	default:
+		t.Fatal("stop channel not closed")
+	}
+	a.stopTrafficReporter()
+
+	// 之後有新連線時重新啟動
+	a.beginTraffic("127.0.0.1", "example.com:443", nil).end()
+	a.traffic.mu.Lock()
+	restarted := a.traffic.reporting && a.traffic.stopReport != nil && a.traffic.stopReport != stop
+	a.traffic.mu.Unlock()
+	if !restarted {
+		t.Error("reporter not restarted")
+	}
+	a.stopTrafficReporter()
+}
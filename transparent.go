@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- Linux 透明代理 (REDIRECT) ----------------
+
+// 產生規則的後端
+const (
+	transparentNFTables = "nftables"
+	transparentIPTables = "iptables"
+)
+
+const (
+	defaultTransparentPort  = "2082"
+	transparentSniffTimeout = 500 * time.Millisecond
+
+	transparentTable = "proxymaster" // nftables 表名
+	transparentChain = "PROXYMASTER" // iptables 自訂鏈
+)
+
+// 重導時一律直連的目的網段 (除了 pacBypassNets 之外)
+var (
+	transparentBypassV4 = []string{"169.254.0.0/16", "224.0.0.0/4", "255.255.255.255/32"}
+	transparentBypassV6 = []string{"::1/128", "fc00::/7", "fe80::/10", "ff00::/8"}
+)
+
+var errTransparentUnsupported = errors.New("transparent proxy is only supported on Linux")
+
+// TransparentConfig 透明代理設定
+// 重導範圍必須限定於使用者或 cgroup，且不可包含本程式自身 (否則轉發的連線會再被重導)
+type TransparentConfig struct {
+	Enabled bool     `json:"enabled"`
+	Port    string   `json:"port"`    // 接收重導連線的端口
+	Backend string   `json:"backend"` // nftables / iptables
+	User    string   `json:"user"`    // 只重導此使用者的連線 (名稱或 UID)
+	Cgroup  string   `json:"cgroup"`  // 只重導此 cgroup v2 路徑下的連線，例如 proxymaster.slice
+	IPv6    bool     `json:"ipv6"`    // 同時重導 IPv6 (另外監聽 ::1)
+	Bypass  []string `json:"bypass"`  // 額外直連的目的網段
+}
+
+// TransparentStatus 透明代理狀態
+type TransparentStatus struct {
+	Supported    bool              `json:"supported"`
+	Config       TransparentConfig `json:"config"`
+	Listening    bool              `json:"listening"`
+	RulesApplied bool              `json:"rulesApplied"`
+}
+
+// TransparentRules 依設定產生的防火牆規則 (shell 指令)
+type TransparentRules struct {
+	Backend string `json:"backend"`
+	Apply   string `json:"apply"`
+	Remove  string `json:"remove"`
+	Error   string `json:"error,omitempty"`
+}
+
+type transparentState struct {
+	mu       sync.Mutex
+	cfg      TransparentConfig
+	listener net.Listener
+	applied  []ruleCmd // 已套用規則的移除指令
+}
+
+// ruleCmd 單一規則指令，stdin 不為空時經由標準輸入傳入
+type ruleCmd struct {
+	args  []string
+	stdin string
+}
+
+func (c ruleCmd) run() error {
+	cmd := exec.Command(c.args[0], c.args[1:]...)
+	if c.stdin != "" {
+		cmd.Stdin = strings.NewReader(c.stdin)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", strings.Join(c.args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (c ruleCmd) String() string {
+	quoted := make([]string, len(c.args))
+	for i, arg := range c.args {
+		quoted[i] = shellQuote(arg)
+	}
+	line := strings.Join(quoted, " ")
+	if c.stdin != "" {
+		line += " <<'EOF'\n" + c.stdin + "EOF"
+	}
+	return line
+}
+
+func renderScript(cmds []ruleCmd) string {
+	var b strings.Builder
+	for _, c := range cmds {
+		b.WriteString(c.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// 檢查並補上預設值，回傳重導範圍使用的 UID (未限定使用者時為空字串)
+func normalizeTransparentConfig(cfg *TransparentConfig) (string, error) {
+	cfg.Port = strings.TrimSpace(cfg.Port)
+	if cfg.Port == "" {
+		cfg.Port = defaultTransparentPort
+	}
+	if p, err := strconv.Atoi(cfg.Port); err != nil || p <= 0 || p > 65535 {
+		return "", fmt.Errorf("invalid port %q", cfg.Port)
+	}
+
+	switch cfg.Backend {
+	case "":
+		cfg.Backend = transparentNFTables
+	case transparentNFTables, transparentIPTables:
+	default:
+		return "", fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+
+	for _, cidr := range cfg.Bypass {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return "", fmt.Errorf("invalid bypass CIDR %q", cidr)
+		}
+	}
+
+	cfg.User = strings.TrimSpace(cfg.User)
+	if cg := strings.TrimSpace(cfg.Cgroup); cg != "" {
+		cfg.Cgroup = strings.Trim(path.Clean("/"+cg), "/")
+	}
+	if cfg.User == "" && cfg.Cgroup == "" {
+		return "", errors.New("a user or cgroup scope is required")
+	}
+	if strings.ContainsAny(cfg.Cgroup, "\"\\\n") {
+		return "", fmt.Errorf("invalid cgroup %q", cfg.Cgroup)
+	}
+
+	var uid string
+	if cfg.User != "" {
+		u, err := user.LookupId(cfg.User)
+		if err != nil {
+			if u, err = user.Lookup(cfg.User); err != nil {
+				return "", fmt.Errorf("unknown user %q", cfg.User)
+			}
+		}
+		uid = u.Uid
+		// 同時限定 cgroup 時，只要本程式不在該 cgroup 內即可
+		if uid == strconv.Itoa(os.Getuid()) && (cfg.Cgroup == "" || cgroupContains(cfg.Cgroup, selfCgroup())) {
+			return "", errors.New("scope includes ProxyMaster itself")
+		}
+	}
+	if cfg.User == "" && cgroupContains(cfg.Cgroup, selfCgroup()) {
+		return "", errors.New("scope includes ProxyMaster itself")
+	}
+	return uid, nil
+}
+
+// 本程式所在的 cgroup v2 路徑 (不含開頭的 /)，無法取得時回傳空字串
+func selfCgroup() string {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return strings.Trim(p, "/")
+		}
+	}
+	return ""
+}
+
+func cgroupContains(scope, cgroup string) bool {
+	if cgroup == "" {
+		return false
+	}
+	return cgroup == scope || strings.HasPrefix(cgroup, scope+"/")
+}
+
+// 依位址族拆分直連網段
+func transparentBypass(cfg TransparentConfig) (v4, v6 []string) {
+	v4 = append(append(v4, pacBypassNets...), transparentBypassV4...)
+	v6 = append(v6, transparentBypassV6...)
+	for _, cidr := range cfg.Bypass {
+		if ip, _, _ := net.ParseCIDR(cidr); ip.To4() != nil {
+			v4 = append(v4, cidr)
+		} else {
+			v6 = append(v6, cidr)
+		}
+	}
+	return v4, v6
+}
+
+// 產生套用與移除規則的指令
+func transparentRuleCmds(cfg TransparentConfig, uid string) (apply, remove []ruleCmd) {
+	v4, v6 := transparentBypass(cfg)
+
+	if cfg.Backend == transparentNFTables {
+		var b strings.Builder
+		// 先建立再刪除，讓重複套用時以新規則取代
+		fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\n", transparentTable, transparentTable)
+		fmt.Fprintf(&b, "table inet %s {\n", transparentTable)
+		b.WriteString("\tchain redirect {\n")
+		fmt.Fprintf(&b, "\t\tip daddr { %s } return\n", strings.Join(v4, ", "))
+		fmt.Fprintf(&b, "\t\tmeta nfproto ipv4 redirect to :%s\n", cfg.Port)
+		if cfg.IPv6 {
+			fmt.Fprintf(&b, "\t\tip6 daddr { %s } return\n", strings.Join(v6, ", "))
+			fmt.Fprintf(&b, "\t\tmeta nfproto ipv6 redirect to :%s\n", cfg.Port)
+		}
+		b.WriteString("\t}\n")
+		b.WriteString("\tchain output {\n")
+		b.WriteString("\t\ttype nat hook output priority -100; policy accept;\n")
+		match := "meta l4proto tcp"
+		if uid != "" {
+			match += " meta skuid " + uid
+		}
+		if cfg.Cgroup != "" {
+			match += fmt.Sprintf(" socket cgroupv2 level %d %q", len(strings.Split(cfg.Cgroup, "/")), cfg.Cgroup)
+		}
+		fmt.Fprintf(&b, "\t\t%s jump redirect\n", match)
+		b.WriteString("\t}\n}\n")
+
+		apply = []ruleCmd{{args: []string{"nft", "-f", "-"}, stdin: b.String()}}
+		remove = []ruleCmd{{args: []string{"nft", "delete", "table", "inet", transparentTable}}}
+		return apply, remove
+	}
+
+	type family struct {
+		bin    string
+		bypass []string
+	}
+	families := []family{{"iptables", v4}}
+	if cfg.IPv6 {
+		families = append(families, family{"ip6tables", v6})
+	}
+
+	jump := []string{"-p", "tcp"}
+	if uid != "" {
+		jump = append(jump, "-m", "owner", "--uid-owner", uid)
+	}
+	if cfg.Cgroup != "" {
+		jump = append(jump, "-m", "cgroup", "--path", cfg.Cgroup)
+	}
+	jump = append(jump, "-j", transparentChain)
+
+	for _, f := range families {
+		nat := func(args ...string) ruleCmd {
+			return ruleCmd{args: append([]string{f.bin, "-t", "nat"}, args...)}
+		}
+		apply = append(apply, nat("-N", transparentChain))
+		for _, cidr := range f.bypass {
+			apply = append(apply, nat("-A", transparentChain, "-d", cidr, "-j", "RETURN"))
+		}
+		apply = append(apply,
+			nat("-A", transparentChain, "-p", "tcp", "-j", "REDIRECT", "--to-ports", cfg.Port),
+			nat(append([]string{"-A", "OUTPUT"}, jump...)...),
+		)
+		remove = append(remove,
+			nat(append([]string{"-D", "OUTPUT"}, jump...)...),
+			nat("-F", transparentChain),
+			nat("-X", transparentChain),
+		)
+	}
+	return apply, remove
+}
+
+// 套用規則，先移除先前由本程式套用的規則；失敗時還原已執行的部分
+// 呼叫者需持有 t.mu
+func (t *transparentState) applyLocked(cfg TransparentConfig, uid string) error {
+	t.removeLocked()
+
+	apply, remove := transparentRuleCmds(cfg, uid)
+	if cfg.Backend == transparentIPTables {
+		// 清掉上次未正常移除的殘留 (忽略錯誤)
+		for _, c := range remove {
+			c.run()
+		}
+	}
+	for _, c := range apply {
+		if err := c.run(); err != nil {
+			for _, r := range remove {
+				r.run()
+			}
+			return err
+		}
+	}
+	t.applied = remove
+	return nil
+}
+
+// 移除已套用的規則 (呼叫者需持有 t.mu)
+func (t *transparentState) removeLocked() error {
+	var firstErr error
+	for _, c := range t.applied {
+		if err := c.run(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	t.applied = nil
+	return firstErr
+}
+
+// 啟動接收重導連線的監聽 (呼叫者需持有 t.mu)
+func (a *App) startTransparentLocked() error {
+	if a.transparent.listener != nil {
+		return nil
+	}
+	addrs := []string{"127.0.0.1"}
+	if a.transparent.cfg.IPv6 {
+		addrs = append(addrs, "::1")
+	}
+	ln, err := listenTCP(addrs, a.transparent.cfg.Port)
+	if err != nil {
+		return fmt.Errorf("transparent port %s is already in use: %v", a.transparent.cfg.Port, err)
+	}
+	a.transparent.listener = ln
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Starting transparent proxy on port %s", a.transparent.cfg.Port))
+	}
+	go a.serveTransparent(ln)
+	return nil
+}
+
+// 停止監聽 (呼叫者需持有 t.mu)
+func (a *App) stopTransparentLocked() {
+	if a.transparent.listener != nil {
+		a.transparent.listener.Close()
+		a.transparent.listener = nil
+	}
+}
+
+func (a *App) serveTransparent(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) && a.ctx != nil {
+				wailsRuntime.LogError(a.ctx, fmt.Sprintf("Transparent accept error: %v", err))
+			}
+			return
+		}
+		go a.handleTransparentConn(conn)
+	}
+}
+
+// 處理單一被重導的連線: 取回原始目標、嗅探主機名稱後依分流規則轉發
+func (a *App) handleTransparentConn(conn net.Conn) {
+	defer conn.Close()
+
+	dst, err := originalDst(conn)
+	if err != nil {
+		if a.ctx != nil {
+			wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("Transparent: original destination unavailable: %v", err))
+		}
+		return
+	}
+	// 未經重導直接連到監聽端口時，原始目標即本機位址，轉發會造成迴圈
+	if dst == conn.LocalAddr().String() {
+		return
+	}
+
+	// 以 SNI / Host 取得網域，讓網域規則生效並交由上游解析
+	br := bufio.NewReaderSize(conn, sniffMaxTLSRecord)
+	conn.SetReadDeadline(time.Now().Add(transparentSniffTimeout))
+	host := sniffHost(br)
+	conn.SetReadDeadline(time.Time{})
+
+	target := dst
+	if host != "" {
+		_, port, _ := net.SplitHostPort(dst)
+		target = net.JoinHostPort(host, port)
+	}
+
+	var remote *Proxy
+	switch action, _ := a.matchRule(target, 0); action {
+	case actionReject:
+		return
+	case actionProxy:
+		remote = a.pickUpstream(target)
+		if remote == nil {
+			return
+		}
+	}
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("收到透明代理連線: %s (原始目標 %s)", target, dst))
+	}
+
+	client := remoteIP(conn.RemoteAddr())
+	lc := a.conns.add(connKindTransparent, client, target, remote)
+	defer a.conns.remove(lc)
+	lc.onKill(func() { conn.Close() })
+
+	var flow *trafficFlow
+	rec := a.inspector.begin(connKindTransparent, http.MethodConnect, "tcp://"+target, client, transportLabel(remote), nil)
+	defer func() { rec.finish(flow) }()
+
+	upstream, err := dialUpstream(remote, target, a.routeResolver(remote))
+	if err != nil {
+		rec.status(http.StatusBadGateway)
+		rec.fail(err)
+		if errors.Is(err, errProxyAuthRequired) {
+			if a.ctx != nil {
+				wailsRuntime.EventsEmit(a.ctx, "proxy_auth_failed", remote.IP)
+			}
+			return
+		}
+		if upstreamFault(err) {
+			a.reportUpstream(remote, false)
+		}
+		return
+	}
+	defer upstream.Close()
+	a.reportUpstream(remote, true)
+	rec.status(http.StatusOK)
+
+	flow = a.beginTraffic(client, target, remote)
+	defer flow.end()
+
+	lc.attach(flow)
+	lc.onKill(func() { upstream.Close() })
+	lc.setState(connStateEstablished)
+
+	// 嗅探時已讀入的資料需先送出
+	if n := br.Buffered(); n > 0 {
+		buffered, _ := br.Peek(n)
+		if _, err := upstream.Write(buffered); err != nil {
+			return
+		}
+		flow.addUp(n)
+		br.Discard(n)
+	}
+
+	relayConns(conn, upstream, a.tunnelLimits(), flow)
+}
+
+// 關閉監聽並移除已套用的規則 (程式結束時)
+func (a *App) stopTransparent() {
+	a.transparent.mu.Lock()
+	defer a.transparent.mu.Unlock()
+	a.stopTransparentLocked()
+	if err := a.transparent.removeLocked(); err != nil && a.ctx != nil {
+		wailsRuntime.LogError(a.ctx, fmt.Sprintf("Failed to remove transparent rules: %v", err))
+	}
+}
+
+// 25. 設定透明代理 (啟用時開始監聽；規則已套用時以新設定重新套用)
+func (a *App) SetTransparentProxy(cfg TransparentConfig) string {
+	if cfg.Enabled && !transparentSupported {
+		return "unsupported_platform"
+	}
+	uid, err := normalizeTransparentConfig(&cfg)
+	if err != nil {
+		return fmt.Sprintf("invalid_config: %v", err)
+	}
+
+	t := &a.transparent
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reapply := t.applied != nil
+	a.stopTransparentLocked()
+	t.cfg = cfg
+
+	if !cfg.Enabled {
+		if err := t.removeLocked(); err != nil {
+			return fmt.Sprintf("remove_failed: %v", err)
+		}
+		return "Success"
+	}
+	if err := a.startTransparentLocked(); err != nil {
+		return fmt.Sprintf("listen_failed: %v", err)
+	}
+	if reapply {
+		if err := t.applyLocked(cfg, uid); err != nil {
+			return fmt.Sprintf("apply_failed: %v", err)
+		}
+	}
+	return "Success"
+}
+
+// 25-1. 取得透明代理狀態
+func (a *App) GetTransparentStatus() TransparentStatus {
+	t := &a.transparent
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cfg := t.cfg
+	if cfg.Port == "" {
+		cfg.Port = defaultTransparentPort
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = transparentNFTables
+	}
+	cfg.Bypass = append([]string{}, cfg.Bypass...)
+	return TransparentStatus{
+		Supported:    transparentSupported,
+		Config:       cfg,
+		Listening:    t.listener != nil,
+		RulesApplied: t.applied != nil,
+	}
+}
+
+// 25-2. 依目前設定產生防火牆規則 (可自行以 root 執行)
+func (a *App) GetTransparentRules() TransparentRules {
+	a.transparent.mu.Lock()
+	cfg := a.transparent.cfg
+	a.transparent.mu.Unlock()
+
+	uid, err := normalizeTransparentConfig(&cfg)
+	if err != nil {
+		return TransparentRules{Backend: cfg.Backend, Error: err.Error()}
+	}
+	apply, remove := transparentRuleCmds(cfg, uid)
+	return TransparentRules{
+		Backend: cfg.Backend,
+		Apply:   renderScript(apply),
+		Remove:  renderScript(remove),
+	}
+}
+
+// 25-3. 套用防火牆規則 (需要 root 或 CAP_NET_ADMIN)
+func (a *App) ApplyTransparentRules() string {
+	if !transparentSupported {
+		return "unsupported_platform"
+	}
+	t := &a.transparent
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cfg := t.cfg
+	if !cfg.Enabled || t.listener == nil {
+		return "transparent_not_enabled"
+	}
+	uid, err := normalizeTransparentConfig(&cfg)
+	if err != nil {
+		return fmt.Sprintf("invalid_config: %v", err)
+	}
+	if err := t.applyLocked(cfg, uid); err != nil {
+		if a.ctx != nil {
+			wailsRuntime.LogError(a.ctx, fmt.Sprintf("Failed to apply transparent rules: %v", err))
+		}
+		return fmt.Sprintf("apply_failed: %v", err)
+	}
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("Transparent rules applied (%s)", cfg.Backend))
+	}
+	return "Success"
+}
+
+// 25-4. 移除由本程式套用的防火牆規則
+func (a *App) RemoveTransparentRules() string {
+	t := &a.transparent
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.removeLocked(); err != nil {
+		return fmt.Sprintf("remove_failed: %v", err)
+	}
+	return "Success"
+}
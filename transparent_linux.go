@@ -0,0 +1,61 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// SO_ORIGINAL_DST / IP6T_SO_ORIGINAL_DST (netfilter)
+const soOriginalDst = 80
+
+const transparentSupported = true
+
+// 取得被 REDIRECT 前的原始目標位址
+func originalDst(conn net.Conn) (string, error) {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return "", errors.New("not a TCP connection")
+	}
+	local, _ := tc.LocalAddr().(*net.TCPAddr)
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+
+	var addr string
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if local != nil && local.IP.To4() != nil {
+			// sockaddr_in: family(2) port(2) addr(4)
+			mreq, err := syscall.GetsockoptIPv6Mreq(int(fd), syscall.SOL_IP, soOriginalDst)
+			if err != nil {
+				sockErr = err
+				return
+			}
+			sa := mreq.Multiaddr
+			port := binary.BigEndian.Uint16(sa[2:4])
+			addr = net.JoinHostPort(net.IP(sa[4:8]).String(), strconv.Itoa(int(port)))
+			return
+		}
+
+		info, err := syscall.GetsockoptIPv6MTUInfo(int(fd), syscall.SOL_IPV6, soOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		// Port 為網路位元組順序
+		var port [2]byte
+		binary.NativeEndian.PutUint16(port[:], info.Addr.Port)
+		ip := net.IP(info.Addr.Addr[:])
+		addr = net.JoinHostPort(ip.String(), strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+	})
+	if err != nil {
+		return "", err
+	}
+	return addr, sockErr
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+const transparentSupported = false
+
+// 透明代理僅支援 Linux (netfilter REDIRECT)
+func originalDst(conn net.Conn) (string, error) {
+	return "", errTransparentUnsupported
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"nft":               "nft",
+		"-t":                "-t",
+		"10.0.0.0/8":        "10.0.0.0/8",
+		"proxymaster.slice": "proxymaster.slice",
+		"":                  "''",
+		"a b":               "'a b'",
+		"it's":              `'it'\''s'`,
+		"$HOME":             "'$HOME'",
+	}
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestRenderScript(t *testing.T) {
+	cmds := []ruleCmd{
+		{args: []string{"iptables", "-t", "nat", "-N", "PROXYMASTER"}},
+		{args: []string{"nft", "-f", "-"}, stdin: "table inet x\n"},
+	}
+	want := "iptables -t nat -N PROXYMASTER\nnft -f - <<'EOF'\ntable inet x\nEOF\n"
+	if got := renderScript(cmds); got != want {
+		t.Errorf("renderScript() = %q, want %q", got, want)
+	}
+}
+
+func TestCgroupContains(t *testing.T) {
+	tests := []struct {
+		scope, cgroup string
+		want          bool
+	}{
+		{"app.slice", "app.slice", true},
+		{"app.slice", "app.slice/run.scope", true},
+		{"app.slice", "app.slice2", false},
+		{"app.slice/a", "app.slice", false},
+		{"app.slice", "", false},
+	}
+	for _, tt := range tests {
+		if got := cgroupContains(tt.scope, tt.cgroup); got != tt.want {
+			t.Errorf("cgroupContains(%q, %q) = %v, want %v", tt.scope, tt.cgroup, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTransparentConfig(t *testing.T) {
+	const cgroup = "proxymaster-test.slice"
+	tests := []struct {
+		name    string
+		cfg     TransparentConfig
+		want    TransparentConfig
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			cfg:  TransparentConfig{Cgroup: " /" + cgroup + "/ "},
+			want: TransparentConfig{Port: defaultTransparentPort, Backend: transparentNFTables, Cgroup: cgroup},
+		},
+		{
+			name: "nested cgroup",
+			cfg:  TransparentConfig{Port: " 3000 ", Backend: transparentIPTables, Cgroup: "a.slice//b.scope/../c.scope", Bypass: []string{"10.0.0.0/8"}},
+			want: TransparentConfig{Port: "3000", Backend: transparentIPTables, Cgroup: "a.slice/c.scope", Bypass: []string{"10.0.0.0/8"}},
+		},
+		{name: "port not numeric", cfg: TransparentConfig{Port: "http", Cgroup: cgroup}, wantErr: `invalid port "http"`},
+		{name: "port zero", cfg: TransparentConfig{Port: "0", Cgroup: cgroup}, wantErr: `invalid port "0"`},
+		{name: "port oversized", cfg: TransparentConfig{Port: "65536", Cgroup: cgroup}, wantErr: `invalid port "65536"`},
+		{name: "unknown backend", cfg: TransparentConfig{Backend: "pf", Cgroup: cgroup}, wantErr: `unknown backend "pf"`},
+		{name: "bad bypass", cfg: TransparentConfig{Cgroup: cgroup, Bypass: []string{"10.0.0.1"}}, wantErr: `invalid bypass CIDR "10.0.0.1"`},
+		{name: "no scope", cfg: TransparentConfig{}, wantErr: "a user or cgroup scope is required"},
+		{name: "cgroup with quote", cfg: TransparentConfig{Cgroup: `a"b`}, wantErr: `invalid cgroup "a\"b"`},
+		{name: "unknown user", cfg: TransparentConfig{User: "no-such-user-proxymaster"}, wantErr: `unknown user "no-such-user-proxymaster"`},
+		{name: "self", cfg: TransparentConfig{User: strconv.Itoa(os.Getuid())}, wantErr: "scope includes ProxyMaster itself"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			uid, err := normalizeTransparentConfig(&cfg)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("normalizeTransparentConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeTransparentConfig() error: %v", err)
+			}
+			if uid != "" || !reflect.DeepEqual(cfg, tt.want) {
+				t.Errorf("normalizeTransparentConfig() = %q, %+v, want %+v", uid, cfg, tt.want)
+			}
+		})
+	}
+
+	// 本程式的使用者搭配不含本程式的 cgroup 是允許的
+	cfg := TransparentConfig{User: strconv.Itoa(os.Getuid()), Cgroup: cgroup}
+	if uid, err := normalizeTransparentConfig(&cfg); err != nil || uid != strconv.Itoa(os.Getuid()) {
+		t.Errorf("self user with cgroup = %q, %v", uid, err)
+	}
+	// 以名稱指定其他使用者
+	other := "nobody"
+	if u, err := user.Lookup(other); err == nil && u.Uid != strconv.Itoa(os.Getuid()) {
+		cfg := TransparentConfig{User: other}
+		if uid, err := normalizeTransparentConfig(&cfg); err != nil || uid != u.Uid {
+			t.Errorf("user %s = %q, %v, want %s", other, uid, err, u.Uid)
+		}
+	}
+}
+
+func TestTransparentBypass(t *testing.T) {
+	v4, v6 := transparentBypass(TransparentConfig{Bypass: []string{"203.0.113.0/24", "2001:db8::/32"}})
+	if len(v4) != len(pacBypassNets)+len(transparentBypassV4)+1 || v4[len(v4)-1] != "203.0.113.0/24" {
+		t.Errorf("v4 = %v", v4)
+	}
+	if len(v6) != len(transparentBypassV6)+1 || v6[len(v6)-1] != "2001:db8::/32" {
+		t.Errorf("v6 = %v", v6)
+	}
+	// 不可修改共用的預設清單
+	v4, _ = transparentBypass(TransparentConfig{})
+	if len(v4) != len(pacBypassNets)+len(transparentBypassV4) {
+		t.Errorf("default v4 = %v", v4)
+	}
+}
+
+func TestTransparentRuleCmds(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        TransparentConfig
+		uid        string
+		apply      []string // 套用指令須包含的片段
+		notApply   []string
+		remove     string
+		applyCount int
+	}{
+		{
+			name: "nftables user",
+			cfg:  TransparentConfig{Port: "2082", Backend: transparentNFTables},
+			uid:  "1000",
+			apply: []string{
+				"nft -f - <<'EOF'",
+				"delete table inet proxymaster",
+				"meta nfproto ipv4 redirect to :2082",
+				"meta l4proto tcp meta skuid 1000 jump redirect",
+			},
+			notApply:   []string{"ip6 daddr", "cgroupv2"},
+			remove:     "nft delete table inet proxymaster\n",
+			applyCount: 1,
+		},
+		{
+			name: "nftables cgroup ipv6",
+			cfg:  TransparentConfig{Port: "2082", Backend: transparentNFTables, Cgroup: "a.slice/b.scope", IPv6: true},
+			apply: []string{
+				"ip6 daddr { ::1/128, fc00::/7, fe80::/10, ff00::/8 } return",
+				"meta nfproto ipv6 redirect to :2082",
+				`meta l4proto tcp socket cgroupv2 level 2 "a.slice/b.scope" jump redirect`,
+			},
+			notApply:   []string{"skuid"},
+			remove:     "nft delete table inet proxymaster\n",
+			applyCount: 1,
+		},
+		{
+			name: "iptables user and cgroup",
+			cfg:  TransparentConfig{Port: "3000", Backend: transparentIPTables, Cgroup: "a.slice"},
+			uid:  "1000",
+			apply: []string{
+				"iptables -t nat -N PROXYMASTER\n",
+				"iptables -t nat -A PROXYMASTER -d 10.0.0.0/8 -j RETURN\n",
+				"iptables -t nat -A PROXYMASTER -p tcp -j REDIRECT --to-ports 3000\n",
+				"iptables -t nat -A OUTPUT -p tcp -m owner --uid-owner 1000 -m cgroup --path a.slice -j PROXYMASTER\n",
+			},
+			notApply: []string{"ip6tables"},
+			remove: "iptables -t nat -D OUTPUT -p tcp -m owner --uid-owner 1000 -m cgroup --path a.slice -j PROXYMASTER\n" +
+				"iptables -t nat -F PROXYMASTER\niptables -t nat -X PROXYMASTER\n",
+			applyCount: 1 + len(pacBypassNets) + len(transparentBypassV4) + 2,
+		},
+		{
+			name:       "iptables ipv6",
+			cfg:        TransparentConfig{Port: "3000", Backend: transparentIPTables, Cgroup: "a.slice", IPv6: true},
+			apply:      []string{"ip6tables -t nat -A PROXYMASTER -d fe80::/10 -j RETURN\n", "ip6tables -t nat -A OUTPUT -p tcp -m cgroup --path a.slice -j PROXYMASTER\n"},
+			applyCount: 1 + len(pacBypassNets) + len(transparentBypassV4) + 2 + 1 + len(transparentBypassV6) + 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apply, remove := transparentRuleCmds(tt.cfg, tt.uid)
+			if len(apply) != tt.applyCount {
+				t.Errorf("len(apply) = %d, want %d", len(apply), tt.applyCount)
+			}
+			script := renderScript(apply)
+			for _, s := range tt.apply {
+				if !strings.Contains(script, s) {
+					t.Errorf("apply script missing %q:\n%s", s, script)
+				}
+			}
+			for _, s := range tt.notApply {
+				if strings.Contains(script, s) {
+					t.Errorf("apply script contains %q:\n%s", s, script)
+				}
+			}
+			if tt.remove != "" && renderScript(remove) != tt.remove {
+				t.Errorf("remove script = %q, want %q", renderScript(remove), tt.remove)
+			}
+		})
+	}
+}
+
+func TestSetTransparentProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	a := &App{}
+	if got := a.SetTransparentProxy(TransparentConfig{Enabled: true}); got != "invalid_config: a user or cgroup scope is required" && transparentSupported {
+		t.Errorf("SetTransparentProxy(no scope) = %q", got)
+	}
+	if got := a.ApplyTransparentRules(); got != "transparent_not_enabled" && transparentSupported {
+		t.Errorf("ApplyTransparentRules() before enable = %q", got)
+	}
+
+	cfg := TransparentConfig{Enabled: true, Port: port, Cgroup: "proxymaster-test.slice"}
+	got := a.SetTransparentProxy(cfg)
+	if !transparentSupported {
+		if got != "unsupported_platform" {
+			t.Errorf("SetTransparentProxy() = %q, want unsupported_platform", got)
+		}
+		return
+	}
+	if got != "Success" {
+		t.Fatalf("SetTransparentProxy() = %q", got)
+	}
+	st := a.GetTransparentStatus()
+	if !st.Supported || !st.Listening || st.RulesApplied || st.Config.Backend != transparentNFTables {
+		t.Errorf("GetTransparentStatus() = %+v", st)
+	}
+	// 已被占用的端口
+	if got := (&App{}).SetTransparentProxy(cfg); !strings.HasPrefix(got, "listen_failed:") {
+		t.Errorf("SetTransparentProxy(port in use) = %q", got)
+	}
+	rules := a.GetTransparentRules()
+	if rules.Error != "" || !strings.Contains(rules.Apply, "redirect to :"+port) || rules.Remove == "" {
+		t.Errorf("GetTransparentRules() = %+v", rules)
+	}
+
+	cfg.Enabled = false
+	if got := a.SetTransparentProxy(cfg); got != "Success" {
+		t.Fatalf("SetTransparentProxy(disabled) = %q", got)
+	}
+	if st := a.GetTransparentStatus(); st.Listening {
+		t.Errorf("still listening after disable: %+v", st)
+	}
+	if got := a.RemoveTransparentRules(); got != "Success" {
+		t.Errorf("RemoveTransparentRules() = %q", got)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ---------------- 上游 Transport 連線池 ----------------
+
+const (
+	// 超過此時間未使用的 Transport 會被回收
+	transportEvictAfter = 5 * time.Minute
+	// 回收檢查週期
+	transportJanitorInterval = time.Minute
+)
+
+// TransportStats 單一上游 Transport 的連線池統計
+type TransportStats struct {
+	Upstream    string `json:"upstream"`
+	OpenConns   int64  `json:"openConns"`
+	ActiveConns int64  `json:"activeConns"`
+	IdleConns   int64  `json:"idleConns"`
+	Requests    int64  `json:"requests"`
+	CreatedAt   int64  `json:"createdAt"` // Unix 毫秒
+	LastUsed    int64  `json:"lastUsed"`  // Unix 毫秒
+}
+
+// 依上游身分共用的 Transport，並統計連線數
+type pooledTransport struct {
+	transport *http.Transport
+	upstream  string
+	createdAt time.Time
+	lastUsed  atomic.Int64
+
+	open     atomic.Int64
+	active   atomic.Int64
+	requests atomic.Int64
+}
+
+// 標記一個請求開始使用此 Transport，回傳結束時呼叫的函式
+func (pt *pooledTransport) begin() func() {
+	pt.active.Add(1)
+	pt.requests.Add(1)
+	pt.lastUsed.Store(time.Now().UnixMilli())
+	return func() {
+		pt.active.Add(-1)
+		pt.lastUsed.Store(time.Now().UnixMilli())
+	}
+}
+
+func (pt *pooledTransport) stats() TransportStats {
+	open, active := pt.open.Load(), pt.active.Load()
+	idle := open - active
+	if idle < 0 {
+		idle = 0
+	}
+	return TransportStats{
+		Upstream:    pt.upstream,
+		OpenConns:   open,
+		ActiveConns: active,
+		IdleConns:   idle,
+		Requests:    pt.requests.Load(),
+		CreatedAt:   pt.createdAt.UnixMilli(),
+		LastUsed:    pt.lastUsed.Load(),
+	}
+}
+
+// countedConn 關閉時更新所屬 Transport 的連線數
+type countedConn struct {
+	net.Conn
+	once sync.Once
+	pt   *pooledTransport
+}
+
+func (c *countedConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.pt.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+type transportPool struct {
+	mu      sync.Mutex
+	entries map[string]*pooledTransport
+	stop    chan struct{} // 回收 goroutine 執行中時非 nil，關閉即停止
+}
+
+// 上游身分: 完整路徑上每一跳的協定、位址、帳密與 TLS 設定，直連為 DIRECT
+func transportKey(p *Proxy) string {
+	if p == nil {
+		return actionDirect
+	}
+	parts := make([]string, 0, len(p.Via)+1)
+	for _, hop := range proxyHops(p) {
+		parts = append(parts, strings.Join([]string{
+			strings.ToLower(hop.Protocol), hop.IP, hop.Port, hop.Username, hop.Password,
+			hop.TLSServerName, hop.TLSCAFile, hop.TLSCertFile, hop.TLSKeyFile,
+		}, "|"))
+	}
+	return strings.Join(parts, ">")
+}
+
+// 顯示用的上游名稱 (不含帳密)
+func transportLabel(p *Proxy) string {
+	if p == nil {
+		return actionDirect
+	}
+	var names []string
+	for _, hop := range proxyHops(p) {
+		protocol := strings.ToLower(hop.Protocol)
+		if protocol == "" {
+			protocol = "http"
+		}
+		names = append(names, fmt.Sprintf("%s://%s", protocol, net.JoinHostPort(hop.IP, hop.Port)))
+	}
+	return strings.Join(names, " -> ")
+}
+
+// 取得 (或建立) 上游對應的共用 Transport，tlsConfig 與 r 只在建立時使用
+func (tp *transportPool) get(p *Proxy, tlsConfig *tls.Config, r *dnsResolver) *pooledTransport {
+	key := transportKey(p)
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	if pt := tp.entries[key]; pt != nil {
+		return pt
+	}
+	if tp.entries == nil {
+		tp.entries = make(map[string]*pooledTransport)
+	}
+
+	pt := &pooledTransport{
+		transport: buildTransport(p, tlsConfig, r),
+		upstream:  transportLabel(p),
+		createdAt: time.Now(),
+	}
+	pt.lastUsed.Store(pt.createdAt.UnixMilli())
+
+	dial := pt.transport.DialContext
+	pt.transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		pt.open.Add(1)
+		return &countedConn{Conn: conn, pt: pt}, nil
+	}
+
+	tp.entries[key] = pt
+	if tp.stop == nil {
+		tp.stop = make(chan struct{})
+		go tp.runJanitor(tp.stop)
+	}
+	return pt
+}
+
+// 上游變更時移除舊節點的 Transport 並關閉其閒置連線
+func (tp *transportPool) invalidate(p *Proxy) {
+	key := transportKey(p)
+
+	tp.mu.Lock()
+	pt := tp.entries[key]
+	delete(tp.entries, key)
+	tp.mu.Unlock()
+
+	if pt != nil {
+		pt.transport.CloseIdleConnections()
+	}
+}
+
+// 關閉所有 Transport 的閒置連線並停止回收 goroutine (斷開或程式結束時)
+// 之後再次 get 會重新啟動回收
+func (tp *transportPool) closeAll() {
+	tp.mu.Lock()
+	entries := tp.entries
+	tp.entries = nil
+	if tp.stop != nil {
+		close(tp.stop)
+		tp.stop = nil
+	}
+	tp.mu.Unlock()
+
+	for _, pt := range entries {
+		pt.transport.CloseIdleConnections()
+	}
+}
+
+// 回收長時間未使用且沒有進行中請求的 Transport
+func (tp *transportPool) evictIdle(maxIdle time.Duration) {
+	cutoff := time.Now().Add(-maxIdle).UnixMilli()
+
+	tp.mu.Lock()
+	var evicted []*pooledTransport
+	for key, pt := range tp.entries {
+		if pt.active.Load() == 0 && pt.lastUsed.Load() < cutoff {
+			evicted = append(evicted, pt)
+			delete(tp.entries, key)
+		}
+	}
+	tp.mu.Unlock()
+
+	for _, pt := range evicted {
+		pt.transport.CloseIdleConnections()
+	}
+}
+
+func (tp *transportPool) runJanitor(stop <-chan struct{}) {
+	ticker := time.NewTicker(transportJanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tp.evictIdle(transportEvictAfter)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (tp *transportPool) stats() []TransportStats {
+	tp.mu.Lock()
+	result := make([]TransportStats, 0, len(tp.entries))
+	for _, pt := range tp.entries {
+		result = append(result, pt.stats())
+	}
+	tp.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Upstream < result[j].Upstream })
+	return result
+}
+
+// 15. 取得上游連線池統計 (診斷用)
+func (a *App) GetTransportStats() []TransportStats {
+	return a.transports.stats()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTransportKey(t *testing.T) {
+	base := Proxy{IP: "10.0.0.1", Port: "8080", Protocol: "http"}
+	with := func(f func(p *Proxy)) *Proxy {
+		p := base
+		f(&p)
+		return &p
+	}
+	tests := []struct {
+		name string
+		a, b *Proxy
+		same bool
+	}{
+		{name: "identical", a: &base, b: with(func(p *Proxy) {}), same: true},
+		{name: "protocol case", a: &base, b: with(func(p *Proxy) { p.Protocol = "HTTP" }), same: true},
+		{name: "display fields ignored", a: &base, b: with(func(p *Proxy) { p.Country = "JP"; p.Latency = 42 }), same: true},
+		{name: "different port", a: &base, b: with(func(p *Proxy) { p.Port = "8081" }), same: false},
+		{name: "different protocol", a: &base, b: with(func(p *Proxy) { p.Protocol = "socks5" }), same: false},
+		{name: "different user", a: with(func(p *Proxy) { p.Username = "a" }), b: with(func(p *Proxy) { p.Username = "b" }), same: false},
+		{name: "different password", a: with(func(p *Proxy) { p.Password = "a" }), b: with(func(p *Proxy) { p.Password = "b" }), same: false},
+		{name: "different tls name", a: with(func(p *Proxy) { p.TLSServerName = "a" }), b: &base, same: false},
+		{name: "chained", a: with(func(p *Proxy) { p.Via = []Proxy{{IP: "10.0.0.9", Port: "1080", Protocol: "socks5"}} }), b: &base, same: false},
+		{name: "direct", a: nil, b: nil, same: true},
+		{name: "direct vs proxy", a: nil, b: &base, same: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ka, kb := transportKey(tt.a), transportKey(tt.b)
+			if (ka == kb) != tt.same {
+				t.Errorf("transportKey() = %q, %q, same = %v, want %v", ka, kb, ka == kb, tt.same)
+			}
+		})
+	}
+}
+
+func TestTransportLabel(t *testing.T) {
+	tests := []struct {
+		p    *Proxy
+		want string
+	}{
+		{nil, "DIRECT"},
+		{&Proxy{IP: "10.0.0.1", Port: "8080", Username: "u", Password: "secret"}, "http://10.0.0.1:8080"},
+		{&Proxy{IP: "::1", Port: "1080", Protocol: "SOCKS5"}, "socks5://[::1]:1080"},
+		{&Proxy{IP: "10.0.0.2", Port: "443", Protocol: "https", Via: []Proxy{{IP: "10.0.0.1", Port: "1080", Protocol: "socks5"}}},
+			"socks5://10.0.0.1:1080 -> https://10.0.0.2:443"},
+	}
+	for _, tt := range tests {
+		if got := transportLabel(tt.p); got != tt.want {
+			t.Errorf("transportLabel(%+v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestTransportPool(t *testing.T) {
+	var tp transportPool
+	a := &Proxy{IP: "10.0.0.1", Port: "8080"}
+	b := &Proxy{IP: "10.0.0.2", Port: "8080"}
+
+	pa := tp.get(a, nil, nil)
+	if tp.get(&Proxy{IP: "10.0.0.1", Port: "8080"}, nil, nil) != pa {
+		t.Fatal("same upstream did not share a transport")
+	}
+	if tp.get(b, nil, nil) == pa {
+		t.Fatal("different upstreams share a transport")
+	}
+	if len(tp.stats()) != 2 {
+		t.Fatalf("stats() = %+v, want 2 entries", tp.stats())
+	}
+
+	tp.invalidate(a)
+	if tp.get(a, nil, nil) == pa {
+		t.Fatal("invalidate() kept the old transport")
+	}
+
+	// 進行中的請求不會被回收
+	pb := tp.get(b, nil, nil)
+	done := pb.begin()
+	pb.lastUsed.Store(time.Now().Add(-time.Hour).UnixMilli())
+	tp.get(a, nil, nil).lastUsed.Store(time.Now().Add(-time.Hour).UnixMilli())
+	tp.evictIdle(time.Minute)
+	if stats := tp.stats(); len(stats) != 1 || stats[0].Upstream != "http://10.0.0.2:8080" {
+		t.Fatalf("stats() after evict = %+v, want only the busy transport", stats)
+	}
+	done()
+	pb.lastUsed.Store(time.Now().Add(-time.Hour).UnixMilli())
+	tp.evictIdle(time.Minute)
+	if stats := tp.stats(); len(stats) != 0 {
+		t.Fatalf("stats() after second evict = %+v, want empty", stats)
+	}
+
+	tp.get(a, nil, nil)
+	stop := tp.stop
+	tp.closeAll()
+	if stats := tp.stats(); len(stats) != 0 {
+		t.Fatalf("stats() after closeAll = %+v, want empty", stats)
+	}
+
+	// closeAll 停止回收 goroutine，下次 get 重新啟動
+	select {
+	case <-stop:
+	default:
+		t.Fatal("closeAll() did not stop the janitor")
+	}
+	if tp.stop != nil {
+		t.Fatal("closeAll() left the janitor marked as running")
+	}
+	tp.get(a, nil, nil)
+	if tp.stop == nil {
+		t.Fatal("get() after closeAll did not restart the janitor")
+	}
+	tp.closeAll()
+	tp.closeAll() // 重複呼叫不應 panic
+}
+
+func TestPooledTransportCountsConns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	var tp transportPool
+	pt := tp.get(nil, nil, nil)
+	client := &http.Client{Transport: pt.transport}
+	for i := 0; i < 3; i++ {
+		done := pt.begin()
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		done()
+	}
+
+	st := pt.stats()
+	if st.Upstream != "DIRECT" || st.Requests != 3 || st.ActiveConns != 0 {
+		t.Errorf("stats() = %+v, want 3 DIRECT requests and none active", st)
+	}
+	// keep-alive 連線應被重用
+	if st.OpenConns != 1 || st.IdleConns != 1 {
+		t.Errorf("stats() = %+v, want one reused idle connection", st)
+	}
+
+	tp.closeAll()
+	deadline := time.Now().Add(2 * time.Second)
+	for pt.open.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := pt.open.Load(); n != 0 {
+		t.Errorf("open conns after closeAll = %d, want 0", n)
+	}
+}
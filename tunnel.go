@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ---------------- 雙向通道轉發 (Tunnel) ----------------
+
+const (
+	// 雙向都沒有資料超過此時間即關閉通道
+	defaultTunnelIdleTimeout = 5 * time.Minute
+	// 通道存活上限，0 表示不限制
+	defaultTunnelMaxLifetime = 0
+)
+
+// 通道逾時設定
+type tunnelLimits struct {
+	idle time.Duration
+	max  time.Duration
+}
+
+var errHalfCloseNotSupported = errors.New("half-close not supported")
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// 關閉寫入方向 (送出 FIN)，讓對方知道資料已送完但仍可繼續接收
+func closeWrite(w io.Writer) error {
+	if cw, ok := w.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return errHalfCloseNotSupported
+}
+
+// bufferedConn 讀取時先取出握手階段已讀入緩衝區的資料
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+// 雙向轉發數據
+// 單一方向結束時以 CloseWrite 半關閉對方，兩個方向都結束才返回；
+// 超過閒置或存活上限時強制關閉兩端；flow 不為 nil 時同時記錄流量
+func relayConns(client net.Conn, upstream io.ReadWriteCloser, limits tunnelLimits, flow *trafficFlow) {
+	var lastActive atomic.Int64
+	touch := func() { lastActive.Store(time.Now().UnixNano()) }
+	touch()
+
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			client.Close()
+			upstream.Close()
+		})
+	}
+
+	pipe := func(dst io.ReadWriteCloser, src io.Reader, dir int, count func(int), done chan<- struct{}) {
+		defer close(done)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf[:flow.limiter().chunk(dir, len(buf))])
+			if n > 0 {
+				touch()
+				// 限速等待超過上限時中斷通道，等待期間不視為閒置
+				if flow.limiter().wait(dir, n, touch) != nil {
+					closeBoth()
+					return
+				}
+				if _, werr := dst.Write(buf[:n]); werr != nil {
+					closeBoth()
+					return
+				}
+				count(n)
+			}
+			if err == io.EOF {
+				// 對方送完資料，半關閉寫入方向；不支援時只能整條關閉
+				if closeWrite(dst) != nil {
+					closeBoth()
+				}
+				return
+			}
+			if err != nil {
+				closeBoth()
+				return
+			}
+		}
+	}
+
+	up := make(chan struct{})
+	down := make(chan struct{})
+	go pipe(upstream, client, dirUp, flow.addUp, up)
+	go pipe(client, upstream, dirDown, flow.addDown, down)
+
+	// 監看閒置與存活時間
+	stop := make(chan struct{})
+	defer close(stop)
+	if limits.idle > 0 || limits.max > 0 {
+		go func() {
+			start := time.Now()
+			interval := time.Second
+			if limits.idle > 0 && limits.idle/4 < interval {
+				interval = limits.idle / 4
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case now := <-ticker.C:
+					idle := now.Sub(time.Unix(0, lastActive.Load()))
+					if (limits.idle > 0 && idle >= limits.idle) || (limits.max > 0 && now.Sub(start) >= limits.max) {
+						closeBoth()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	<-up
+	<-down
+	closeBoth()
+}
+
+// 取得目前的通道逾時設定
+func (a *App) tunnelLimits() tunnelLimits {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return tunnelLimits{idle: a.tunnelIdleTimeout, max: a.tunnelMaxLifetime}
+}
+
+// 16. 設定通道 (CONNECT / SOCKS5 / WebSocket) 的閒置與存活上限 (秒)，0 表示不限制
+func (a *App) SetTunnelTimeouts(idleSeconds, maxSeconds int) {
+	if idleSeconds < 0 {
+		idleSeconds = 0
+	}
+	if maxSeconds < 0 {
+		maxSeconds = 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tunnelIdleTimeout = time.Duration(idleSeconds) * time.Second
+	a.tunnelMaxLifetime = time.Duration(maxSeconds) * time.Second
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 建立一對已連線的 TCP 連線
+func tcpPair(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := <-accepted
+	if conn == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		dialed.Close()
+		conn.Close()
+	})
+	return dialed.(*net.TCPConn), conn.(*net.TCPConn)
+}
+
+func TestCloseWrite(t *testing.T) {
+	a, _ := tcpPair(t)
+	if err := closeWrite(a); err != nil {
+		t.Errorf("closeWrite(TCPConn) = %v", err)
+	}
+	if err := closeWrite(&bytes.Buffer{}); err != errHalfCloseNotSupported {
+		t.Errorf("closeWrite(Buffer) = %v, want errHalfCloseNotSupported", err)
+	}
+	b, _ := tcpPair(t)
+	if err := closeWrite(&bufferedConn{Conn: b, r: b}); err != nil {
+		t.Errorf("closeWrite(bufferedConn) = %v", err)
+	}
+}
+
+// 客戶端送完請求後半關閉，上游讀到 EOF 才回應 (類似 HTTP/1.0 或 rsync)
+func TestRelayConnsHalfClose(t *testing.T) {
+	client, relayClient := tcpPair(t)
+	relayUpstream, server := tcpPair(t)
+
+	go func() {
+		req, _ := io.ReadAll(server)
+		server.Write(append([]byte("reply:"), req...))
+		server.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		relayConns(relayClient, relayUpstream, tunnelLimits{idle: 5 * time.Second}, nil)
+		close(done)
+	}()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	client.Write([]byte("request"))
+	client.CloseWrite()
+
+	got, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "reply:request" {
+		t.Errorf("reply = %q, want reply:request", got)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relayConns did not return after both directions finished")
+	}
+}
+
+func TestRelayConnsLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits tunnelLimits
+		// 傳輸期間持續送資料，確認閒置計時會被重設
+		chatter bool
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "idle timeout", limits: tunnelLimits{idle: 200 * time.Millisecond}, min: 200 * time.Millisecond, max: 2 * time.Second},
+		{name: "activity resets idle", limits: tunnelLimits{idle: 300 * time.Millisecond}, chatter: true, min: 600 * time.Millisecond, max: 3 * time.Second},
+		{name: "max lifetime", limits: tunnelLimits{max: 300 * time.Millisecond}, chatter: true, min: 300 * time.Millisecond, max: 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, relayClient := tcpPair(t)
+			relayUpstream, server := tcpPair(t)
+			go io.Copy(io.Discard, server)
+
+			stop := make(chan struct{})
+			defer close(stop)
+			if tt.chatter {
+				go func() {
+					ticker := time.NewTicker(50 * time.Millisecond)
+					defer ticker.Stop()
+					deadline := time.After(600 * time.Millisecond)
+					for {
+						select {
+						case <-stop:
+							return
+						case <-deadline:
+							return
+						case <-ticker.C:
+							client.Write([]byte("x"))
+						}
+					}
+				}()
+			}
+
+			start := time.Now()
+			done := make(chan struct{})
+			go func() {
+				relayConns(relayClient, relayUpstream, tt.limits, nil)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(tt.max):
+				t.Fatalf("tunnel still open after %v", tt.max)
+			}
+			if elapsed := time.Since(start); elapsed < tt.min {
+				t.Errorf("tunnel closed after %v, want at least %v", elapsed, tt.min)
+			}
+		})
+	}
+}
+
+func TestSetTunnelTimeouts(t *testing.T) {
+	a := &App{}
+	a.SetTunnelTimeouts(30, -5)
+	if got := a.tunnelLimits(); got.idle != 30*time.Second || got.max != 0 {
+		t.Errorf("tunnelLimits() = %+v, want idle 30s and no max", got)
+	}
+	a.SetTunnelTimeouts(-1, 3600)
+	if got := a.tunnelLimits(); got.idle != 0 || got.max != time.Hour {
+		t.Errorf("tunnelLimits() = %+v, want no idle and max 1h", got)
+	}
+}
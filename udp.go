@@ -0,0 +1,792 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ---------------- SOCKS5 UDP 轉發 (UDP ASSOCIATE) ----------------
+
+const (
+	// 關聯閒置超過此時間 (雙向都沒有封包) 即關閉，0 表示不限制
+	defaultUDPIdleTimeout = 2 * time.Minute
+
+	udpBufferSize     = 64 * 1024
+	udpDialTimeout    = 10 * time.Second
+	udpRetryInterval  = 10 * time.Second // 上游建立關聯失敗後，暫停重試的時間
+	udpProbeTimeout   = 4 * time.Second
+	udpProbeTarget    = "1.1.1.1:53"
+	udpProbeQueryName = "example.com."
+	udpMaxDests       = 64 // 單一關聯同時追蹤的目標數，超過時結束最久未使用者
+)
+
+var (
+	errUDPNotSupported  = errors.New("upstream does not support UDP relay")
+	errUDPFragmented    = errors.New("socks5: fragmented datagrams not supported")
+	errUDPShortDatagram = errors.New("socks5: short UDP datagram")
+	errUDPEmptyDomain   = errors.New("socks5: empty destination domain")
+)
+
+// 上游是否能轉發 UDP: 僅限單跳、非 TLS 的 SOCKS5 節點 (UDP 無法經過代理鏈的 TCP 通道)
+func supportsUDPRelay(p *Proxy) bool {
+	return strings.EqualFold(p.Protocol, "socks5") && len(p.Via) == 0 && !isTLSProxy(p)
+}
+
+// 將 host:port 依 SOCKS5 格式 (ATYP ADDR PORT) 附加到 b
+func appendSocksAddr(b []byte, target string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			b = append(b, socks5AtypIPv4)
+			b = append(b, v4...)
+		} else {
+			b = append(b, socks5AtypIPv6)
+			b = append(b, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, errors.New("socks5: domain name too long")
+		}
+		b = append(b, socks5AtypDomain, byte(len(host)))
+		b = append(b, host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+// 解析 UDP 封包標頭: RSV(2) FRAG ATYP DST.ADDR DST.PORT DATA
+func parseUDPHeader(b []byte) (string, []byte, error) {
+	if len(b) < 4 {
+		return "", nil, errUDPShortDatagram
+	}
+	if b[2] != 0 {
+		return "", nil, errUDPFragmented
+	}
+
+	rest := b[4:]
+	var host string
+	switch b[3] {
+	case socks5AtypIPv4:
+		if len(rest) < net.IPv4len {
+			return "", nil, errUDPShortDatagram
+		}
+		host = net.IP(rest[:net.IPv4len]).String()
+		rest = rest[net.IPv4len:]
+	case socks5AtypIPv6:
+		if len(rest) < net.IPv6len {
+			return "", nil, errUDPShortDatagram
+		}
+		host = net.IP(rest[:net.IPv6len]).String()
+		rest = rest[net.IPv6len:]
+	case socks5AtypDomain:
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return "", nil, errUDPShortDatagram
+		}
+		if rest[0] == 0 {
+			return "", nil, errUDPEmptyDomain
+		}
+		host = string(rest[1 : 1+int(rest[0])])
+		rest = rest[1+int(rest[0]):]
+	default:
+		return "", nil, errSocksAtypNotSupported
+	}
+
+	if len(rest) < 2 {
+		return "", nil, errUDPShortDatagram
+	}
+	port := binary.BigEndian.Uint16(rest)
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), rest[2:], nil
+}
+
+// 組出送往 target 的 UDP 封包
+func buildUDPDatagram(target string, payload []byte) ([]byte, error) {
+	b, err := appendSocksAddr([]byte{0x00, 0x00, 0x00}, target)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, payload...), nil
+}
+
+// ---------------- 上游 SOCKS5 UDP 關聯 ----------------
+
+// 以 SOCKS5 客戶端身份完成認證並送出請求，回傳代理回覆的 BND 位址
+func socks5Request(conn net.Conn, p *Proxy, cmd byte, target string) (string, error) {
+	methods := []byte{socks5AuthNone}
+	if p.Username != "" {
+		methods = append(methods, socks5AuthPassword)
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return "", err
+	}
+
+	br := bufio.NewReader(conn)
+	choice := make([]byte, 2)
+	if _, err := io.ReadFull(br, choice); err != nil {
+		return "", err
+	}
+	if choice[0] != socks5Version {
+		return "", fmt.Errorf("socks5: unexpected version %d", choice[0])
+	}
+
+	switch choice[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if len(p.Username) > 255 || len(p.Password) > 255 {
+			return "", errors.New("socks5: credentials too long")
+		}
+		// RFC 1929: VER ULEN UNAME PLEN PASSWD
+		msg := []byte{socks5PasswordVersion, byte(len(p.Username))}
+		msg = append(msg, p.Username...)
+		msg = append(msg, byte(len(p.Password)))
+		msg = append(msg, p.Password...)
+		if _, err := conn.Write(msg); err != nil {
+			return "", err
+		}
+		status := make([]byte, 2)
+		if _, err := io.ReadFull(br, status); err != nil {
+			return "", err
+		}
+		if status[1] != 0x00 {
+			return "", errProxyAuthRequired
+		}
+	default:
+		if p.Username == "" {
+			return "", errProxyAuthRequired
+		}
+		return "", errors.New("socks5: no acceptable authentication methods")
+	}
+
+	req, err := appendSocksAddr([]byte{socks5Version, cmd, 0x00}, target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return "", err
+	}
+
+	// VER REP RSV ATYP BND.ADDR BND.PORT
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return "", err
+	}
+	if head[1] != socks5RepSucceeded {
+		return "", fmt.Errorf("socks5: request rejected (reply %d)", head[1])
+	}
+	return readSocksAddr(br, head[3])
+}
+
+// udpRelay 與上游 SOCKS5 代理的 UDP 關聯，控制連線關閉即失效
+type udpRelay struct {
+	ctrl net.Conn
+	conn *net.UDPConn // 只與代理的轉發位址通訊
+}
+
+func (r *udpRelay) Close() {
+	r.ctrl.Close()
+	r.conn.Close()
+}
+
+// 向上游 SOCKS5 代理要求 UDP ASSOCIATE
+func dialUDPAssociate(p *Proxy, timeout time.Duration) (*udpRelay, error) {
+	if !supportsUDPRelay(p) {
+		return nil, errUDPNotSupported
+	}
+
+	ctrl, err := net.DialTimeout("tcp", net.JoinHostPort(p.IP, p.Port), timeout)
+	if err != nil {
+		return nil, err
+	}
+	ctrl.SetDeadline(time.Now().Add(timeout))
+
+	bind, err := socks5Request(ctrl, p, socks5CmdUDPAssociate, "0.0.0.0:0")
+	if err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+
+	// 代理回覆未指定位址時，轉發位址與代理相同
+	host, port, _ := net.SplitHostPort(bind)
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = p.IP
+	}
+	if port == "0" {
+		ctrl.Close()
+		return nil, errors.New("socks5: proxy returned no relay port")
+	}
+	raddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+	ctrl.SetDeadline(time.Time{})
+
+	// 代理關閉控制連線時，關聯隨之結束
+	go func() {
+		io.Copy(io.Discard, ctrl)
+		conn.Close()
+	}()
+	return &udpRelay{ctrl: ctrl, conn: conn}, nil
+}
+
+// 經由 SOCKS5 代理送出 DNS 查詢，確認代理確實會轉發 UDP
+func probeUDP(p *Proxy, timeout time.Duration) error {
+	relay, err := dialUDPAssociate(p, timeout)
+	if err != nil {
+		return err
+	}
+	defer relay.Close()
+
+	idBuf := make([]byte, 2)
+	rand.Read(idBuf)
+	id := binary.BigEndian.Uint16(idBuf)
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(udpProbeQueryName),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	pkt, err := buildUDPDatagram(udpProbeTarget, query)
+	if err != nil {
+		return err
+	}
+
+	// UDP 可能遺失，分兩次送出
+	buf := make([]byte, udpBufferSize)
+	for attempt := 0; attempt < 2; attempt++ {
+		if _, err := relay.conn.Write(pkt); err != nil {
+			return err
+		}
+		relay.conn.SetReadDeadline(time.Now().Add(timeout / 2))
+		for {
+			n, err := relay.conn.Read(buf)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					break
+				}
+				return err
+			}
+			_, payload, err := parseUDPHeader(buf[:n])
+			if err != nil {
+				continue
+			}
+			var reply dnsmessage.Message
+			if reply.Unpack(payload) == nil && reply.ID == id && reply.Response {
+				return nil
+			}
+		}
+	}
+	return errors.New("no UDP reply through proxy")
+}
+
+// ---------------- 本地 UDP 關聯 ----------------
+
+// udpAssociation 單一客戶端的 UDP ASSOCIATE，依每個封包的目標分流
+type udpAssociation struct {
+	app      *App
+	local    *net.UDPConn // 與客戶端之間
+	clientIP net.IP
+	idle     time.Duration
+
+	lastActive atomic.Int64
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	mu       sync.Mutex
+	client   *net.UDPAddr // 第一個封包的來源，之後只接受此位址
+	direct   *net.UDPConn // 直連用 (首次使用時建立)
+	relays   map[string]*udpRelay
+	failures map[string]time.Time
+	dests    map[string]*udpDest // 依客戶端指定的目標分別記錄
+	peers    map[string]string   // 實際送達的位址 -> 目標，用於歸屬回應封包
+	lastDest string              // 回應來源無法對應時計入最近送出的目標
+	closed   bool
+}
+
+// udpDest 關聯中單一目標的連線表紀錄與流量統計 (頻寬限制依該目標主機套用)
+type udpDest struct {
+	lc       *liveConn
+	flow     *trafficFlow
+	lastUsed time.Time
+}
+
+// 處理 UDP ASSOCIATE 請求，直到控制連線關閉或閒置逾時
+// hint 為客戶端宣告的來源位址 (多為 0.0.0.0:0)
+func (a *App) handleUDPAssociate(ctrl net.Conn, hint string) {
+	// 在客戶端連進來的介面上開啟 UDP 端口
+	var bindIP net.IP
+	if addr, ok := ctrl.LocalAddr().(*net.TCPAddr); ok {
+		bindIP = addr.IP
+	}
+	local, err := net.ListenUDP("udp", &net.UDPAddr{IP: bindIP})
+	if err != nil {
+		writeSocksReply(ctrl, socks5RepGeneralFailure, nil)
+		return
+	}
+
+	s := &udpAssociation{
+		app:      a,
+		local:    local,
+		clientIP: net.ParseIP(remoteIP(ctrl.RemoteAddr())),
+		idle:     a.udpTimeout(),
+		done:     make(chan struct{}),
+		relays:   make(map[string]*udpRelay),
+		failures: make(map[string]time.Time),
+		dests:    make(map[string]*udpDest),
+		peers:    make(map[string]string),
+	}
+	// 客戶端已宣告完整來源位址時只接受該來源
+	if host, port, err := net.SplitHostPort(hint); err == nil {
+		ip := net.ParseIP(host)
+		if p, _ := strconv.Atoi(port); p != 0 && ip != nil && !ip.IsUnspecified() {
+			s.client = &net.UDPAddr{IP: ip, Port: p}
+		}
+	}
+	s.touch()
+	defer s.close()
+
+	if err := writeSocksReply(ctrl, socks5RepSucceeded, local.LocalAddr()); err != nil {
+		return
+	}
+	ctrl.SetDeadline(time.Time{})
+
+	if a.ctx != nil {
+		wailsRuntime.LogInfo(a.ctx, fmt.Sprintf("收到 SOCKS5 請求: UDP ASSOCIATE %s (relay %s)", ctrl.RemoteAddr(), local.LocalAddr()))
+	}
+
+	go s.serveClient()
+	go s.watchIdle()
+	// 控制連線關閉即結束關聯
+	go func() {
+		io.Copy(io.Discard, ctrl)
+		s.close()
+	}()
+	<-s.done
+}
+
+func (s *udpAssociation) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+func (s *udpAssociation) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.local.Close()
+
+		s.mu.Lock()
+		s.closed = true
+		if s.direct != nil {
+			s.direct.Close()
+		}
+		for _, r := range s.relays {
+			r.Close()
+		}
+		dests := s.dests
+		s.dests = nil
+		s.mu.Unlock()
+
+		for _, d := range dests {
+			s.endDest(d)
+		}
+	})
+}
+
+func (s *udpAssociation) endDest(d *udpDest) {
+	d.flow.end()
+	s.app.conns.remove(d.lc)
+}
+
+// 閒置超過上限即關閉
+func (s *udpAssociation) watchIdle() {
+	if s.idle <= 0 {
+		return
+	}
+	interval := s.idle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, s.lastActive.Load())) >= s.idle {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// 只接受控制連線同一來源 IP 的封包，第一個封包決定客戶端端口
+func (s *udpAssociation) acceptFrom(from *net.UDPAddr) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		if !from.IP.Equal(s.clientIP) {
+			return false
+		}
+		s.client = from
+		return true
+	}
+	return from.IP.Equal(s.client.IP) && from.Port == s.client.Port
+}
+
+// 讀取客戶端送來的封包並依目標轉發
+func (s *udpAssociation) serveClient() {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, from, err := s.local.ReadFromUDP(buf)
+		if err != nil {
+			s.close()
+			return
+		}
+		if !s.acceptFrom(from) {
+			continue
+		}
+		target, payload, err := parseUDPHeader(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.touch()
+		s.forward(target, payload)
+	}
+}
+
+// 依分流規則決定直連、走代理或丟棄
+func (s *udpAssociation) forward(target string, payload []byte) {
+	a := s.app
+	var remote *Proxy
+	switch action, _ := a.matchRule(target, 0); action {
+	case actionReject:
+		return
+	case actionProxy:
+		remote = a.pickUpstream(target)
+		if remote == nil {
+			return
+		}
+	}
+
+	flow := s.track(target, remote)
+	if flow == nil {
+		return
+	}
+	// UDP 無法延遲送出，超過頻寬限制的封包直接丟棄
+	if !flow.limiter().allow(dirUp, len(payload)) {
+		return
+	}
+
+	var err error
+	if remote == nil {
+		err = s.sendDirect(target, payload)
+	} else {
+		err = s.sendRelay(remote, target, payload)
+	}
+	if err != nil {
+		if a.ctx != nil {
+			wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("UDP datagram to %s dropped: %v", target, err))
+		}
+		return
+	}
+	flow.addUp(len(payload))
+}
+
+// 每個目標第一次送出時登記到連線表與流量統計，關聯已關閉時回傳 nil
+// 從連線表關閉任一目標即結束整個關聯 (無法只停止客戶端送往單一目標)
+func (s *udpAssociation) track(target string, remote *Proxy) *trafficFlow {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastDest = target
+	if d := s.dests[target]; d != nil {
+		d.lastUsed = time.Now()
+		s.mu.Unlock()
+		return d.flow
+	}
+
+	var evicted *udpDest
+	if len(s.dests) >= udpMaxDests {
+		evicted = s.evictLocked()
+	}
+	client := s.clientIP.String()
+	d := &udpDest{
+		lc:       s.app.conns.add(connKindUDP, client, target, remote),
+		flow:     s.app.beginTraffic(client, target, remote),
+		lastUsed: time.Now(),
+	}
+	d.lc.attach(d.flow)
+	d.lc.setState(connStateEstablished)
+	s.dests[target] = d
+	s.mu.Unlock()
+
+	if evicted != nil {
+		s.endDest(evicted)
+	}
+	d.lc.onKill(s.close)
+	return d.flow
+}
+
+// 移除最久未使用的目標 (呼叫者需持有 s.mu)
+func (s *udpAssociation) evictLocked() *udpDest {
+	var oldest string
+	for key, d := range s.dests {
+		if oldest == "" || d.lastUsed.Before(s.dests[oldest].lastUsed) {
+			oldest = key
+		}
+	}
+	d := s.dests[oldest]
+	delete(s.dests, oldest)
+	for addr, key := range s.peers {
+		if key == oldest {
+			delete(s.peers, addr)
+		}
+	}
+	return d
+}
+
+// 記錄實際送達的位址屬於哪個目標
+func (s *udpAssociation) notePeer(addr, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dests[target] != nil {
+		s.peers[addr] = target
+	}
+}
+
+// 直連送出，回應由 readDirect 轉回客戶端
+func (s *udpAssociation) sendDirect(target string, payload []byte) error {
+	addr, err := s.app.directResolver().direct(context.Background(), target)
+	if err != nil {
+		return err
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.notePeer(raddr.String(), target)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	conn := s.direct
+	if conn == nil {
+		if conn, err = net.ListenUDP("udp", nil); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.direct = conn
+		go s.readDirect(conn)
+	}
+	s.mu.Unlock()
+
+	_, err = conn.WriteToUDP(payload, raddr)
+	return err
+}
+
+func (s *udpAssociation) readDirect(conn *net.UDPConn) {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		// 以實際來源位址回覆 (IPv4 對應位址還原為 IPv4)
+		src := &net.UDPAddr{IP: from.IP, Port: from.Port}
+		if v4 := from.IP.To4(); v4 != nil {
+			src.IP = v4
+		}
+		pkt, err := buildUDPDatagram(src.String(), buf[:n])
+		if err != nil {
+			continue
+		}
+		s.toClient(src.String(), pkt, n)
+	}
+}
+
+// 經上游 SOCKS5 關聯送出，目標主機名稱依 DNS 策略交給代理或先行解析
+func (s *udpAssociation) sendRelay(remote *Proxy, target string, payload []byte) error {
+	relay, err := s.relayFor(remote)
+	if err != nil {
+		return err
+	}
+	next, err := s.app.proxyResolver(remote).forHop(context.Background(), remote, target)
+	if err != nil {
+		return err
+	}
+	pkt, err := buildUDPDatagram(next, payload)
+	if err != nil {
+		return err
+	}
+	s.notePeer(next, target)
+	_, err = relay.conn.Write(pkt)
+	return err
+}
+
+// 取得或建立到上游的關聯，失敗後一段時間內不重試
+func (s *udpAssociation) relayFor(remote *Proxy) (*udpRelay, error) {
+	key := transportKey(remote)
+
+	s.mu.Lock()
+	if r := s.relays[key]; r != nil {
+		s.mu.Unlock()
+		return r, nil
+	}
+	if t, ok := s.failures[key]; ok && time.Since(t) < udpRetryInterval {
+		s.mu.Unlock()
+		return nil, errUDPNotSupported
+	}
+	s.mu.Unlock()
+
+	r, err := dialUDPAssociate(remote, udpDialTimeout)
+	if err != nil {
+		s.mu.Lock()
+		s.failures[key] = time.Now()
+		s.mu.Unlock()
+		if a := s.app; a.ctx != nil {
+			if errors.Is(err, errProxyAuthRequired) {
+				wailsRuntime.EventsEmit(a.ctx, "proxy_auth_failed", remote.IP)
+			}
+			wailsRuntime.LogWarning(a.ctx, fmt.Sprintf("UDP associate via %s failed: %v", net.JoinHostPort(remote.IP, remote.Port), err))
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		r.Close()
+		return nil, net.ErrClosed
+	}
+	s.relays[key] = r
+	s.mu.Unlock()
+
+	go s.readRelay(key, r)
+	return r, nil
+}
+
+// 上游回覆的封包已是 SOCKS5 UDP 格式，直接轉給客戶端
+func (s *udpAssociation) readRelay(key string, r *udpRelay) {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, err := r.conn.Read(buf)
+		if err != nil {
+			break
+		}
+		from, payload, err := parseUDPHeader(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.toClient(from, buf[:n], len(payload))
+	}
+
+	// 上游關聯結束，下個封包會重新建立
+	r.Close()
+	s.mu.Lock()
+	if s.relays[key] == r {
+		delete(s.relays, key)
+	}
+	s.mu.Unlock()
+}
+
+// 回應計入來源位址對應的目標，由該目標的流量統計與頻寬限制處理
+func (s *udpAssociation) toClient(from string, pkt []byte, payloadLen int) {
+	s.mu.Lock()
+	client := s.client
+	key, ok := s.peers[from]
+	if !ok {
+		key = s.lastDest
+	}
+	var flow *trafficFlow
+	if d := s.dests[key]; d != nil {
+		flow = d.flow
+	}
+	s.mu.Unlock()
+	if client == nil || !flow.limiter().allow(dirDown, payloadLen) {
+		return
+	}
+	if _, err := s.local.WriteToUDP(pkt, client); err != nil {
+		return
+	}
+	s.touch()
+	if flow != nil {
+		flow.addDown(payloadLen)
+	}
+}
+
+// 取得目前的 UDP 關聯閒置上限
+func (a *App) udpTimeout() time.Duration {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.udpIdleTimeout
+}
+
+// 24. 設定 SOCKS5 UDP 關聯的閒置上限 (秒)，0 表示不限制；只套用於之後建立的關聯
+func (a *App) SetUDPTimeout(idleSeconds int) {
+	if idleSeconds < 0 {
+		idleSeconds = 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.udpIdleTimeout = time.Duration(idleSeconds) * time.Second
+}
+
+// 24-1. 檢測節點是否支援 UDP 轉發 (與 TCP 驗證分開呼叫，避免拖慢一般驗證)
+func (a *App) CheckProxyUDP(node Proxy) CheckResult {
+	a.applyProxyChain(&node)
+	if !supportsUDPRelay(&node) {
+		return CheckResult{Success: false, Error: errUDPNotSupported.Error()}
+	}
+
+	start := time.Now()
+	err := probeUDP(&node, udpProbeTimeout)
+	supported := err == nil
+	res := CheckResult{Success: supported, UDPSupported: &supported}
+	if err != nil {
+		res.Error = err.Error()
+		if a.ctx != nil {
+			wailsRuntime.LogDebug(a.ctx, fmt.Sprintf("UDP check failed for %s: %v", net.JoinHostPort(node.IP, node.Port), err))
+		}
+		return res
+	}
+	res.Latency = time.Since(start).Milliseconds()
+	return res
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseUDPHeader(t *testing.T) {
+	longName := strings.Repeat("a", 255)
+	tests := []struct {
+		name    string
+		in      []byte
+		target  string
+		payload []byte
+		err     error
+	}{
+		{
+			name:    "ipv4",
+			in:      []byte{0, 0, 0, socks5AtypIPv4, 1, 1, 1, 1, 0, 53, 'h', 'i'},
+			target:  "1.1.1.1:53",
+			payload: []byte("hi"),
+		},
+		{
+			name:    "ipv6",
+			in:      append([]byte{0, 0, 0, socks5AtypIPv6, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x01, 0xbb}, 'x'),
+			target:  "[2001:db8::1]:443",
+			payload: []byte("x"),
+		},
+		{
+			name:    "domain",
+			in:      append([]byte{0, 0, 0, socks5AtypDomain, 11}, append([]byte("example.com"), 0x1f, 0x90)...),
+			target:  "example.com:8080",
+			payload: []byte{},
+		},
+		{
+			name:    "longest domain",
+			in:      append(append([]byte{0, 0, 0, socks5AtypDomain, 255}, longName...), 0, 80, 'p'),
+			target:  longName + ":80",
+			payload: []byte("p"),
+		},
+		{
+			name:    "reserved bytes ignored",
+			in:      []byte{0xff, 0xff, 0, socks5AtypIPv4, 127, 0, 0, 1, 0, 7},
+			target:  "127.0.0.1:7",
+			payload: []byte{},
+		},
+
+		{name: "empty", in: nil, err: errUDPShortDatagram},
+		{name: "header truncated", in: []byte{0, 0, 0}, err: errUDPShortDatagram},
+		{name: "fragmented", in: []byte{0, 0, 1, socks5AtypIPv4, 1, 1, 1, 1, 0, 53}, err: errUDPFragmented},
+		{name: "unknown address type", in: []byte{0, 0, 0, 0x05, 1, 1, 1, 1, 0, 53}, err: errSocksAtypNotSupported},
+		{name: "ipv4 truncated", in: []byte{0, 0, 0, socks5AtypIPv4, 1, 1, 1}, err: errUDPShortDatagram},
+		{name: "ipv6 truncated", in: []byte{0, 0, 0, socks5AtypIPv6, 0x20, 0x01, 0x0d, 0xb8}, err: errUDPShortDatagram},
+		{name: "domain length missing", in: []byte{0, 0, 0, socks5AtypDomain}, err: errUDPShortDatagram},
+		{name: "domain length exceeds datagram", in: []byte{0, 0, 0, socks5AtypDomain, 200, 'a', 'b'}, err: errUDPShortDatagram},
+		{name: "domain empty", in: []byte{0, 0, 0, socks5AtypDomain, 0, 0, 53}, err: errUDPEmptyDomain},
+		{name: "port missing", in: []byte{0, 0, 0, socks5AtypIPv4, 1, 1, 1, 1}, err: errUDPShortDatagram},
+		{name: "port truncated", in: []byte{0, 0, 0, socks5AtypIPv4, 1, 1, 1, 1, 0}, err: errUDPShortDatagram},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, payload, err := parseUDPHeader(tt.in)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("parseUDPHeader() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseUDPHeader() error: %v", err)
+			}
+			if target != tt.target || !bytes.Equal(payload, tt.payload) {
+				t.Errorf("parseUDPHeader() = %q, %q, want %q, %q", target, payload, tt.target, tt.payload)
+			}
+		})
+	}
+}
+
+func TestBuildUDPDatagramRoundTrip(t *testing.T) {
+	for _, target := range []string{"8.8.8.8:53", "[2001:db8::1]:443", "example.com:8080"} {
+		pkt, err := buildUDPDatagram(target, []byte("payload"))
+		if err != nil {
+			t.Fatalf("buildUDPDatagram(%q) error: %v", target, err)
+		}
+		got, payload, err := parseUDPHeader(pkt)
+		if err != nil || got != target || string(payload) != "payload" {
+			t.Errorf("round trip %q = %q, %q, %v", target, got, payload, err)
+		}
+	}
+
+	if _, err := buildUDPDatagram(strings.Repeat("a", 256)+":53", nil); err == nil {
+		t.Error("buildUDPDatagram accepted a domain longer than 255 bytes")
+	}
+	if _, err := buildUDPDatagram("example.com:65536", nil); err == nil {
+		t.Error("buildUDPDatagram accepted an out of range port")
+	}
+}
+
+func TestAppendSocksAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    []byte
+		wantErr bool
+	}{
+		{name: "ipv4", target: "1.2.3.4:80", want: []byte{socks5AtypIPv4, 1, 2, 3, 4, 0, 80}},
+		{name: "ipv4 mapped", target: "[::ffff:1.2.3.4]:80", want: []byte{socks5AtypIPv4, 1, 2, 3, 4, 0, 80}},
+		{name: "ipv6", target: "[::1]:443", want: []byte{socks5AtypIPv6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0x01, 0xbb}},
+		{name: "domain", target: "a.io:65535", want: []byte{socks5AtypDomain, 4, 'a', '.', 'i', 'o', 0xff, 0xff}},
+		{name: "zero port", target: "0.0.0.0:0", want: []byte{socks5AtypIPv4, 0, 0, 0, 0, 0, 0}},
+
+		{name: "missing port", target: "1.2.3.4", wantErr: true},
+		{name: "port not numeric", target: "1.2.3.4:dns", wantErr: true},
+		{name: "port out of range", target: "1.2.3.4:65536", wantErr: true},
+		{name: "domain too long", target: strings.Repeat("a", 256) + ":53", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := appendSocksAddr([]byte{0xee}, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("appendSocksAddr(%q) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(got, append([]byte{0xee}, tt.want...)) {
+				t.Errorf("appendSocksAddr(%q) = %v, want prefix + %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupportsUDPRelay(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Proxy
+		want bool
+	}{
+		{name: "socks5", p: Proxy{Protocol: "socks5"}, want: true},
+		{name: "case insensitive", p: Proxy{Protocol: "SOCKS5"}, want: true},
+		{name: "http", p: Proxy{Protocol: "http"}},
+		{name: "socks4", p: Proxy{Protocol: "socks4"}},
+		{name: "default protocol", p: Proxy{}},
+		{name: "chained", p: Proxy{Protocol: "socks5", Via: []Proxy{{IP: "10.0.0.1", Port: "1080"}}}},
+		{name: "https", p: Proxy{Protocol: "https"}},
+	}
+	for _, tt := range tests {
+		if got := supportsUDPRelay(&tt.p); got != tt.want {
+			t.Errorf("%s: supportsUDPRelay() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 支援 UDP ASSOCIATE 的 SOCKS5 代理: DNS 查詢直接回覆，其餘封包原樣回傳
+func startUDPSocks5Proxy(t *testing.T, user, pass string) string {
+	t.Helper()
+	return startTestServer(t, func(c net.Conn) {
+		br := bufio.NewReader(c)
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(br, head); err != nil {
+			return
+		}
+		io.ReadFull(br, make([]byte, head[1]))
+		if user == "" {
+			c.Write([]byte{5, socks5AuthNone})
+		} else {
+			c.Write([]byte{5, socks5AuthPassword})
+			ver := make([]byte, 2)
+			io.ReadFull(br, ver)
+			u := make([]byte, ver[1])
+			io.ReadFull(br, u)
+			plen, _ := br.ReadByte()
+			p := make([]byte, plen)
+			io.ReadFull(br, p)
+			if string(u) != user || string(p) != pass {
+				c.Write([]byte{1, 1})
+				return
+			}
+			c.Write([]byte{1, 0})
+		}
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(br, req); err != nil {
+			return
+		}
+		if _, err := readSocksAddr(br, req[3]); err != nil || req[1] != socks5CmdUDPAssociate {
+			writeSocksReply(c, socks5RepCmdNotSupported, nil)
+			return
+		}
+
+		relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return
+		}
+		defer relay.Close()
+		writeSocksReply(c, socks5RepSucceeded, relay.LocalAddr())
+		go func() {
+			buf := make([]byte, udpBufferSize)
+			for {
+				n, from, err := relay.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				target, payload, err := parseUDPHeader(buf[:n])
+				if err != nil {
+					continue
+				}
+				var msg dnsmessage.Message
+				if msg.Unpack(payload) == nil && !msg.Response {
+					msg.Response = true
+					payload, _ = msg.Pack()
+				}
+				pkt, _ := buildUDPDatagram(target, payload)
+				relay.WriteToUDP(pkt, from)
+			}
+		}()
+		io.Copy(io.Discard, br)
+	})
+}
+
+func TestProbeUDP(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      string
+		pass      string
+		proxyUser string
+		proxyPass string
+		err       error
+	}{
+		{name: "no auth"},
+		{name: "password", user: "u", pass: "p", proxyUser: "u", proxyPass: "p"},
+		{name: "wrong password", user: "u", pass: "x", proxyUser: "u", proxyPass: "p", err: errProxyAuthRequired},
+		{name: "credentials required", proxyUser: "u", proxyPass: "p", err: errProxyAuthRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := hopFor(t, startUDPSocks5Proxy(t, tt.proxyUser, tt.proxyPass), "socks5")
+			p.Username, p.Password = tt.user, tt.pass
+			err := probeUDP(p, 2*time.Second)
+			if tt.err == nil && err != nil {
+				t.Fatalf("probeUDP() error: %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("probeUDP() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// 只支援 TCP 的代理會拒絕 UDP ASSOCIATE
+	if err := probeUDP(hopFor(t, startSocks5Proxy(t), "socks5"), 2*time.Second); err == nil {
+		t.Error("probeUDP() succeeded through a TCP-only proxy")
+	}
+	if err := probeUDP(&Proxy{IP: "127.0.0.1", Port: "1", Protocol: "http"}, time.Second); !errors.Is(err, errUDPNotSupported) {
+		t.Errorf("probeUDP(http) error = %v, want %v", err, errUDPNotSupported)
+	}
+}
+
+// 向本地中轉要求 UDP ASSOCIATE，回傳控制連線、客戶端 socket、轉發位址與結束通知
+func startUDPAssociation(t *testing.T, a *App) (ctrl net.Conn, client *net.UDPConn, relay *net.UDPAddr, done chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		a.handleUDPAssociate(c, "0.0.0.0:0")
+	}()
+
+	ctrl, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ctrl.Close() })
+	ctrl.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(ctrl)
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(br, head); err != nil || head[1] != socks5RepSucceeded {
+		t.Fatalf("UDP ASSOCIATE reply = %v, %v", head, err)
+	}
+	bind, err := readSocksAddr(br, head[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relay, err = net.ResolveUDPAddr("udp", bind); err != nil {
+		t.Fatal(err)
+	}
+	if client, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return ctrl, client, relay, done
+}
+
+// 經關聯送出一個封包並等待回覆，回傳回覆的來源與內容
+func udpExchange(t *testing.T, client *net.UDPConn, relay *net.UDPAddr, target, payload string) (string, string, error) {
+	t.Helper()
+	pkt, err := buildUDPDatagram(target, []byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.WriteToUDP(pkt, relay); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, udpBufferSize)
+	n, _, err := client.ReadFromUDP(buf)
+	if err != nil {
+		return "", "", err
+	}
+	got, data, err := parseUDPHeader(buf[:n])
+	return got, string(data), err
+}
+
+// UDP echo 伺服器
+func startUDPEcho(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, udpBufferSize)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[:n], from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestUDPAssociation(t *testing.T) {
+	echo := startUDPEcho(t)
+
+	t.Run("direct", func(t *testing.T) {
+		a := &App{rules: []*compiledRule{mustParseRule(t, "IP-CIDR,127.0.0.0/8,DIRECT")}}
+		ctrl, client, relay, done := startUDPAssociation(t, a)
+		target, data, err := udpExchange(t, client, relay, echo, "ping")
+		if err != nil || target != echo || data != "ping" {
+			t.Fatalf("exchange = %q, %q, %v, want %s ping", target, data, err, echo)
+		}
+		if conns := a.conns.list(); len(conns) != 1 || conns[0].Kind != connKindUDP {
+			t.Errorf("connections = %+v, want one UDP association", conns)
+		}
+
+		// 其他端口送來的封包不予轉發
+		other, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		if _, _, err := udpExchange(t, other, relay, echo, "intruder"); err == nil {
+			t.Error("datagram from a second client port was relayed")
+		}
+
+		ctrl.Close()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("association not closed with the control connection")
+		}
+		if conns := a.conns.list(); len(conns) != 0 {
+			t.Errorf("connections after close = %+v", conns)
+		}
+	})
+
+	t.Run("upstream relay", func(t *testing.T) {
+		a := &App{activeRemote: hopFor(t, startUDPSocks5Proxy(t, "", ""), "socks5")}
+		_, client, relay, _ := startUDPAssociation(t, a)
+		target, data, err := udpExchange(t, client, relay, "192.0.2.1:9", "via proxy")
+		if err != nil || target != "192.0.2.1:9" || data != "via proxy" {
+			t.Fatalf("exchange = %q, %q, %v", target, data, err)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		a := &App{rules: []*compiledRule{mustParseRule(t, "MATCH,REJECT")}}
+		_, client, relay, _ := startUDPAssociation(t, a)
+		if _, _, err := udpExchange(t, client, relay, echo, "dropped"); err == nil {
+			t.Error("rejected datagram was relayed")
+		}
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		a := &App{udpIdleTimeout: 50 * time.Millisecond}
+		_, _, _, done := startUDPAssociation(t, a)
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			t.Fatal("idle association not closed")
+		}
+	})
+}
+
+func TestSetUDPTimeout(t *testing.T) {
+	a := &App{}
+	a.SetUDPTimeout(30)
+	if got := a.udpTimeout(); got != 30*time.Second {
+		t.Errorf("udpTimeout() = %v, want 30s", got)
+	}
+	a.SetUDPTimeout(-5)
+	if got := a.udpTimeout(); got != 0 {
+		t.Errorf("udpTimeout() after negative = %v, want 0", got)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpgradeType(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection []string
+		upgrade    string
+		want       string
+	}{
+		{name: "websocket", connection: []string{"Upgrade"}, upgrade: "websocket", want: "websocket"},
+		{name: "token list", connection: []string{"keep-alive, Upgrade"}, upgrade: "websocket", want: "websocket"},
+		{name: "case insensitive", connection: []string{"UPGRADE"}, upgrade: "h2c", want: "h2c"},
+		{name: "multiple headers", connection: []string{"keep-alive", "upgrade"}, upgrade: "websocket", want: "websocket"},
+		{name: "no connection token", connection: []string{"keep-alive"}, upgrade: "websocket", want: ""},
+		{name: "no upgrade header", connection: []string{"Upgrade"}, want: ""},
+		{name: "plain request", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for _, v := range tt.connection {
+				h.Add("Connection", v)
+			}
+			if tt.upgrade != "" {
+				h.Set("Upgrade", tt.upgrade)
+			}
+			if got := upgradeType(h); got != tt.want {
+				t.Errorf("upgradeType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 上游回應 101 後，客戶端與上游之間應能雙向傳輸 (含握手後緊接送出的資料)
+func TestHandleUpgrade(t *testing.T) {
+	// 上游: 回應 101 後回傳收到的資料
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + r.Header.Get("Upgrade") + "\r\nX-Upstream: yes\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	defer upstream.Close()
+
+	// 中轉: 以 upgradeType 轉送升級請求並交由 handleUpgrade 接管
+	middleware := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequest(r.Method, upstream.URL+r.URL.Path, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", upgradeType(r.Header))
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			resp.Body.Close()
+			http.Error(w, resp.Status, http.StatusBadGateway)
+			return
+		}
+		var conns connRegistry
+		handleUpgrade(w, resp, tunnelLimits{}, conns.add(connKindUpgrade, "127.0.0.1", r.Host, nil))
+	}))
+	defer middleware.Close()
+
+	conn, err := net.Dial("tcp", middleware.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 握手與第一筆資料一起送出
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\nhello")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("X-Upstream") != "yes" {
+		t.Fatalf("response = %s %v, want upstream 101", resp.Status, resp.Header)
+	}
+
+	buf := make([]byte, len("hello"))
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("buffered data = %q, %v, want hello", buf, err)
+	}
+	io.WriteString(conn, "world")
+	buf = make([]byte, len("world"))
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "world" {
+		t.Fatalf("relayed data = %q, %v, want world", buf, err)
+	}
+}